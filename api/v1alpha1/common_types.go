@@ -6,3 +6,14 @@ const (
 	MariaDBStatusReady MariaDBStatusType = "Ready"
 	MariaDBStatusError MariaDBStatusType = "Error"
 )
+
+// DeletionPolicy defines what happens with the object in the database when the resource is deleted
+// +kubebuilder:validation:Enum=Retain;Delete
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyRetain leaves the object in the database
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyDelete drops the object from the database
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
@@ -19,8 +19,12 @@ package v1alpha1
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -48,16 +52,180 @@ type MariaDBBackupSpec struct {
 	// CronExpression represents cron syntax for kubernetes CronJob
 	// +optional
 	CronExpression string `json:"cron,omitempty"`
+
+	// Method of the backup, logical runs mysqldump, physical streams mariabackup from a Galera node
+	// +kubebuilder:validation:Enum=logical;physical
+	// +kubebuilder:default:="logical"
+	// +optional
+	Method BackupMethod `json:"method,omitempty"`
+
+	// Retention describes which backups are kept in BackupURL, the others are deleted after each successful backup
+	// +optional
+	Retention *BackupRetention `json:"retention,omitempty"`
+
+	// BinlogArchive enables continuous archiving of binary logs to <BackupURL>/binlog for point-in-time recovery
+	// +optional
+	BinlogArchive *BinlogArchiveSpec `json:"binlogArchive,omitempty"`
+}
+
+// BinlogArchiveSpec defines how binary logs of the cluster are archived
+type BinlogArchiveSpec struct {
+	// Interval between runs of the archiver, binary logs are rotated at the start of each run (Ex. 5m)
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// BackupMethod describes how the backup is created
+type BackupMethod string
+
+const (
+	// BackupMethodLogical dumps databases using mysqldump
+	BackupMethodLogical BackupMethod = "logical"
+	// BackupMethodPhysical copies data files using mariabackup
+	BackupMethodPhysical BackupMethod = "physical"
+)
+
+// BackupRetention defines retention policy of backups. Backups selected by any of the keep rules are kept,
+// backups older than MaxAge are always deleted. The newest backup is never deleted.
+type BackupRetention struct {
+	// KeepLast number of the newest backups to keep
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepLast int32 `json:"keepLast,omitempty"`
+
+	// KeepDaily number of days for which the newest backup is kept
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepDaily int32 `json:"keepDaily,omitempty"`
+
+	// KeepWeekly number of weeks for which the newest backup is kept
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepWeekly int32 `json:"keepWeekly,omitempty"`
+
+	// KeepMonthly number of months for which the newest backup is kept
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepMonthly int32 `json:"keepMonthly,omitempty"`
+
+	// MaxAge backups older than this are deleted (Ex. 720h)
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// BackupPhase describes the state of a single backup run
+type BackupPhase string
+
+const (
+	// BackupPhaseRunning backup job is running
+	BackupPhaseRunning BackupPhase = "Running"
+	// BackupPhaseSucceeded backup was uploaded
+	BackupPhaseSucceeded BackupPhase = "Succeeded"
+	// BackupPhaseFailed backup job failed
+	BackupPhaseFailed BackupPhase = "Failed"
+)
+
+// MariaDBBackupRun describes a single execution of the backup job
+type MariaDBBackupRun struct {
+	// JobName is the name of the job which created the backup
+	JobName string `json:"jobName"`
+
+	// JobUID identifies the run, a one-shot job is recreated with the same name when the backup config changes
+	// +optional
+	JobUID types.UID `json:"jobUID,omitempty"`
+
+	// Phase of the backup run
+	Phase BackupPhase `json:"phase"`
+
+	// StartTime is the time when the job started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time when the job finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Duration of the backup
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// Path is the location of the uploaded backup
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Size of the uploaded backup in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// Message describes why the backup failed
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// DeletedBackups are backups removed by the retention policy after this run
+	// +optional
+	DeletedBackups []string `json:"deletedBackups,omitempty"`
 }
 
 // MariaDBBackupStatus defines the observed state of MariaDBBackup
 type MariaDBBackupStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// LastPhase is the phase of the most recent backup run
+	// +optional
+	LastPhase BackupPhase `json:"lastPhase,omitempty"`
+
+	// LastSuccessTime is the completion time of the last successful backup
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+
+	// LastBackupPath is the location of the last successful backup
+	// +optional
+	LastBackupPath string `json:"lastBackupPath,omitempty"`
+
+	// LastBackupSize is the size in bytes of the last successful backup
+	// +optional
+	LastBackupSize int64 `json:"lastBackupSize,omitempty"`
+
+	// LastBackupDuration is the duration of the last successful backup
+	// +optional
+	LastBackupDuration *metav1.Duration `json:"lastBackupDuration,omitempty"`
+
+	// History contains recent backup runs, newest first
+	// +optional
+	History []MariaDBBackupRun `json:"history,omitempty"`
+
+	// BinlogArchive describes the state of the binary log archive
+	// +optional
+	BinlogArchive *BinlogArchiveStatus `json:"binlogArchive,omitempty"`
+}
+
+// BinlogArchiveStatus defines the observed state of the binary log archive
+type BinlogArchiveStatus struct {
+	// SourcePod is the Galera node the binary logs are archived from
+	// +optional
+	SourcePod string `json:"sourcePod,omitempty"`
+
+	// LastRunTime is the time when the last archiver run finished
+	// +optional
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+
+	// LastGTID is the last archived transaction
+	// +optional
+	LastGTID string `json:"lastGTID,omitempty"`
+
+	// LastEventTime is the time of the last archived transaction, the cluster can be recovered up to it
+	// +optional
+	LastEventTime *metav1.Time `json:"lastEventTime,omitempty"`
+
+	// Message describes why the last archiver run failed
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterRef.name"
+// +kubebuilder:printcolumn:name="LastPhase",type="string",JSONPath=".status.lastPhase",description="The phase of the last backup"
+// +kubebuilder:printcolumn:name="LastSuccess",type="date",JSONPath=".status.lastSuccessTime",description="The time of the last successful backup"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MariaDBBackup is the Schema for the mariadbbackups API
 type MariaDBBackup struct {
@@ -80,11 +248,64 @@ func (db *MariaDBBackup) GetClusterKey() client.ObjectKey {
 	}
 }
 
+// GetJobName returns name of the backup job or cronjob, jobs run in the cluster namespace
+func (db *MariaDBBackup) GetJobName() string {
+	return db.getJobName("backup")
+}
+
+// GetBinlogArchiveJobName returns name of the binlog archive job
+func (db *MariaDBBackup) GetBinlogArchiveJobName() string {
+	return db.getJobName("binlog")
+}
+
+func (db *MariaDBBackup) getJobName(prefix string) string {
+	// backups from other namespaces can have the same name
+	if db.GetClusterKey().Namespace != db.Namespace {
+		return fmt.Sprintf("%s-%s-%s", prefix, db.Namespace, db.Name)
+	}
+	return fmt.Sprintf("%s-%s", prefix, db.Name)
+}
+
+// GetArchivePrefix returns prefix of the archives created by the backup
+func (db *MariaDBBackup) GetArchivePrefix() string {
+	return fmt.Sprintf("%s-%s-", db.Spec.ClusterRef.Name, db.Name)
+}
+
+// GetBinlogURL returns location of the archived binary logs
+func (db *MariaDBBackup) GetBinlogURL() string {
+	return strings.TrimSuffix(db.Spec.BackupURL, "/") + "/binlog"
+}
+
+// GetBinlogArchiveInterval returns time between runs of the binary log archiver
+func (db *MariaDBBackup) GetBinlogArchiveInterval() time.Duration {
+	if db.Spec.BinlogArchive == nil || db.Spec.BinlogArchive.Interval == nil || db.Spec.BinlogArchive.Interval.Duration <= 0 {
+		return 5 * time.Minute
+	}
+	return db.Spec.BinlogArchive.Interval.Duration
+}
+
+// GetMethod returns backup method, logical when it isn't set
+func (db *MariaDBBackup) GetMethod() BackupMethod {
+	if db.Spec.Method == "" {
+		return BackupMethodLogical
+	}
+	return db.Spec.Method
+}
+
 func (db *MariaDBBackup) GetConfigHash() string {
 	h := sha256.New()
 	h.Write([]byte(db.Spec.CronExpression))
 	h.Write([]byte(db.Spec.BackupURL))
 	h.Write([]byte(db.Spec.BackupDBName))
+	if db.GetMethod() != BackupMethodLogical {
+		h.Write([]byte(db.GetMethod()))
+	}
+	if retention := db.Spec.Retention; retention != nil {
+		h.Write([]byte(fmt.Sprintf("%d/%d/%d/%d", retention.KeepLast, retention.KeepDaily, retention.KeepWeekly, retention.KeepMonthly)))
+		if retention.MaxAge != nil {
+			h.Write([]byte(retention.MaxAge.Duration.String()))
+		}
+	}
 	return hex.EncodeToString(h.Sum(nil))
 }
 
@@ -23,6 +23,11 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -38,13 +43,17 @@ type MariaDBClusterSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// PrimartCount number of master pods
+	// PrimartCount number of master pods. The operator adds and removes them one by one, waiting for the nodes
+	// to be synced between the steps. An even count is refused unless the arbitrator is enabled.
 	PrimaryCount int32 `json:"primaryCount,omitempty"`
 
 	// number of replica pods
 	ReplicaCount int32 `json:"replicaCount,omitempty"`
 
 	// secret reference for password
+	// The operator doesn't rotate the root password, it only sets it on the first start. To change it run ALTER USER
+	// for root on the cluster and update the secret afterwards, the operator uses the new password right away
+	// and pods read it on the next restart.
 	RootPassword corev1.SecretKeySelector `json:"rootPassword"`
 
 	// Image used for mariadb server
@@ -57,9 +66,15 @@ type MariaDBClusterSpec struct {
 	DataStorageSize string `json:"dataStorageSize"`
 
 	// A bucket URL that contains a xtrabackup to initialize the mysql database.
+	// It uses the same rclone remotes as backups (e.g. s3:bucket/path/backup.tar.gz),
+	// when it points to a directory the latest archive in it is used.
 	// +optional
 	InitBucketURL string `json:"initBucketURL,omitempty"`
 
+	// InitBucketSecretName the name of secret with credentials to the InitBucketURL remote
+	// +optional
+	InitBucketSecretName string `json:"initBucketSecretName,omitempty"`
+
 	// A map[string]string that will be passed to my.cnf file.
 	// +optional
 	MariaDBConf MariaDBConf `json:"MariaDBConf,omitempty"`
@@ -67,12 +82,113 @@ type MariaDBClusterSpec struct {
 	// ServiceConf represents config for k8s service
 	// +optional
 	ServiceConf ServiceConf `json:"service,omitempty"`
+
+	// TLS enables encryption of client connections and galera replication
+	// +optional
+	TLS *TLSConf `json:"tls,omitempty"`
+
+	// Recovery configures bootstrapping of the cluster after all galera nodes went down
+	// +optional
+	Recovery *GaleraRecoveryConf `json:"recovery,omitempty"`
+
+	// Arbitrator runs galera arbitrator (garbd) which votes in quorum without storing data
+	// +optional
+	Arbitrator *ArbitratorConf `json:"arbitrator,omitempty"`
+
+	// Upgrade configures the rollout of changes of the galera pods, e.g. a new image, done by the operator one pod at a time
+	// +optional
+	Upgrade *RollingUpgradeConf `json:"upgrade,omitempty"`
+}
+
+// RollingUpgradeConf defines how the operator restarts the galera pods with a new revision of the statefulset
+type RollingUpgradeConf struct {
+	// RejoinTimeoutSeconds is how long a restarted node has to rejoin the cluster before the upgrade is paused
+	// +kubebuilder:validation:Minimum=60
+	// +optional
+	RejoinTimeoutSeconds int32 `json:"rejoinTimeoutSeconds,omitempty"`
+}
+
+// ArbitratorConf defines the galera arbitrator of the cluster
+type ArbitratorConf struct {
+	// Enabled runs the arbitrator, it's required by clusters with an even number of primary nodes
+	Enabled bool `json:"enabled"`
+
+	// Resources of the arbitrator container
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// GaleraRecoveryConf defines the automatic recovery of the cluster which has no primary component
+type GaleraRecoveryConf struct {
+	// Disabled turns off the automatic recovery, the cluster has to be bootstrapped manually then
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// ClusterDownSeconds is how long no node has to be part of a primary component before the recovery starts
+	// +kubebuilder:validation:Minimum=60
+	// +optional
+	ClusterDownSeconds int32 `json:"clusterDownSeconds,omitempty"`
+}
+
+// TLSConf defines certificates used by the servers
+type TLSConf struct {
+	// Enabled turns on TLS for client connections and galera replication traffic.
+	// Turning it on or off on a running cluster restarts the galera nodes one at a time twice, first the nodes
+	// accept galera connections with and without TLS, then they use only the new setting.
+	// To turn TLS off set it to false and keep secretName, the certificate is used until the nodes are restarted.
+	Enabled bool `json:"enabled"`
+
+	// SecretName is the name of a secret with tls.crt, tls.key and ca.crt of the servers.
+	// The certificate has to be valid for the primary headless service name, the operator verifies it when it connects to pods.
+	// When it's empty the operator creates its own CA and issues the server certificate.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
 }
 
 // MariaDBConf defines type for extra cluster configs. It's a simple map between
 // string and string.
 type MariaDBConf map[string]intstr.IntOrString
 
+var mariaDBConfKeyRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Validate checks that every option can be written to my.cnf without changing other options or sections
+func (c MariaDBConf) Validate() error {
+	for key, value := range c {
+		if !mariaDBConfKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid option name %q", key)
+		}
+		if strings.ContainsAny(value.String(), "\r\n") {
+			return fmt.Errorf("option %s contains a line break", key)
+		}
+	}
+	return nil
+}
+
+// Options returns names of the options sorted alphabetically
+func (c MariaDBConf) Options() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Render returns the config as my.cnf fragment with options sorted by name, the config has to be validated first
+func (c MariaDBConf) Render() string {
+	keys := c.Options()
+
+	var b strings.Builder
+	b.WriteString("# Managed by mariadb-operator, generated from MariaDBCluster spec.MariaDBConf\n")
+	b.WriteString("[mysqld]\n")
+	for _, key := range keys {
+		value := c[key]
+		b.WriteString(fmt.Sprintf("%s = %s\n", key, value.String()))
+	}
+
+	return b.String()
+}
+
 // ServiceConf defines kubernetes service config
 type ServiceConf struct {
 	// Enabled flag indicated if service is enabled
@@ -88,15 +204,275 @@ type ServiceConf struct {
 	Type corev1.ServiceType `json:"type,omitempty"`
 }
 
+const (
+	// ClusterConditionReady is true when all primary nodes are synced and part of the primary component
+	ClusterConditionReady = "Ready"
+	// ClusterConditionSynced is true when every reachable node reports wsrep_local_state_comment=Synced
+	ClusterConditionSynced = "Synced"
+	// ClusterConditionQuorumLost is true when no node is part of a primary component
+	ClusterConditionQuorumLost = "QuorumLost"
+	// ClusterConditionProgressing is true while the operator is still rolling out changes
+	ClusterConditionProgressing = "Progressing"
+	// ClusterConditionScaling is true while the number of primary nodes differs from the spec
+	ClusterConditionScaling = "Scaling"
+	// ClusterConditionUpgradePaused is true when a restarted node didn't rejoin the cluster and the upgrade waits for the user
+	ClusterConditionUpgradePaused = "UpgradePaused"
+)
+
+// GaleraRecoveryPhase is the step of the recovery of the cluster without primary component
+// +kubebuilder:validation:Enum=ScalingDown;Recovering;Bootstrapping;Rejoining;Handover;Completed;Failed
+type GaleraRecoveryPhase string
+
+const (
+	// GaleraRecoveryScalingDown waits until all galera pods are stopped
+	GaleraRecoveryScalingDown GaleraRecoveryPhase = "ScalingDown"
+	// GaleraRecoveryRecovering reads the galera state of every node volume using jobs
+	GaleraRecoveryRecovering GaleraRecoveryPhase = "Recovering"
+	// GaleraRecoveryBootstrapping starts a new cluster from the node with the highest seqno
+	GaleraRecoveryBootstrapping GaleraRecoveryPhase = "Bootstrapping"
+	// GaleraRecoveryRejoining starts the pods preceding the bootstrap node, they join the new cluster.
+	// The first node has no preceding pods, the volume of the second one joins using a separate pod.
+	GaleraRecoveryRejoining GaleraRecoveryPhase = "Rejoining"
+	// GaleraRecoveryHandover starts the first statefulset pod once the cluster bootstrapped from its volume
+	// was left to the separate pod of the second node, the separate pod is stopped after the first one joined
+	GaleraRecoveryHandover GaleraRecoveryPhase = "Handover"
+	// GaleraRecoveryCompleted the bootstrap node handed over the cluster to the statefulset pods
+	GaleraRecoveryCompleted GaleraRecoveryPhase = "Completed"
+	// GaleraRecoveryFailed the recovery stopped, it's started again after ClusterDownSeconds
+	GaleraRecoveryFailed GaleraRecoveryPhase = "Failed"
+)
+
+// defaultClusterDownSeconds is how long the cluster is without primary component before it's recovered
+const defaultClusterDownSeconds = 300
+
+// RollingUpgradePhase is the state of the rollout of a new revision of the galera pods
+// +kubebuilder:validation:Enum=Updating;Paused;Completed
+type RollingUpgradePhase string
+
+const (
+	// RollingUpgradeUpdating restarts the outdated pods one at a time
+	RollingUpgradeUpdating RollingUpgradePhase = "Updating"
+	// RollingUpgradePaused a restarted node didn't rejoin the cluster, the upgrade waits to be resumed or rolled back
+	RollingUpgradePaused RollingUpgradePhase = "Paused"
+	// RollingUpgradeCompleted all pods run the current revision
+	RollingUpgradeCompleted RollingUpgradePhase = "Completed"
+)
+
+// TLSMode is TLS of the running servers
+// +kubebuilder:validation:Enum=Disabled;Dynamic;Enabled
+type TLSMode string
+
+const (
+	// TLSModeDisabled the servers don't use TLS
+	TLSModeDisabled TLSMode = "Disabled"
+	// TLSModeDynamic galera nodes accept connections with and without TLS while TLS is turned on or off
+	TLSModeDynamic TLSMode = "Dynamic"
+	// TLSModeEnabled the servers use only TLS for galera replication
+	TLSModeEnabled TLSMode = "Enabled"
+)
+
+// TLSCACertKey is the key of the CA certificate in the TLS secrets
+const TLSCACertKey = "ca.crt"
+
+// defaultRejoinTimeoutSeconds is how long a restarted node has to rejoin the cluster
+const defaultRejoinTimeoutSeconds = 600
+
+// MariaDBNodeStatus defines the observed galera state of a single server pod
+type MariaDBNodeStatus struct {
+	// Name of the pod
+	Name string `json:"name"`
+
+	// Ready is the value of wsrep_ready
+	Ready bool `json:"ready"`
+
+	// ClusterSize is the value of wsrep_cluster_size seen by the node
+	// +optional
+	ClusterSize int32 `json:"clusterSize,omitempty"`
+
+	// LocalState is the value of wsrep_local_state_comment (Synced, Donor/Desynced, Joining, ...)
+	// +optional
+	LocalState string `json:"localState,omitempty"`
+
+	// ClusterStatus is the value of wsrep_cluster_status (Primary, non-Primary, Disconnected)
+	// +optional
+	ClusterStatus string `json:"clusterStatus,omitempty"`
+
+	// Message contains the error if the node could not be queried
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// GaleraNodeState is the galera state read from the volume of a node
+type GaleraNodeState struct {
+	// Name of the pod the volume belongs to
+	Name string `json:"name"`
+
+	// UUID of the cluster the node was part of, empty when the volume has no galera state
+	// +optional
+	UUID string `json:"uuid,omitempty"`
+
+	// Seqno is the last transaction committed by the node
+	Seqno int64 `json:"seqno"`
+
+	// SafeToBootstrap is true when the node was the last one to leave the cluster
+	// +optional
+	SafeToBootstrap bool `json:"safeToBootstrap,omitempty"`
+}
+
+// GaleraRecoveryStatus records the decisions of the recovery of the cluster without primary component
+type GaleraRecoveryStatus struct {
+	// Phase is the current step of the recovery
+	Phase GaleraRecoveryPhase `json:"phase"`
+
+	// StartTime is when the recovery started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// FinishTime is when the recovery completed or failed
+	// +optional
+	FinishTime *metav1.Time `json:"finishTime,omitempty"`
+
+	// Nodes contains the galera state recovered from every node volume
+	// +optional
+	Nodes []GaleraNodeState `json:"nodes,omitempty"`
+
+	// BootstrapNode is the pod with the highest seqno the new cluster is bootstrapped from
+	// +optional
+	BootstrapNode string `json:"bootstrapNode,omitempty"`
+
+	// Message describes the current phase
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// RollingUpgradeStatus records the progress of the rollout of a new revision of the galera pods
+type RollingUpgradeStatus struct {
+	// Phase is the current state of the upgrade
+	Phase RollingUpgradePhase `json:"phase"`
+
+	// Revision of the statefulset the pods are updated to
+	// +optional
+	Revision string `json:"revision,omitempty"`
+
+	// FromImage is the image the pods ran before the upgrade, the upgrade is rolled back to it
+	// +optional
+	FromImage string `json:"fromImage,omitempty"`
+
+	// ToImage is the image the pods are updated to
+	// +optional
+	ToImage string `json:"toImage,omitempty"`
+
+	// FromVersion is the server version before the upgrade, mariadb-upgrade runs when the major version changes
+	// +optional
+	FromVersion string `json:"fromVersion,omitempty"`
+
+	// CurrentPod is the pod restarted in the current step
+	// +optional
+	CurrentPod string `json:"currentPod,omitempty"`
+
+	// StepStartTime is when the current pod was restarted
+	// +optional
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
+
+	// StartTime is when the upgrade started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// FinishTime is when the upgrade completed
+	// +optional
+	FinishTime *metav1.Time `json:"finishTime,omitempty"`
+
+	// Message describes the current step
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// MariaDBReplicaStatus defines the observed replication state of a single replica pod
+type MariaDBReplicaStatus struct {
+	// Name of the pod
+	Name string `json:"name"`
+
+	// IORunning is true when Slave_IO_Running is Yes
+	IORunning bool `json:"ioRunning"`
+
+	// SQLRunning is true when Slave_SQL_Running is Yes
+	SQLRunning bool `json:"sqlRunning"`
+
+	// SecondsBehindMaster is the replication lag, empty when the replication is not running
+	// +optional
+	SecondsBehindMaster *int64 `json:"secondsBehindMaster,omitempty"`
+
+	// GtidIOPos is the last GTID received from the primary
+	// +optional
+	GtidIOPos string `json:"gtidIOPos,omitempty"`
+
+	// Message contains the last replication error or the error if the replica could not be queried
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // MariaDBClusterStatus defines the observed state of MariaDBCluster
 type MariaDBClusterStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the most recent generation observed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represents the cluster conditions list
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ClusterSize is the biggest wsrep_cluster_size reported by a node in the primary component
+	// +optional
+	ClusterSize int32 `json:"clusterSize,omitempty"`
+
+	// SyncedNodes is the number of nodes in Synced state
+	// +optional
+	SyncedNodes int32 `json:"syncedNodes,omitempty"`
+
+	// Nodes contains the galera state of every primary pod
+	// +optional
+	Nodes []MariaDBNodeStatus `json:"nodes,omitempty"`
+
+	// Replicas contains the replication state of every replica pod
+	// +optional
+	Replicas []MariaDBReplicaStatus `json:"replicas,omitempty"`
+
+	// AppliedConfigHash is the hash of MariaDBConf applied to the running pods
+	// +optional
+	AppliedConfigHash string `json:"appliedConfigHash,omitempty"`
+
+	// AppliedConfigOptions are the names of the MariaDBConf options applied to the running pods,
+	// options removed from the spec are reset to their defaults
+	// +optional
+	AppliedConfigOptions []string `json:"appliedConfigOptions,omitempty"`
+
+	// RestartConfigHash is the hash of the last MariaDBConf which required a restart of the pods
+	// +optional
+	RestartConfigHash string `json:"restartConfigHash,omitempty"`
+
+	// TLSCertificateHash is the hash of the server certificate, the pods are restarted when it changes
+	// +optional
+	TLSCertificateHash string `json:"tlsCertificateHash,omitempty"`
+
+	// TLSMode is TLS the galera nodes were started with, it's Dynamic while spec.tls.enabled is rolled out
+	// +optional
+	TLSMode TLSMode `json:"tlsMode,omitempty"`
+
+	// Recovery records the last recovery of the cluster without primary component
+	// +optional
+	Recovery *GaleraRecoveryStatus `json:"recovery,omitempty"`
 
+	// Upgrade records the last rollout of a new revision of the galera pods
+	// +optional
+	Upgrade *RollingUpgradeStatus `json:"upgrade,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type == 'Ready')].status",description="The cluster status"
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".status.clusterSize",description="The galera cluster size"
+// +kubebuilder:printcolumn:name="Synced",type="integer",JSONPath=".status.syncedNodes",description="The number of synced nodes"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MariaDBCluster is the Schema for the MariaDBClusters API
 type MariaDBCluster struct {
@@ -120,7 +496,11 @@ func (c *MariaDBCluster) GetPrimaryHeadlessAddress() string {
 }
 
 func (c *MariaDBCluster) GetPrimaryHeadlessSvcName() string {
-	return fmt.Sprintf("mariadb-headless-%s-%s", c.Name, "primary")
+	return c.GetHeadlessSvcName("primary")
+}
+
+func (c *MariaDBCluster) GetHeadlessSvcName(dbType string) string {
+	return fmt.Sprintf("mariadb-headless-%s-%s", c.Name, dbType)
 }
 
 func (c *MariaDBCluster) GetOperatorSecretName() string {
@@ -135,11 +515,146 @@ func (c *MariaDBCluster) GetServiceAccountName() string {
 	return fmt.Sprintf("mariadb-%s", c.Name)
 }
 
+func (c *MariaDBCluster) GetConfigMapName() string {
+	return fmt.Sprintf("mariadb-%s-config", c.Name)
+}
+
 func (c *MariaDBCluster) GetConfigHash() string {
 	h := sha256.New()
 	h.Write([]byte(c.Spec.Image))
 	h.Write([]byte(c.Spec.DataStorageSize))
+	h.Write([]byte(fmt.Sprintf("%d", c.Spec.PrimaryCount)))
 	h.Write([]byte(fmt.Sprintf("%d", c.Spec.ReplicaCount)))
+	h.Write([]byte(c.GetMariaDBConfHash()))
+	if c.IsTLSEnabled() {
+		h.Write([]byte(c.GetTLSSecretName()))
+		h.Write([]byte(c.Status.TLSCertificateHash))
+		h.Write([]byte(c.Status.TLSMode))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// IsTLSEnabled returns true when the servers use TLS, when TLS is turned off they use it until all nodes restarted
+func (c *MariaDBCluster) IsTLSEnabled() bool {
+	return (c.Spec.TLS != nil && c.Spec.TLS.Enabled) || c.Status.TLSMode == TLSModeDynamic
+}
+
+// GetDesiredTLSMode returns TLS mode requested by the spec
+func (c *MariaDBCluster) GetDesiredTLSMode() TLSMode {
+	if c.Spec.TLS != nil && c.Spec.TLS.Enabled {
+		return TLSModeEnabled
+	}
+	return TLSModeDisabled
+}
+
+// IsTLSGenerated returns true when the server certificate is issued by the operator
+func (c *MariaDBCluster) IsTLSGenerated() bool {
+	return c.IsTLSEnabled() && (c.Spec.TLS == nil || c.Spec.TLS.SecretName == "")
+}
+
+// GetTLSSecretName returns name of the secret with the server certificate
+func (c *MariaDBCluster) GetTLSSecretName() string {
+	if c.Spec.TLS != nil && c.Spec.TLS.SecretName != "" {
+		return c.Spec.TLS.SecretName
+	}
+	return fmt.Sprintf("%s-tls", c.Name)
+}
+
+// GetCASecretName returns name of the secret with the CA generated by the operator
+func (c *MariaDBCluster) GetCASecretName() string {
+	return fmt.Sprintf("%s-ca", c.Name)
+}
+
+// HasArbitrator returns true when galera arbitrator runs next to the primary nodes
+func (c *MariaDBCluster) HasArbitrator() bool {
+	return c.Spec.Arbitrator != nil && c.Spec.Arbitrator.Enabled
+}
+
+// GetArbitratorName returns name of the deployment running galera arbitrator
+func (c *MariaDBCluster) GetArbitratorName() string {
+	return fmt.Sprintf("%s-arbitrator", c.Name)
+}
+
+// ValidatePrimaryCount checks the cluster keeps quorum when it splits in half,
+// an even number of nodes needs the arbitrator to have a majority on one side
+func (c *MariaDBCluster) ValidatePrimaryCount() error {
+	if c.Spec.PrimaryCount > 0 && c.Spec.PrimaryCount%2 == 0 && !c.HasArbitrator() {
+		return fmt.Errorf("primaryCount %d is even, use an odd number of nodes or enable the arbitrator", c.Spec.PrimaryCount)
+	}
+	return nil
+}
+
+// IsRecoveryEnabled returns true when the operator bootstraps the cluster which lost all primary components
+func (c *MariaDBCluster) IsRecoveryEnabled() bool {
+	return c.Spec.Recovery == nil || !c.Spec.Recovery.Disabled
+}
+
+// GetClusterDownTimeout returns how long the cluster has to be without primary component before it's recovered
+func (c *MariaDBCluster) GetClusterDownTimeout() time.Duration {
+	if c.Spec.Recovery != nil && c.Spec.Recovery.ClusterDownSeconds > 0 {
+		return time.Duration(c.Spec.Recovery.ClusterDownSeconds) * time.Second
+	}
+	return defaultClusterDownSeconds * time.Second
+}
+
+// GetRejoinTimeout returns how long a node restarted by the upgrade has to rejoin the cluster
+func (c *MariaDBCluster) GetRejoinTimeout() time.Duration {
+	if c.Spec.Upgrade != nil && c.Spec.Upgrade.RejoinTimeoutSeconds > 0 {
+		return time.Duration(c.Spec.Upgrade.RejoinTimeoutSeconds) * time.Second
+	}
+	return defaultRejoinTimeoutSeconds * time.Second
+}
+
+// IsUpgrading returns true while the galera pods are restarted with a new revision, also when the upgrade is paused
+func (c *MariaDBCluster) IsUpgrading() bool {
+	return c.Status.Upgrade != nil && c.Status.Upgrade.Phase != RollingUpgradeCompleted
+}
+
+// IsRecovering returns true while the galera pods are replaced by the recovery
+func (c *MariaDBCluster) IsRecovering() bool {
+	if c.Status.Recovery == nil {
+		return false
+	}
+	switch c.Status.Recovery.Phase {
+	case GaleraRecoveryScalingDown, GaleraRecoveryRecovering, GaleraRecoveryBootstrapping, GaleraRecoveryRejoining, GaleraRecoveryHandover:
+		return true
+	}
+	return false
+}
+
+// GetPrimaryReplicas returns the number of pods of the primary statefulset. While the cluster is recovered
+// the statefulset is stopped and then only the pods preceding the bootstrap node are started, or the first pod
+// during the handover when the cluster was bootstrapped from its volume.
+func (c *MariaDBCluster) GetPrimaryReplicas() int32 {
+	if !c.IsRecovering() {
+		return c.Spec.PrimaryCount
+	}
+	switch ordinal := PodOrdinal(c.Status.Recovery.BootstrapNode); {
+	case c.Status.Recovery.Phase == GaleraRecoveryRejoining && ordinal > 0:
+		return ordinal
+	case c.Status.Recovery.Phase == GaleraRecoveryHandover:
+		return 1
+	}
+	return 0
+}
+
+// PodOrdinal returns the ordinal of the statefulset pod, -1 if the name has no ordinal
+func PodOrdinal(name string) int32 {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return -1
+	}
+	ordinal, err := strconv.ParseInt(name[i+1:], 10, 32)
+	if err != nil {
+		return -1
+	}
+	return int32(ordinal)
+}
+
+// GetMariaDBConfHash returns hash of the rendered my.cnf fragment
+func (c *MariaDBCluster) GetMariaDBConfHash() string {
+	h := sha256.New()
+	h.Write([]byte(c.Spec.MariaDBConf.Render()))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
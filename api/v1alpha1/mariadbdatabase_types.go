@@ -42,16 +42,37 @@ type MariaDBDatabaseSpec struct {
 
 	// Collation represents the collation name used as default database collation
 	Collation string `json:"collation,omitempty"`
+
+	// DeletionPolicy defines if the database is dropped when the resource is deleted, Retain is used when it's not set.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
 }
 
 // MariaDBDatabaseStatus defines the observed state of MariaDBDatabase
 type MariaDBDatabaseStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// CharacterSet is the default charset of the database reported by the server
+	// +optional
+	CharacterSet string `json:"characterSet,omitempty"`
+
+	// Collation is the default collation of the database reported by the server
+	// +optional
+	Collation string `json:"collation,omitempty"`
+
+	// Tables is the number of tables in the database
+	// +optional
+	Tables int32 `json:"tables,omitempty"`
+
+	// SizeBytes is the size of data and indexes of the tables in the database
+	// +optional
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Database",type="string",JSONPath=".spec.database"
+// +kubebuilder:printcolumn:name="Collation",type="string",JSONPath=".status.collation"
+// +kubebuilder:printcolumn:name="Tables",type="integer",JSONPath=".status.tables"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MariaDBDatabase is the Schema for the mariadbdatabases API
 type MariaDBDatabase struct {
@@ -75,6 +96,15 @@ func (db *MariaDBDatabase) GetClusterKey() client.ObjectKey {
 	}
 }
 
+// GetDeletionPolicy returns the deletion policy of the database, the database is retained by default
+func (db *MariaDBDatabase) GetDeletionPolicy() DeletionPolicy {
+	if db.Spec.DeletionPolicy == "" {
+		return DeletionPolicyRetain
+	}
+
+	return db.Spec.DeletionPolicy
+}
+
 //+kubebuilder:object:root=true
 
 // MariaDBDatabaseList contains a list of MariaDBDatabase
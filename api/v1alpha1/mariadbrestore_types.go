@@ -0,0 +1,152 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RestorePhase describes the state of the restore
+type RestorePhase string
+
+const (
+	// RestorePhasePending restore is waiting for the cluster to be ready
+	RestorePhasePending RestorePhase = "Pending"
+	// RestorePhaseRunning restore job is running
+	RestorePhaseRunning RestorePhase = "Running"
+	// RestorePhaseSucceeded restore job finished successfully
+	RestorePhaseSucceeded RestorePhase = "Succeeded"
+	// RestorePhaseFailed restore job failed or the restore is invalid
+	RestorePhaseFailed RestorePhase = "Failed"
+)
+
+// MariaDBRestoreSpec defines the desired state of MariaDBRestore
+type MariaDBRestoreSpec struct {
+	// ClusterRef represents a reference to the MySQL cluster.
+	// This field should be immutable.
+	ClusterRef ClusterReference `json:"clusterRef"`
+
+	// BackupRef is a reference to MariaDBBackup in the same namespace, the latest backup is restored
+	// +optional
+	BackupRef *corev1.LocalObjectReference `json:"backupRef,omitempty"`
+
+	// BackupURL represents the URL to the backup, it's used when BackupRef is not set.
+	// When it points to a directory the latest backup in it is restored.
+	// +optional
+	BackupURL string `json:"backupURL,omitempty"`
+
+	// BackupSecretName the name of secrets that contains the credentials to BackupURL
+	// +optional
+	BackupSecretName string `json:"backupSecretName,omitempty"`
+
+	// DBName the name of db to restore the backup into, works only with backups of single db
+	// +optional
+	DBName string `json:"dbName,omitempty"`
+
+	// PointInTime replays binary logs archived next to the backup up to the target,
+	// the latest backup taken before the target is used
+	// +optional
+	PointInTime *PointInTimeTarget `json:"pointInTime,omitempty"`
+}
+
+// PointInTimeTarget is the point the cluster is recovered to, exactly one of the fields has to be set
+type PointInTimeTarget struct {
+	// Time transactions committed after it are not replayed
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+
+	// GTID of the last replayed transaction (Ex. 1-1-1234)
+	// +kubebuilder:validation:Pattern=`^[0-9]+-[0-9]+-[0-9]+$`
+	// +optional
+	GTID string `json:"gtid,omitempty"`
+}
+
+// MariaDBRestoreStatus defines the observed state of MariaDBRestore
+type MariaDBRestoreStatus struct {
+	// Phase of the restore
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+
+	// StartTime is the time when the restore job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time when the restore job finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Error describes why the restore failed or is waiting
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="The restore phase"
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterRef.name"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// MariaDBRestore is the Schema for the mariadbrestores API
+type MariaDBRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MariaDBRestoreSpec   `json:"spec,omitempty"`
+	Status MariaDBRestoreStatus `json:"status,omitempty"`
+}
+
+func (r *MariaDBRestore) GetClusterKey() client.ObjectKey {
+	ns := r.Spec.ClusterRef.Namespace
+	if ns == "" {
+		ns = r.Namespace
+	}
+
+	return client.ObjectKey{
+		Name:      r.Spec.ClusterRef.Name,
+		Namespace: ns,
+	}
+}
+
+// GetJobName returns name of the restore job, jobs run in the cluster namespace
+func (r *MariaDBRestore) GetJobName() string {
+	// restores from other namespaces can have the same name
+	if r.GetClusterKey().Namespace != r.Namespace {
+		return fmt.Sprintf("restore-%s-%s", r.Namespace, r.Name)
+	}
+	return fmt.Sprintf("restore-%s", r.Name)
+}
+
+// IsFinished returns true if the restore is in a terminal phase
+func (r *MariaDBRestore) IsFinished() bool {
+	return r.Status.Phase == RestorePhaseSucceeded || r.Status.Phase == RestorePhaseFailed
+}
+
+//+kubebuilder:object:root=true
+
+// MariaDBRestoreList contains a list of MariaDBRestore
+type MariaDBRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MariaDBRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MariaDBRestore{}, &MariaDBRestoreList{})
+}
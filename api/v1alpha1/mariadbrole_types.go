@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// MariaDBRoleSpec defines the desired state of MariaDBRole
+type MariaDBRoleSpec struct {
+	// ClusterRef represents a reference to the MySQL cluster.
+	// This field should be immutable.
+	ClusterRef ClusterReference `json:"clusterRef"`
+
+	// Role is the name of the role created in the database, users get it through spec.roles.
+	// This field should be immutable.
+	Role string `json:"role"`
+
+	// Permissions is the list of permissions the role has.
+	// +optional
+	Permissions []MariaDBPermission `json:"permissions,omitempty"`
+}
+
+// MariaDBRoleStatus defines the observed state of MariaDBRole
+type MariaDBRoleStatus struct {
+	// Conditions represents the MariaDBRole resource conditions list.
+	// +optional
+	Condition MariaDBUserCondition `json:"conditions,omitempty"`
+
+	// Permissions the role has as reported by the server.
+	// +optional
+	Permissions []MariaDBPermission `json:"permissions,omitempty"`
+}
+
+// MariaDBRole is the Schema for the mariadbroles API
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions.status",description="The role status"
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterRef.name"
+// +kubebuilder:printcolumn:name="Role",type="string",JSONPath=".spec.role"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type MariaDBRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MariaDBRoleSpec   `json:"spec,omitempty"`
+	Status MariaDBRoleStatus `json:"status,omitempty"`
+}
+
+// GetClusterKey is a helper function that returns the mariadb cluster object key
+func (r *MariaDBRole) GetClusterKey() client.ObjectKey {
+	ns := r.Spec.ClusterRef.Namespace
+	if ns == "" {
+		ns = r.Namespace
+	}
+
+	return client.ObjectKey{
+		Name:      r.Spec.ClusterRef.Name,
+		Namespace: ns,
+	}
+}
+
+func (r *MariaDBRole) UpdateStatusCondition(status MariaDBStatusType, reason string, message string) {
+	r.Status.Condition.Status = status
+	r.Status.Condition.LastUpdateTime = metav1.NewTime(time.Now())
+	r.Status.Condition.Reason = reason
+	r.Status.Condition.Message = message
+}
+
+//+kubebuilder:object:root=true
+
+// MariaDBRoleList contains a list of MariaDBRole
+type MariaDBRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MariaDBRole `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MariaDBRole{}, &MariaDBRoleList{})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -37,7 +38,9 @@ type MariaDBUserSpec struct {
 	User string `json:"user"`
 
 	// Password is the password for the user.
-	Password corev1.SecretKeySelector `json:"password"`
+	// When it's not set the operator generates a password and stores it in a secret named <name>-password.
+	// +optional
+	Password *corev1.SecretKeySelector `json:"password,omitempty"`
 
 	// AllowedHosts is the allowed host to connect from.
 	AllowedHosts []string `json:"allowedHosts"`
@@ -45,39 +48,151 @@ type MariaDBUserSpec struct {
 	// Permissions is the list of roles that user has in the specified database.
 	Permissions []MariaDBPermission `json:"permissions,omitempty"`
 
+	// Authentication selects the authentication plugin and allows using a pre-hashed password.
+	// +optional
+	Authentication *MariaDBUserAuthentication `json:"authentication,omitempty"`
+
+	// Require are the TLS requirements of the user's connections, no requirements are set when it's empty.
+	// +optional
+	Require *MariaDBUserTLSRequirement `json:"require,omitempty"`
+
+	// Roles is the list of database roles granted to the user, see MariaDBRole.
+	// +optional
+	Roles []string `json:"roles,omitempty"`
+
+	// DefaultRole is the role enabled when the user connects, it has to be one of roles.
+	// +optional
+	DefaultRole string `json:"defaultRole,omitempty"`
+
 	// ResourceLimits allow settings limit per mysql user as defined here:
 	// https://mariadb.com/kb/en/create-user/
 	// +optional
 	ResourceLimits MariaDBUserLimits `json:"limits,omitempty"`
+
+	// DeletionPolicy defines if the user is dropped when the resource is deleted, Delete is used when it's not set.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Suspended locks the account without removing it, the user keeps its grants but can't log in.
+	// Connections opened before the account was locked are not closed.
+	// +optional
+	Suspended bool `json:"suspended,omitempty"`
+
+	// PasswordExpireIntervalDays is the number of days after which the password has to be changed,
+	// 0 means the password never expires. When it's not set the server default_password_lifetime is used.
+	// The number of failed logins before the account is blocked is server wide, it can be set with
+	// max_password_errors in MariaDBConf of the cluster.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	PasswordExpireIntervalDays *int32 `json:"passwordExpireIntervalDays,omitempty"`
+
+	// PasswordRotation makes the operator replace the password periodically,
+	// the rotation can be also requested by setting the mariadb/rotate-password annotation.
+	// +optional
+	PasswordRotation *PasswordRotation `json:"passwordRotation,omitempty"`
+
+	// ConnectionSecret is a secret with everything an application needs to connect as the user,
+	// it's created and kept up to date by the operator.
+	// +optional
+	ConnectionSecret *MariaDBUserConnectionSecret `json:"connectionSecret,omitempty"`
 }
 
-type MariaDBUserLimits struct {
-	MaxQueriesPerHour     int `json:"MAX_QUERIES_PER_HOUR"`
-	MaxUpdatePerHour      int `json:"MAX_UPDATES_PER_HOUR"`
-	MaxConnectionsPerHour int `json:"MAX_CONNECTIONS_PER_HOUR"`
-	MaxUserConnections    int `json:"MAX_USER_CONNECTIONS"`
-	MaxStatementTime      int `json:"MAX_STATEMENT_TIME"`
+// AuthPlugin is the plugin used to authenticate the user
+// +kubebuilder:validation:Enum=mysql_native_password;ed25519;unix_socket;gssapi
+type AuthPlugin string
+
+const (
+	AuthPluginNativePassword AuthPlugin = "mysql_native_password"
+	AuthPluginED25519        AuthPlugin = "ed25519"
+	AuthPluginUnixSocket     AuthPlugin = "unix_socket"
+	AuthPluginGSSAPI         AuthPlugin = "gssapi"
+)
+
+// MariaDBUserAuthentication defines how the user authenticates
+type MariaDBUserAuthentication struct {
+	// Plugin used to authenticate the user, mysql_native_password is used when it's not set.
+	// unix_socket and gssapi don't use the password.
+	// +optional
+	Plugin AuthPlugin `json:"plugin,omitempty"`
+
+	// PasswordHash references the hashed password which is used instead of spec.password.
+	// For mysql_native_password it's the value returned by PASSWORD(), for ed25519 by ED25519_PASSWORD().
+	// +optional
+	PasswordHash *corev1.SecretKeySelector `json:"passwordHash,omitempty"`
+
+	// Principal is the Kerberos principal of gssapi plugin, the user name is used when it's not set.
+	// The servers read their keytab from /etc/krb5.keytab or the gssapi_keytab_path set in MariaDBConf,
+	// it has to be added to the image.
+	// +optional
+	Principal string `json:"principal,omitempty"`
 }
 
-func (l MariaDBUserLimits) Get() map[string]int {
-	result := make(map[string]int)
-	if l.MaxConnectionsPerHour != 0 {
-		result["MAX_CONNECTIONS_PER_HOUR"] = l.MaxConnectionsPerHour
-	}
+// MariaDBUserTLSRequirement defines REQUIRE options of the user, the most specific one set is used
+type MariaDBUserTLSRequirement struct {
+	// SSL requires encrypted connection
+	// +optional
+	SSL bool `json:"ssl,omitempty"`
+	// X509 requires a valid client certificate
+	// +optional
+	X509 bool `json:"x509,omitempty"`
+	// Subject requires a client certificate with the subject
+	// +optional
+	Subject string `json:"subject,omitempty"`
+	// Issuer requires a client certificate issued by the issuer
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+	// Cipher requires the connection to use the cipher
+	// +optional
+	Cipher string `json:"cipher,omitempty"`
+}
 
-	if l.MaxQueriesPerHour != 0 {
-		result["MAX_QUERIES_PER_HOUR"] = l.MaxQueriesPerHour
-	}
+// PasswordRotation defines how the password of the user is rotated
+type PasswordRotation struct {
+	// Interval between rotations, the password is rotated only on demand when it's not set
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
 
-	if l.MaxUpdatePerHour != 0 {
-		result["MAX_UPDATES_PER_HOUR"] = l.MaxUpdatePerHour
-	}
+	// DualUser creates two users <user>_a and <user>_b, every rotation changes the password of the user
+	// which is not in use and makes it the active one. The previous credentials keep working until the
+	// next rotation so applications can roll without downtime. Switching it drops users of the other scheme.
+	// +optional
+	DualUser bool `json:"dualUser,omitempty"`
+}
 
-	if l.MaxUserConnections != 0 {
-		result["MAX_USER_CONNECTIONS"] = l.MaxUserConnections
-	}
+// MariaDBUserConnectionSecret describes the secret with connection details of the user.
+// The secret contains keys host, port, user, password, database, dsn, uri and jdbcUrl.
+type MariaDBUserConnectionSecret struct {
+	// Name of the secret
+	Name string `json:"name"`
+	// Database used in the connection strings
+	// +optional
+	Database string `json:"database,omitempty"`
+}
 
-	return result
+// MariaDBUserLimits are the resource options of the user, zero means no limit
+type MariaDBUserLimits struct {
+	// +optional
+	MaxQueriesPerHour int `json:"MAX_QUERIES_PER_HOUR,omitempty"`
+	// +optional
+	MaxUpdatePerHour int `json:"MAX_UPDATES_PER_HOUR,omitempty"`
+	// +optional
+	MaxConnectionsPerHour int `json:"MAX_CONNECTIONS_PER_HOUR,omitempty"`
+	// +optional
+	MaxUserConnections int `json:"MAX_USER_CONNECTIONS,omitempty"`
+	// MaxStatementTime is the timeout of a query in seconds
+	// +optional
+	MaxStatementTime int `json:"MAX_STATEMENT_TIME,omitempty"`
+}
+
+// Get returns all resource options including the ones which are not set, so removing a limit resets it
+func (l MariaDBUserLimits) Get() map[string]int {
+	return map[string]int{
+		"MAX_CONNECTIONS_PER_HOUR": l.MaxConnectionsPerHour,
+		"MAX_QUERIES_PER_HOUR":     l.MaxQueriesPerHour,
+		"MAX_UPDATES_PER_HOUR":     l.MaxUpdatePerHour,
+		"MAX_USER_CONNECTIONS":     l.MaxUserConnections,
+		"MAX_STATEMENT_TIME":       l.MaxStatementTime,
+	}
 }
 
 // MariaDBPermission defines a MariaDB schema permission
@@ -108,6 +223,36 @@ type MariaDBUserStatus struct {
 
 	// AllowedHosts contains the list of hosts that the user is allowed to connect from.
 	AllowedHosts []string `json:"allowedHosts,omitempty"`
+
+	// ActiveUser is the name of the user applications should connect as, it differs from spec.user in dual user scheme.
+	// +optional
+	ActiveUser string `json:"activeUser,omitempty"`
+
+	// LastRotationTime is the time the password was last rotated.
+	// +optional
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+
+	// Grants contains the permissions the user has on each allowed host as reported by the server.
+	// +optional
+	Grants []MariaDBUserGrants `json:"grants,omitempty"`
+}
+
+// MariaDBUserGrants are the effective permissions of the user connecting from the host
+type MariaDBUserGrants struct {
+	// Host is the allowed host of the user
+	Host string `json:"host"`
+	// Permissions granted to user@host
+	// +optional
+	Permissions []MariaDBPermission `json:"permissions,omitempty"`
+	// Roles granted to user@host
+	// +optional
+	Roles []string `json:"roles,omitempty"`
+	// DefaultRole of user@host
+	// +optional
+	DefaultRole string `json:"defaultRole,omitempty"`
+	// Limits are the resource limits of user@host
+	// +optional
+	Limits *MariaDBUserLimits `json:"limits,omitempty"`
 }
 
 // MariaDBUser is the Schema for the mariadbusers API
@@ -138,6 +283,58 @@ func (u *MariaDBUser) GetClusterKey() client.ObjectKey {
 	}
 }
 
+// GetPasswordSecretKey returns the key of the user's password, generated password is used when none is set
+func (u *MariaDBUser) GetPasswordSecretKey() corev1.SecretKeySelector {
+	if u.Spec.Password != nil {
+		return *u.Spec.Password
+	}
+
+	return corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{
+			Name: u.GetGeneratedPasswordSecretName(),
+		},
+		Key: "password",
+	}
+}
+
+// GetGeneratedPasswordSecretName returns name of the secret with password generated by the operator
+func (u *MariaDBUser) GetGeneratedPasswordSecretName() string {
+	return fmt.Sprintf("%s-password", u.Name)
+}
+
+// GetDeletionPolicy returns the deletion policy of the user, the user is dropped by default
+func (u *MariaDBUser) GetDeletionPolicy() DeletionPolicy {
+	if u.Spec.DeletionPolicy == "" {
+		return DeletionPolicyDelete
+	}
+
+	return u.Spec.DeletionPolicy
+}
+
+// GetAuthPlugin returns the authentication plugin of the user
+func (u *MariaDBUser) GetAuthPlugin() AuthPlugin {
+	if u.Spec.Authentication == nil || u.Spec.Authentication.Plugin == "" {
+		return AuthPluginNativePassword
+	}
+
+	return u.Spec.Authentication.Plugin
+}
+
+// UsesPassword returns false for users authenticated without a password
+func (u *MariaDBUser) UsesPassword() bool {
+	plugin := u.GetAuthPlugin()
+	return plugin != AuthPluginUnixSocket && plugin != AuthPluginGSSAPI
+}
+
+// GetUsernames returns names of the database users managed for the MariaDBUser
+func (u *MariaDBUser) GetUsernames() []string {
+	if u.Spec.PasswordRotation != nil && u.Spec.PasswordRotation.DualUser {
+		return []string{u.Spec.User + "_a", u.Spec.User + "_b"}
+	}
+
+	return []string{u.Spec.User}
+}
+
 func (u *MariaDBUser) UpdateStatusCondition(status MariaDBStatusType, reason string, message string) {
 	u.Status.Condition.Status = status
 	u.Status.Condition.LastUpdateTime = metav1.NewTime(time.Now())
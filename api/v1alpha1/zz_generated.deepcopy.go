@@ -21,9 +21,90 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArbitratorConf) DeepCopyInto(out *ArbitratorConf) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArbitratorConf.
+func (in *ArbitratorConf) DeepCopy() *ArbitratorConf {
+	if in == nil {
+		return nil
+	}
+	out := new(ArbitratorConf)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupRetention) DeepCopyInto(out *BackupRetention) {
+	*out = *in
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupRetention.
+func (in *BackupRetention) DeepCopy() *BackupRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BinlogArchiveSpec) DeepCopyInto(out *BinlogArchiveSpec) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BinlogArchiveSpec.
+func (in *BinlogArchiveSpec) DeepCopy() *BinlogArchiveSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BinlogArchiveSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BinlogArchiveStatus) DeepCopyInto(out *BinlogArchiveStatus) {
+	*out = *in
+	if in.LastRunTime != nil {
+		in, out := &in.LastRunTime, &out.LastRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastEventTime != nil {
+		in, out := &in.LastEventTime, &out.LastEventTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BinlogArchiveStatus.
+func (in *BinlogArchiveStatus) DeepCopy() *BinlogArchiveStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BinlogArchiveStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterReference) DeepCopyInto(out *ClusterReference) {
 	*out = *in
@@ -40,13 +121,71 @@ func (in *ClusterReference) DeepCopy() *ClusterReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GaleraNodeState) DeepCopyInto(out *GaleraNodeState) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GaleraNodeState.
+func (in *GaleraNodeState) DeepCopy() *GaleraNodeState {
+	if in == nil {
+		return nil
+	}
+	out := new(GaleraNodeState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GaleraRecoveryConf) DeepCopyInto(out *GaleraRecoveryConf) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GaleraRecoveryConf.
+func (in *GaleraRecoveryConf) DeepCopy() *GaleraRecoveryConf {
+	if in == nil {
+		return nil
+	}
+	out := new(GaleraRecoveryConf)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GaleraRecoveryStatus) DeepCopyInto(out *GaleraRecoveryStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.FinishTime != nil {
+		in, out := &in.FinishTime, &out.FinishTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]GaleraNodeState, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GaleraRecoveryStatus.
+func (in *GaleraRecoveryStatus) DeepCopy() *GaleraRecoveryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GaleraRecoveryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBBackup) DeepCopyInto(out *MariaDBBackup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBBackup.
@@ -99,10 +238,53 @@ func (in *MariaDBBackupList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBBackupRun) DeepCopyInto(out *MariaDBBackupRun) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.DeletedBackups != nil {
+		in, out := &in.DeletedBackups, &out.DeletedBackups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBBackupRun.
+func (in *MariaDBBackupRun) DeepCopy() *MariaDBBackupRun {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBBackupRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBBackupSpec) DeepCopyInto(out *MariaDBBackupSpec) {
 	*out = *in
 	out.ClusterRef = in.ClusterRef
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(BackupRetention)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BinlogArchive != nil {
+		in, out := &in.BinlogArchive, &out.BinlogArchive
+		*out = new(BinlogArchiveSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBBackupSpec.
@@ -118,6 +300,27 @@ func (in *MariaDBBackupSpec) DeepCopy() *MariaDBBackupSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBBackupStatus) DeepCopyInto(out *MariaDBBackupStatus) {
 	*out = *in
+	if in.LastSuccessTime != nil {
+		in, out := &in.LastSuccessTime, &out.LastSuccessTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastBackupDuration != nil {
+		in, out := &in.LastBackupDuration, &out.LastBackupDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]MariaDBBackupRun, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BinlogArchive != nil {
+		in, out := &in.BinlogArchive, &out.BinlogArchive
+		*out = new(BinlogArchiveStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBBackupStatus.
@@ -136,7 +339,7 @@ func (in *MariaDBCluster) DeepCopyInto(out *MariaDBCluster) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBCluster.
@@ -201,6 +404,26 @@ func (in *MariaDBClusterSpec) DeepCopyInto(out *MariaDBClusterSpec) {
 		}
 	}
 	in.ServiceConf.DeepCopyInto(&out.ServiceConf)
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConf)
+		**out = **in
+	}
+	if in.Recovery != nil {
+		in, out := &in.Recovery, &out.Recovery
+		*out = new(GaleraRecoveryConf)
+		**out = **in
+	}
+	if in.Arbitrator != nil {
+		in, out := &in.Arbitrator, &out.Arbitrator
+		*out = new(ArbitratorConf)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(RollingUpgradeConf)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBClusterSpec.
@@ -216,6 +439,40 @@ func (in *MariaDBClusterSpec) DeepCopy() *MariaDBClusterSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBClusterStatus) DeepCopyInto(out *MariaDBClusterStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]MariaDBNodeStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = make([]MariaDBReplicaStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AppliedConfigOptions != nil {
+		in, out := &in.AppliedConfigOptions, &out.AppliedConfigOptions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Recovery != nil {
+		in, out := &in.Recovery, &out.Recovery
+		*out = new(GaleraRecoveryStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(RollingUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBClusterStatus.
@@ -339,6 +596,21 @@ func (in *MariaDBDatabaseStatus) DeepCopy() *MariaDBDatabaseStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBNodeStatus) DeepCopyInto(out *MariaDBNodeStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBNodeStatus.
+func (in *MariaDBNodeStatus) DeepCopy() *MariaDBNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBPermission) DeepCopyInto(out *MariaDBPermission) {
 	*out = *in
@@ -364,6 +636,239 @@ func (in *MariaDBPermission) DeepCopy() *MariaDBPermission {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBReplicaStatus) DeepCopyInto(out *MariaDBReplicaStatus) {
+	*out = *in
+	if in.SecondsBehindMaster != nil {
+		in, out := &in.SecondsBehindMaster, &out.SecondsBehindMaster
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBReplicaStatus.
+func (in *MariaDBReplicaStatus) DeepCopy() *MariaDBReplicaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBReplicaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRestore) DeepCopyInto(out *MariaDBRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRestore.
+func (in *MariaDBRestore) DeepCopy() *MariaDBRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MariaDBRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRestoreList) DeepCopyInto(out *MariaDBRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MariaDBRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRestoreList.
+func (in *MariaDBRestoreList) DeepCopy() *MariaDBRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MariaDBRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRestoreSpec) DeepCopyInto(out *MariaDBRestoreSpec) {
+	*out = *in
+	out.ClusterRef = in.ClusterRef
+	if in.BackupRef != nil {
+		in, out := &in.BackupRef, &out.BackupRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.PointInTime != nil {
+		in, out := &in.PointInTime, &out.PointInTime
+		*out = new(PointInTimeTarget)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRestoreSpec.
+func (in *MariaDBRestoreSpec) DeepCopy() *MariaDBRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRestoreStatus) DeepCopyInto(out *MariaDBRestoreStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRestoreStatus.
+func (in *MariaDBRestoreStatus) DeepCopy() *MariaDBRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRole) DeepCopyInto(out *MariaDBRole) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRole.
+func (in *MariaDBRole) DeepCopy() *MariaDBRole {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRole)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MariaDBRole) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRoleList) DeepCopyInto(out *MariaDBRoleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MariaDBRole, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRoleList.
+func (in *MariaDBRoleList) DeepCopy() *MariaDBRoleList {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRoleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MariaDBRoleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRoleSpec) DeepCopyInto(out *MariaDBRoleSpec) {
+	*out = *in
+	out.ClusterRef = in.ClusterRef
+	if in.Permissions != nil {
+		in, out := &in.Permissions, &out.Permissions
+		*out = make([]MariaDBPermission, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRoleSpec.
+func (in *MariaDBRoleSpec) DeepCopy() *MariaDBRoleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRoleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRoleStatus) DeepCopyInto(out *MariaDBRoleStatus) {
+	*out = *in
+	in.Condition.DeepCopyInto(&out.Condition)
+	if in.Permissions != nil {
+		in, out := &in.Permissions, &out.Permissions
+		*out = make([]MariaDBPermission, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRoleStatus.
+func (in *MariaDBRoleStatus) DeepCopy() *MariaDBRoleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRoleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBUser) DeepCopyInto(out *MariaDBUser) {
 	*out = *in
@@ -391,6 +896,26 @@ func (in *MariaDBUser) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBUserAuthentication) DeepCopyInto(out *MariaDBUserAuthentication) {
+	*out = *in
+	if in.PasswordHash != nil {
+		in, out := &in.PasswordHash, &out.PasswordHash
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBUserAuthentication.
+func (in *MariaDBUserAuthentication) DeepCopy() *MariaDBUserAuthentication {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBUserAuthentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBUserCondition) DeepCopyInto(out *MariaDBUserCondition) {
 	*out = *in
@@ -407,6 +932,53 @@ func (in *MariaDBUserCondition) DeepCopy() *MariaDBUserCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBUserConnectionSecret) DeepCopyInto(out *MariaDBUserConnectionSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBUserConnectionSecret.
+func (in *MariaDBUserConnectionSecret) DeepCopy() *MariaDBUserConnectionSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBUserConnectionSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBUserGrants) DeepCopyInto(out *MariaDBUserGrants) {
+	*out = *in
+	if in.Permissions != nil {
+		in, out := &in.Permissions, &out.Permissions
+		*out = make([]MariaDBPermission, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(MariaDBUserLimits)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBUserGrants.
+func (in *MariaDBUserGrants) DeepCopy() *MariaDBUserGrants {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBUserGrants)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MariaDBUserLimits) DeepCopyInto(out *MariaDBUserLimits) {
 	*out = *in
@@ -458,7 +1030,11 @@ func (in *MariaDBUserList) DeepCopyObject() runtime.Object {
 func (in *MariaDBUserSpec) DeepCopyInto(out *MariaDBUserSpec) {
 	*out = *in
 	out.ClusterRef = in.ClusterRef
-	in.Password.DeepCopyInto(&out.Password)
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.AllowedHosts != nil {
 		in, out := &in.AllowedHosts, &out.AllowedHosts
 		*out = make([]string, len(*in))
@@ -471,7 +1047,37 @@ func (in *MariaDBUserSpec) DeepCopyInto(out *MariaDBUserSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Authentication != nil {
+		in, out := &in.Authentication, &out.Authentication
+		*out = new(MariaDBUserAuthentication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Require != nil {
+		in, out := &in.Require, &out.Require
+		*out = new(MariaDBUserTLSRequirement)
+		**out = **in
+	}
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	out.ResourceLimits = in.ResourceLimits
+	if in.PasswordExpireIntervalDays != nil {
+		in, out := &in.PasswordExpireIntervalDays, &out.PasswordExpireIntervalDays
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PasswordRotation != nil {
+		in, out := &in.PasswordRotation, &out.PasswordRotation
+		*out = new(PasswordRotation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConnectionSecret != nil {
+		in, out := &in.ConnectionSecret, &out.ConnectionSecret
+		*out = new(MariaDBUserConnectionSecret)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBUserSpec.
@@ -493,6 +1099,17 @@ func (in *MariaDBUserStatus) DeepCopyInto(out *MariaDBUserStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Grants != nil {
+		in, out := &in.Grants, &out.Grants
+		*out = make([]MariaDBUserGrants, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBUserStatus.
@@ -505,6 +1122,102 @@ func (in *MariaDBUserStatus) DeepCopy() *MariaDBUserStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBUserTLSRequirement) DeepCopyInto(out *MariaDBUserTLSRequirement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBUserTLSRequirement.
+func (in *MariaDBUserTLSRequirement) DeepCopy() *MariaDBUserTLSRequirement {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBUserTLSRequirement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordRotation) DeepCopyInto(out *PasswordRotation) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordRotation.
+func (in *PasswordRotation) DeepCopy() *PasswordRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PointInTimeTarget) DeepCopyInto(out *PointInTimeTarget) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PointInTimeTarget.
+func (in *PointInTimeTarget) DeepCopy() *PointInTimeTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(PointInTimeTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollingUpgradeConf) DeepCopyInto(out *RollingUpgradeConf) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollingUpgradeConf.
+func (in *RollingUpgradeConf) DeepCopy() *RollingUpgradeConf {
+	if in == nil {
+		return nil
+	}
+	out := new(RollingUpgradeConf)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollingUpgradeStatus) DeepCopyInto(out *RollingUpgradeStatus) {
+	*out = *in
+	if in.StepStartTime != nil {
+		in, out := &in.StepStartTime, &out.StepStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.FinishTime != nil {
+		in, out := &in.FinishTime, &out.FinishTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollingUpgradeStatus.
+func (in *RollingUpgradeStatus) DeepCopy() *RollingUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RollingUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceConf) DeepCopyInto(out *ServiceConf) {
 	*out = *in
@@ -526,3 +1239,18 @@ func (in *ServiceConf) DeepCopy() *ServiceConf {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSConf) DeepCopyInto(out *TLSConf) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSConf.
+func (in *TLSConf) DeepCopy() *TLSConf {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSConf)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources/backup"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"time"
+)
+
+// binlogArchiveResult is written by archive-binlogs.sh to the termination log of the archive container
+type binlogArchiveResult struct {
+	LastGTID      string       `json:"lastGTID"`
+	LastEventTime *metav1.Time `json:"lastEventTime"`
+}
+
+// reconcileBinlogArchive runs the binlog archive job every interval and records the archived position in the status.
+// The job reads binary logs from a single primary pod, the same one is used as long as it's ready.
+func (r *MariaDBBackupReconciler) reconcileBinlogArchive(ctx context.Context, backupCr *mariadbv1alpha1.MariaDBBackup, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) (ctrl.Result, error) {
+	if backupCr.Spec.BinlogArchive == nil {
+		backupCr.Status.BinlogArchive = nil
+		return ctrl.Result{}, nil
+	}
+	if backupCr.Status.BinlogArchive == nil {
+		backupCr.Status.BinlogArchive = &mariadbv1alpha1.BinlogArchiveStatus{}
+	}
+	status := backupCr.Status.BinlogArchive
+	interval := backupCr.GetBinlogArchiveInterval()
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: backupCr.GetBinlogArchiveJobName(), Namespace: cluster.Namespace}, job)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	if err == nil {
+		finished, err := r.finishBinlogArchiveJob(ctx, job, status)
+		if err != nil || !finished {
+			return ctrl.Result{RequeueAfter: interval}, err
+		}
+
+		err = r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	if status.LastRunTime != nil {
+		next := status.LastRunTime.Add(interval)
+		if wait := time.Until(next); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	pod, err := r.getBinlogSourcePod(ctx, cluster, status.SourcePod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pod == nil {
+		log.Info("no ready primary pod, binary logs are not archived")
+		status.Message = "no ready primary pod"
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	err = backup.NewBinlogArchiveJob(r.Client, nil, r.Scheme, cluster, backupCr, pod).Reconcile(ctx, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	status.SourcePod = pod.Name
+
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// finishBinlogArchiveJob records result of the finished job in the status, returns false when the job is still running
+func (r *MariaDBBackupReconciler) finishBinlogArchiveJob(ctx context.Context, job *batchv1.Job, status *mariadbv1alpha1.BinlogArchiveStatus) (bool, error) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		now := metav1.Now()
+		switch condition.Type {
+		case batchv1.JobComplete:
+			result := &binlogArchiveResult{}
+			found, err := r.getTerminationMessage(ctx, job, result)
+			if err != nil {
+				return false, err
+			}
+			if found && result.LastGTID != "" {
+				status.LastGTID = result.LastGTID
+				status.LastEventTime = result.LastEventTime
+			}
+			status.LastRunTime = &now
+			status.Message = ""
+			return true, nil
+		case batchv1.JobFailed:
+			status.LastRunTime = &now
+			status.Message = condition.Message
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getBinlogSourcePod returns the ready primary pod the binary logs are read from, current one is preferred
+func (r *MariaDBBackupReconciler) getBinlogSourcePod(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, current string) (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(cluster.Namespace),
+		client.MatchingLabels{"mariadb/pods": cluster.GetStatefulsetName("primary")})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+
+	var source *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.PodIP == "" || !isPodReady(pod) {
+			continue
+		}
+		if pod.Name == current {
+			return pod, nil
+		}
+		if source == nil {
+			source = pod
+		}
+	}
+
+	return source, nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
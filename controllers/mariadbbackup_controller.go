@@ -21,10 +21,14 @@ import (
 	"github.com/aldor007/mariadb-operator/resources"
 	"github.com/aldor007/mariadb-operator/resources/backup"
 	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
 )
@@ -39,6 +43,8 @@ type MariaDBBackupReconciler struct {
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbbackups,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbbackups/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbbackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -83,7 +89,25 @@ func (r *MariaDBBackupReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 	}
 
-	return ctrl.Result{}, nil
+	oldStatus := backupCr.Status.DeepCopy()
+	err = r.refreshBackupStatus(ctx, backupCr, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	result, err := r.reconcileBinlogArchive(ctx, backupCr, cluster, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !reflect.DeepEqual(oldStatus, &backupCr.Status) {
+		err = r.Status().Update(ctx, backupCr)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return result, nil
 
 }
 
@@ -91,5 +115,6 @@ func (r *MariaDBBackupReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 func (r *MariaDBBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&mariadbv1alpha1.MariaDBBackup{}).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(backupForJob)).
 		Complete(r)
 }
@@ -18,6 +18,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
 )
 
 var _ = Describe("MariadbBackup Controller", func() {
@@ -108,12 +109,24 @@ var _ = Describe("MariadbBackup Controller", func() {
 			It("should create job with proper image", func() {
 				var job batchv1.Job
 				err = cl.Get(context.TODO(), types.NamespacedName{
-					Name:      fmt.Sprintf("%s-%s", "backup", ClusterName),
+					Name:      backup.GetJobName(),
 					Namespace: Namespace,
 				}, &job)
 				Ω(err).To(BeNil())
 				Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal(cluster.Spec.Image))
 			})
+
+			It("should be owned by the backup", func() {
+				var job batchv1.Job
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      "backup-" + BackupName,
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				Expect(job.OwnerReferences).To(HaveLen(1))
+				Expect(job.OwnerReferences[0].Kind).To(Equal("MariaDBBackup"))
+				Expect(job.OwnerReferences[0].Name).To(Equal(BackupName))
+			})
 		})
 		Context("create backup cronjob", func() {
 			var (
@@ -172,12 +185,318 @@ var _ = Describe("MariadbBackup Controller", func() {
 			It("should create cronjob with proper image", func() {
 				var job batchv1beta.CronJob
 				err = cl.Get(context.TODO(), types.NamespacedName{
-					Name:      fmt.Sprintf("%s-%s", "backup", ClusterName),
+					Name:      backup.GetJobName(),
 					Namespace: Namespace,
 				}, &job)
 				Ω(err).To(BeNil())
 				Expect(job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image).To(Equal(cluster.Spec.Image))
 			})
+
+			It("should use logical backup by default", func() {
+				var job batchv1beta.CronJob
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      backup.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				env := job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env
+				Expect(env).To(ContainElement(corev1.EnvVar{Name: "BACKUP_METHOD", Value: "logical"}))
+			})
+		})
+		Context("create physical backup cronjob", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				backup = &v1alpha1.MariaDBBackup{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      BackupName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBBackupSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+							Namespace: Namespace,
+						},
+						BackupSecretName: "secret",
+						CronExpression:   "22 * * * *",
+						Method:           v1alpha1.BackupMethodPhysical,
+					},
+				}
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image: "image",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBBackupReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should stream backup from the agent", func() {
+				var job batchv1beta.CronJob
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      backup.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				env := job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env
+				Expect(env).To(ContainElement(corev1.EnvVar{Name: "BACKUP_METHOD", Value: "physical"}))
+				Expect(env).To(ContainElement(corev1.EnvVar{Name: "AGENT_PORT", Value: "3307"}))
+			})
+		})
+		Context("create physical backup cronjob of a cluster with TLS", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				backup = &v1alpha1.MariaDBBackup{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      BackupName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBBackupSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+							Namespace: Namespace,
+						},
+						BackupSecretName: "secret",
+						CronExpression:   "22 * * * *",
+						Method:           v1alpha1.BackupMethodPhysical,
+					},
+				}
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image: "image",
+						TLS: &v1alpha1.TLSConf{
+							Enabled: true,
+						},
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBBackupReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("should authenticate to the agent with the cluster certificate", func() {
+				Ω(err).To(BeNil())
+				var job batchv1beta.CronJob
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      backup.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				template := job.Spec.JobTemplate.Spec.Template
+				Expect(template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "AGENT_TLS_NAME", Value: cluster.GetPrimaryHeadlessAddress()}))
+				Expect(template.Spec.Volumes).To(ContainElement(corev1.Volume{
+					Name: "tls",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: cluster.GetTLSSecretName()},
+					},
+				}))
+				Expect(template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+					Name:      "tls",
+					MountPath: "/etc/mysql/tls",
+					ReadOnly:  true,
+				}))
+			})
+		})
+		Context("backup jobs finished", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				backup = &v1alpha1.MariaDBBackup{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      BackupName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBBackupSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+							Namespace: Namespace,
+						},
+						BackupURL:        "s3:backups/example",
+						BackupSecretName: "secret",
+						CronExpression:   "22 * * * *",
+						Retention: &v1alpha1.BackupRetention{
+							KeepLast: 7,
+							MaxAge:   &metav1.Duration{Duration: 30 * 24 * time.Hour},
+						},
+					},
+				}
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image: "image",
+					},
+				}
+				labels := map[string]string{
+					"mariadb/backup":           BackupName,
+					"mariadb/backup-namespace": Namespace,
+				}
+				start := metav1.NewTime(time.Date(2021, 5, 1, 22, 0, 0, 0, time.UTC))
+				end := metav1.NewTime(start.Add(90 * time.Second))
+				failedStart := metav1.NewTime(start.Add(-24 * time.Hour))
+				succeededJob := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "backup-example-1",
+						Namespace: Namespace,
+						Labels:    labels,
+					},
+					Status: batchv1.JobStatus{
+						StartTime:      &start,
+						CompletionTime: &end,
+						Conditions: []batchv1.JobCondition{
+							{
+								Type:   batchv1.JobComplete,
+								Status: corev1.ConditionTrue,
+							},
+						},
+					},
+				}
+				failedJob := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "backup-example-0",
+						Namespace: Namespace,
+						Labels:    labels,
+					},
+					Status: batchv1.JobStatus{
+						StartTime: &failedStart,
+						Conditions: []batchv1.JobCondition{
+							{
+								Type:               batchv1.JobFailed,
+								Status:             corev1.ConditionTrue,
+								Message:            "Job has reached the specified backoff limit",
+								LastTransitionTime: metav1.NewTime(failedStart.Add(time.Minute)),
+							},
+						},
+					},
+				}
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "backup-example-1-abcde",
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"job-name": "backup-example-1",
+						},
+					},
+					Status: corev1.PodStatus{
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								Name: "backup",
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										ExitCode: 0,
+										Message:  `{"path": "s3:backups/example/example-2021-05-01_22-00-00.tar.gz", "size": 1024, "deleted": ["s3:backups/example/example-2021-03-01_22-00-00.tar.gz"]}`,
+									},
+								},
+							},
+						},
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, succeededJob, failedJob, pod)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBBackupReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should record the last successful backup", func() {
+				var b v1alpha1.MariaDBBackup
+				err = cl.Get(context.TODO(), req.NamespacedName, &b)
+				Ω(err).To(BeNil())
+				Expect(b.Status.LastPhase).To(Equal(v1alpha1.BackupPhaseSucceeded))
+				Expect(b.Status.LastBackupPath).To(Equal("s3:backups/example/example-2021-05-01_22-00-00.tar.gz"))
+				Expect(b.Status.LastBackupSize).To(Equal(int64(1024)))
+				Expect(b.Status.LastBackupDuration.Duration).To(Equal(90 * time.Second))
+				Expect(b.Status.LastSuccessTime).NotTo(BeNil())
+			})
+
+			It("should record history newest first", func() {
+				var b v1alpha1.MariaDBBackup
+				err = cl.Get(context.TODO(), req.NamespacedName, &b)
+				Ω(err).To(BeNil())
+				Expect(b.Status.History).To(HaveLen(2))
+				Expect(b.Status.History[0].JobName).To(Equal("backup-example-1"))
+				Expect(b.Status.History[1].Phase).To(Equal(v1alpha1.BackupPhaseFailed))
+				Expect(b.Status.History[1].Message).To(Equal("Job has reached the specified backoff limit"))
+			})
+
+			It("should record backups deleted by the retention policy", func() {
+				var b v1alpha1.MariaDBBackup
+				err = cl.Get(context.TODO(), req.NamespacedName, &b)
+				Ω(err).To(BeNil())
+				Expect(b.Status.History[0].DeletedBackups).To(Equal([]string{"s3:backups/example/example-2021-03-01_22-00-00.tar.gz"}))
+			})
+
+			It("should pass retention policy to the cronjob", func() {
+				var job batchv1beta.CronJob
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      backup.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				env := job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env
+				Expect(env).To(ContainElement(corev1.EnvVar{Name: "RETENTION_KEEP_LAST", Value: "7"}))
+				Expect(env).To(ContainElement(corev1.EnvVar{Name: "RETENTION_MAX_AGE_SECONDS", Value: "2592000"}))
+			})
 		})
 		Context("update backup cronjob", func() {
 			var (
@@ -204,7 +523,7 @@ var _ = Describe("MariadbBackup Controller", func() {
 				}
 				cronJob := &batchv1beta.CronJob{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      fmt.Sprintf("%s-%s", "backup", ClusterName),
+						Name:      backup.GetJobName(),
 						Namespace: Namespace,
 					},
 					Spec:   batchv1beta.CronJobSpec{},
@@ -244,7 +563,7 @@ var _ = Describe("MariadbBackup Controller", func() {
 			It("should create cronjob with proper image", func() {
 				var job batchv1beta.CronJob
 				err = cl.Get(context.TODO(), types.NamespacedName{
-					Name:      fmt.Sprintf("%s-%s", "backup", ClusterName),
+					Name:      backup.GetJobName(),
 					Namespace: Namespace,
 				}, &job)
 				Ω(err).To(BeNil())
@@ -252,5 +571,386 @@ var _ = Describe("MariadbBackup Controller", func() {
 				Expect(job.Annotations["mariadb/config"]).To(Equal(backup.GetConfigHash()))
 			})
 		})
+		Context("backup job recreated after the config changed", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				backup = &v1alpha1.MariaDBBackup{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      BackupName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBBackupSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+							Namespace: Namespace,
+						},
+						BackupURL:        "s3:backups/example",
+						BackupSecretName: "secret",
+					},
+				}
+				start := metav1.NewTime(time.Date(2021, 5, 1, 22, 0, 0, 0, time.UTC))
+				end := metav1.NewTime(start.Add(time.Minute))
+				backup.Status = v1alpha1.MariaDBBackupStatus{
+					LastPhase:       v1alpha1.BackupPhaseSucceeded,
+					LastSuccessTime: &end,
+					History: []v1alpha1.MariaDBBackupRun{{
+						JobName:        backup.GetJobName(),
+						JobUID:         "old-uid",
+						Phase:          v1alpha1.BackupPhaseSucceeded,
+						StartTime:      &start,
+						CompletionTime: &end,
+					}},
+				}
+				oldJob := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        backup.GetJobName(),
+						Namespace:   Namespace,
+						UID:         "old-uid",
+						Annotations: map[string]string{"mariadb/config": "old"},
+						Labels: map[string]string{
+							"mariadb/backup":           BackupName,
+							"mariadb/backup-namespace": Namespace,
+						},
+					},
+					Status: batchv1.JobStatus{
+						StartTime:      &start,
+						CompletionTime: &end,
+						Conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+					},
+				}
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image: "image",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(cluster, backup, oldJob).Build()
+
+				r = &controllers.MariaDBBackupReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				_, err = r.Reconcile(context.Background(), req)
+				Expect(err).To(BeNil())
+
+				// the API server assigns a new UID to the recreated job, its pod starts later
+				var job batchv1.Job
+				Expect(cl.Get(context.TODO(), types.NamespacedName{Name: backup.GetJobName(), Namespace: Namespace}, &job)).To(Succeed())
+				Expect(job.Annotations["mariadb/config"]).To(Equal(backup.GetConfigHash()))
+				now := metav1.Now()
+				job.UID = "new-uid"
+				job.Status.StartTime = &now
+				Expect(cl.Update(context.TODO(), &job)).To(Succeed())
+
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should record the new run", func() {
+				var b v1alpha1.MariaDBBackup
+				Expect(cl.Get(context.TODO(), req.NamespacedName, &b)).To(Succeed())
+				Expect(b.Status.LastPhase).To(Equal(v1alpha1.BackupPhaseRunning))
+				Expect(b.Status.History).To(HaveLen(2))
+				Expect(b.Status.History[0].JobUID).To(BeEquivalentTo("new-uid"))
+				Expect(b.Status.History[0].Phase).To(Equal(v1alpha1.BackupPhaseRunning))
+				Expect(b.Status.History[1].JobUID).To(BeEquivalentTo("old-uid"))
+				Expect(b.Status.History[1].Phase).To(Equal(v1alpha1.BackupPhaseSucceeded))
+			})
+		})
+		Context("archive binary logs", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				backup = &v1alpha1.MariaDBBackup{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      BackupName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBBackupSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+							Namespace: Namespace,
+						},
+						BackupURL:        "s3:backups/example",
+						BackupSecretName: "secret",
+						CronExpression:   "22 * * * *",
+						BinlogArchive:    &v1alpha1.BinlogArchiveSpec{},
+					},
+				}
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image: "image",
+					},
+				}
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup)
+				for i, ready := range []corev1.ConditionStatus{corev1.ConditionFalse, corev1.ConditionTrue} {
+					fakeObjects = append(fakeObjects, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      fmt.Sprintf("%s-%d", cluster.GetStatefulsetName("primary"), i),
+							Namespace: Namespace,
+							Labels:    map[string]string{"mariadb/pods": cluster.GetStatefulsetName("primary")},
+						},
+						Status: corev1.PodStatus{
+							PodIP:      fmt.Sprintf("10.0.0.%d", i+1),
+							Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+						},
+					})
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBBackupReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should requeue after the archive interval", func() {
+				Expect(res.RequeueAfter).To(Equal(5 * time.Minute))
+			})
+
+			It("should create archive job reading from a ready pod", func() {
+				var job batchv1.Job
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      backup.GetBinlogArchiveJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				env := job.Spec.Template.Spec.Containers[0].Env
+				Expect(env).To(ContainElement(corev1.EnvVar{Name: "SOURCE_HOST", Value: "10.0.0.2"}))
+				Expect(env).To(ContainElement(corev1.EnvVar{Name: "BINLOG_URL", Value: "s3:backups/example/binlog"}))
+
+				var b v1alpha1.MariaDBBackup
+				err = cl.Get(context.TODO(), req.NamespacedName, &b)
+				Ω(err).To(BeNil())
+				Expect(b.Status.BinlogArchive.SourcePod).To(Equal(cluster.GetStatefulsetName("primary") + "-1"))
+				Expect(b.Status.History).To(BeEmpty())
+			})
+		})
+		Context("binary log archive job finished", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				backup = &v1alpha1.MariaDBBackup{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      BackupName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBBackupSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+							Namespace: Namespace,
+						},
+						BackupURL:        "s3:backups/example",
+						BackupSecretName: "secret",
+						CronExpression:   "22 * * * *",
+						BinlogArchive: &v1alpha1.BinlogArchiveSpec{
+							Interval: &metav1.Duration{Duration: time.Minute},
+						},
+					},
+				}
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image: "image",
+					},
+				}
+				job := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      backup.GetBinlogArchiveJobName(),
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"mariadb/binlog-archive":   BackupName,
+							"mariadb/backup-namespace": Namespace,
+						},
+					},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{
+							{
+								Type:   batchv1.JobComplete,
+								Status: corev1.ConditionTrue,
+							},
+						},
+					},
+				}
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "binlog-example-abcde",
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"job-name": job.Name,
+						},
+					},
+					Status: corev1.PodStatus{
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								Name: "binlog-archive",
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										ExitCode: 0,
+										Message:  `{"lastGTID": "1-1-1234", "lastEventTime": "2021-05-01T22:00:00Z"}`,
+									},
+								},
+							},
+						},
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, job, pod)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBBackupReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should record the archived position", func() {
+				var b v1alpha1.MariaDBBackup
+				err = cl.Get(context.TODO(), req.NamespacedName, &b)
+				Ω(err).To(BeNil())
+				Expect(b.Status.BinlogArchive.LastGTID).To(Equal("1-1-1234"))
+				Expect(b.Status.BinlogArchive.LastEventTime.UTC()).To(Equal(time.Date(2021, 5, 1, 22, 0, 0, 0, time.UTC)))
+				Expect(b.Status.BinlogArchive.LastRunTime).NotTo(BeNil())
+				Expect(res.RequeueAfter).To(Equal(time.Minute))
+			})
+
+			It("should remove the finished job", func() {
+				var job batchv1.Job
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      backup.GetBinlogArchiveJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).NotTo(BeNil())
+			})
+		})
+		Context("backup cronjob named after the cluster", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				backup = &v1alpha1.MariaDBBackup{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      BackupName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBBackupSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+							Namespace: Namespace,
+						},
+						BackupSecretName: "secret",
+						CronExpression:   "22 * * * *",
+					},
+				}
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image: "image",
+					},
+				}
+				isController := true
+				legacyCronJob := &batchv1beta.CronJob{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      fmt.Sprintf("%s-%s", "backup", ClusterName),
+						Namespace: Namespace,
+						OwnerReferences: []metav1.OwnerReference{
+							{
+								APIVersion: v1alpha1.GroupVersion.String(),
+								Kind:       "MariaDBCluster",
+								Name:       ClusterName,
+								Controller: &isController,
+							},
+						},
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, legacyCronJob)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBBackupReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should replace it with cronjob of the backup", func() {
+				var job batchv1beta.CronJob
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      fmt.Sprintf("%s-%s", "backup", ClusterName),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).NotTo(BeNil())
+
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      backup.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+			})
+		})
 	})
 })
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources/backup"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sort"
+	"strings"
+)
+
+const (
+	// backupHistoryLimit is the number of backup runs kept in the status
+	backupHistoryLimit = 10
+)
+
+// backupResult is written by create-backup.sh to the termination log of the backup container
+type backupResult struct {
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Deleted []string `json:"deleted"`
+}
+
+// refreshBackupStatus records runs of the backup jobs in the status, jobs removed by the cronjob history limit
+// stay in the status until they are pushed out by newer runs. Runs are identified by the job UID, the one-shot
+// job is recreated with the same name when the config changes.
+func (r *MariaDBBackupReconciler) refreshBackupStatus(ctx context.Context, backupCr *mariadbv1alpha1.MariaDBBackup, cluster *mariadbv1alpha1.MariaDBCluster) error {
+	jobs := &batchv1.JobList{}
+	err := r.List(ctx, jobs, client.InNamespace(cluster.Namespace), client.MatchingLabels(backup.Labels(backupCr)))
+	if err != nil {
+		return err
+	}
+
+	runs := make(map[string]mariadbv1alpha1.MariaDBBackupRun, len(backupCr.Status.History)+len(jobs.Items))
+	for _, run := range backupCr.Status.History {
+		runs[backupRunKey(run.JobName, run.JobUID)] = run
+	}
+	seen := make(map[string]bool, len(jobs.Items))
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		key := backupRunKey(job.Name, job.UID)
+		seen[key] = true
+		// runs recorded before they were identified by the job UID
+		if run, ok := runs[job.Name]; ok && key != job.Name && run.JobUID == "" && run.StartTime.Equal(jobStartTime(job)) {
+			delete(runs, job.Name)
+			run.JobUID = job.UID
+			runs[key] = run
+		}
+		// finished runs don't change, pods of old jobs may be gone already
+		if run, ok := runs[key]; ok && run.Phase != mariadbv1alpha1.BackupPhaseRunning {
+			continue
+		}
+
+		run, err := r.getBackupRun(ctx, job)
+		if err != nil {
+			return err
+		}
+		runs[key] = run
+	}
+
+	history := make([]mariadbv1alpha1.MariaDBBackupRun, 0, len(runs))
+	for key, run := range runs {
+		// the job was deleted before it finished, e.g. it was recreated after the config changed
+		if run.Phase == mariadbv1alpha1.BackupPhaseRunning && !seen[key] {
+			continue
+		}
+		history = append(history, run)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].StartTime.Equal(history[j].StartTime) {
+			return history[i].JobName > history[j].JobName
+		}
+		return history[j].StartTime.Before(history[i].StartTime)
+	})
+	if len(history) > backupHistoryLimit {
+		history = history[:backupHistoryLimit]
+	}
+	if len(history) == 0 {
+		history = nil
+	}
+
+	backupCr.Status.History = history
+	if len(history) > 0 {
+		backupCr.Status.LastPhase = history[0].Phase
+	}
+	for _, run := range history {
+		if run.Phase == mariadbv1alpha1.BackupPhaseSucceeded {
+			backupCr.Status.LastSuccessTime = run.CompletionTime
+			backupCr.Status.LastBackupPath = run.Path
+			backupCr.Status.LastBackupSize = run.Size
+			backupCr.Status.LastBackupDuration = run.Duration
+			break
+		}
+	}
+
+	return nil
+}
+
+// getBackupRun returns state of a single backup job
+func (r *MariaDBBackupReconciler) getBackupRun(ctx context.Context, job *batchv1.Job) (mariadbv1alpha1.MariaDBBackupRun, error) {
+	run := mariadbv1alpha1.MariaDBBackupRun{
+		JobName:   job.Name,
+		JobUID:    job.UID,
+		Phase:     mariadbv1alpha1.BackupPhaseRunning,
+		StartTime: jobStartTime(job),
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			run.Phase = mariadbv1alpha1.BackupPhaseSucceeded
+			run.CompletionTime = job.Status.CompletionTime
+		case batchv1.JobFailed:
+			completionTime := condition.LastTransitionTime
+			if completionTime.IsZero() {
+				completionTime = metav1.Now()
+			}
+			run.Phase = mariadbv1alpha1.BackupPhaseFailed
+			run.CompletionTime = &completionTime
+			run.Message = condition.Message
+		}
+	}
+
+	if run.CompletionTime != nil {
+		run.Duration = &metav1.Duration{Duration: run.CompletionTime.Sub(run.StartTime.Time)}
+	}
+
+	if run.Phase == mariadbv1alpha1.BackupPhaseSucceeded {
+		result, err := r.getBackupResult(ctx, job)
+		if err != nil {
+			return run, err
+		}
+		if result != nil {
+			run.Path = result.Path
+			run.Size = result.Size
+			run.DeletedBackups = result.Deleted
+		}
+	}
+
+	return run, nil
+}
+
+// backupRunKey identifies the run of the job, a one-shot job recreated after the config changed keeps its name
+func backupRunKey(name string, uid types.UID) string {
+	if uid == "" {
+		return name
+	}
+	return string(uid)
+}
+
+// jobStartTime returns when the job started, the creation time is used until its pod starts
+func jobStartTime(job *batchv1.Job) *metav1.Time {
+	if job.Status.StartTime != nil {
+		return job.Status.StartTime
+	}
+	creationTime := job.CreationTimestamp
+	return &creationTime
+}
+
+// getBackupResult reads termination message of the backup container
+func (r *MariaDBBackupReconciler) getBackupResult(ctx context.Context, job *batchv1.Job) (*backupResult, error) {
+	result := &backupResult{}
+	found, err := r.getTerminationMessage(ctx, job, result)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// getTerminationMessage decodes JSON written to the termination log by a successful container of the job
+func (r *MariaDBBackupReconciler) getTerminationMessage(ctx context.Context, job *batchv1.Job, result interface{}) (bool, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return false, err
+	}
+
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated == nil || terminated.ExitCode != 0 || terminated.Message == "" {
+				continue
+			}
+
+			if err := json.Unmarshal([]byte(strings.TrimSpace(terminated.Message)), result); err != nil {
+				r.Log.V(1).Info("invalid termination message", "job", job.Name, "err", err.Error())
+				continue
+			}
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// backupForJob maps backup job to the MariaDBBackup it belongs to
+func backupForJob(obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	name, ok := labels[backup.NameLabel]
+	if !ok {
+		name, ok = labels[backup.BinlogArchiveLabel]
+	}
+	if !ok {
+		return nil
+	}
+	namespace := labels[backup.NamespaceLabel]
+	if namespace == "" {
+		namespace = obj.GetNamespace()
+	}
+
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}},
+	}
+}
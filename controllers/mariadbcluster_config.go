@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sort"
+)
+
+// reconcileMariaDBConf applies changed MariaDBConf to the running pods. Dynamic variables are set with SET GLOBAL,
+// options removed from the spec are reset to their defaults,
+// a change of a static variable updates RestartConfigHash which triggers a rolling restart of the statefulsets
+func (r *MariaDBClusterReconciler) reconcileMariaDBConf(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	// the config is rendered to my.cnf, an invalid option could inject other options or sections
+	if err := cluster.Spec.MariaDBConf.Validate(); err != nil {
+		return fmt.Errorf("invalid MariaDBConf, err: %s", err)
+	}
+
+	confHash := cluster.GetMariaDBConfHash()
+	if cluster.Status.AppliedConfigHash == confHash {
+		return nil
+	}
+
+	pods, err := r.listPods(ctx, cluster, "primary")
+	if err != nil {
+		return err
+	}
+	replicaPods, err := r.listPods(ctx, cluster, "replica")
+	if err != nil {
+		return err
+	}
+	pods = append(pods, replicaPods...)
+
+	removed := removedConfOptions(cluster.Status.AppliedConfigOptions, cluster.Spec.MariaDBConf)
+
+	restart := false
+	if len(pods) > 0 && len(cluster.Spec.MariaDBConf)+len(removed) > 0 {
+		cfg, err := mysql.NewConfigFromClusterKey(ctx, r.Client, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace})
+		if err != nil {
+			return err
+		}
+
+		for _, pod := range pods {
+			// pods without IP are starting and will read the new config map
+			if pod.Status.PodIP == "" {
+				continue
+			}
+
+			podRestart, err := r.applyMariaDBConf(ctx, cfg.WithHost(pod.Status.PodIP), cluster.Spec.MariaDBConf, removed, log.WithValues("pod", pod.Name))
+			if err != nil {
+				// a restart will apply the config anyway
+				log.Info("unable to apply config online", "pod", pod.Name, "err", err.Error())
+				podRestart = true
+			}
+			restart = restart || podRestart
+		}
+	}
+
+	if restart || cluster.Status.RestartConfigHash == "" {
+		log.Info("config change requires restart of the pods")
+		cluster.Status.RestartConfigHash = confHash
+	}
+	cluster.Status.AppliedConfigHash = confHash
+	cluster.Status.AppliedConfigOptions = cluster.Spec.MariaDBConf.Options()
+
+	return nil
+}
+
+// removedConfOptions returns previously applied options which aren't in the config anymore
+func removedConfOptions(applied []string, conf mariadbv1alpha1.MariaDBConf) []string {
+	removed := []string{}
+	for _, option := range applied {
+		if _, ok := conf[option]; !ok {
+			removed = append(removed, option)
+		}
+	}
+	return removed
+}
+
+// applyMariaDBConf sets changed dynamic variables and resets removed ones on a single server,
+// returns true if any static variable differs
+func (r *MariaDBClusterReconciler) applyMariaDBConf(ctx context.Context, cfg *mysql.Config, conf mariadbv1alpha1.MariaDBConf, removed []string, log logr.Logger) (bool, error) {
+	sql, closeConn, err := r.SQLRunnerFactory(cfg)
+	if err != nil {
+		return false, err
+	}
+	defer closeConn()
+
+	options := append(conf.Options(), removed...)
+	sort.Strings(options)
+
+	variables, err := mysql.GetSystemVariables(ctx, sql, options)
+	if err != nil {
+		return false, err
+	}
+
+	restart := false
+	for _, option := range options {
+		value, configured := conf[option]
+		variable, ok := variables[mysql.VariableName(option)]
+		if !ok {
+			// not every option is exposed as a system variable
+			log.V(1).Info("unknown system variable, restart required", "option", option)
+			restart = true
+			continue
+		}
+		if configured && mysql.VariableValueEqual(value.String(), variable.Value) {
+			continue
+		}
+		if variable.ReadOnly {
+			// the current value can't be compared with the default, so a removed static option always restarts
+			log.V(1).Info("static variable changed, restart required", "variable", variable.Name)
+			restart = true
+			continue
+		}
+
+		if !configured {
+			log.Info("resetting global variable", "variable", variable.Name)
+			if err = mysql.ResetGlobalVariable(ctx, sql, variable.Name); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		log.Info("setting global variable", "variable", variable.Name, "value", value.String())
+		if err = mysql.SetGlobalVariable(ctx, sql, variable.Name, value.String()); err != nil {
+			return false, err
+		}
+	}
+
+	return restart, nil
+}
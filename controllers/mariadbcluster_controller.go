@@ -18,17 +18,30 @@ package controllers
 
 import (
 	"context"
+	"github.com/aldor007/mariadb-operator/mysql"
 	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/aldor007/mariadb-operator/resources/arbitrator"
+	"github.com/aldor007/mariadb-operator/resources/config"
 	"github.com/aldor007/mariadb-operator/resources/headless"
 	"github.com/aldor007/mariadb-operator/resources/primary"
 	"github.com/aldor007/mariadb-operator/resources/rbac"
+	"github.com/aldor007/mariadb-operator/resources/replica"
 	"github.com/aldor007/mariadb-operator/resources/secret"
 	"github.com/aldor007/mariadb-operator/resources/service"
+	"github.com/aldor007/mariadb-operator/resources/tls"
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
@@ -37,17 +50,34 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 )
 
+const (
+	// clusterStatusInterval is how often galera state of the pods is refreshed
+	clusterStatusInterval = 30 * time.Second
+	// clusterSecretsField indexes clusters by name of the secrets with root password and server certificate
+	clusterSecretsField = ".spec.secrets"
+)
+
 // MariaDBClusterReconciler reconciles a MariaDBCluster object
 type MariaDBClusterReconciler struct {
 	client.Client
-	DirectClient client.Reader
-	Log          logr.Logger
-	Scheme       *runtime.Scheme
+	DirectClient     client.Reader
+	Log              logr.Logger
+	Scheme           *runtime.Scheme
+	Recorder         record.EventRecorder
+	SQLRunnerFactory mysql.SQLRunnerFactory
 }
 
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=MariaDBClusters,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=MariaDBClusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=MariaDBClusters/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -71,13 +101,36 @@ func (r *MariaDBClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
+	oldStatus := instance.Status.DeepCopy()
+
+	// the rollback of the upgrade changes the image, so it's handled before the statefulsets are reconciled
+	err = r.handleUpgradeAnnotation(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// decides if config change requires restart, so it has to run before the statefulsets are reconciled
+	err = r.reconcileMariaDBConf(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = r.reconcileTLSMode(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	reconcilers := []resources.ComponentReconciler{
 		secret.NewOperatorSecret(r.Client, r.DirectClient, r.Scheme, instance),
+		tls.NewTLS(r.Client, r.DirectClient, r.Scheme, instance),
 		rbac.NewRBAC(r.Client, r.DirectClient, r.Scheme, instance),
+		config.NewConfigMap(r.Client, r.DirectClient, r.Scheme, instance),
 		primary.NewPrimary(r.Client, r.DirectClient, r.Scheme, instance),
-		primary.NewPrimary(r.Client, r.DirectClient, r.Scheme, instance),
+		replica.NewReplica(r.Client, r.DirectClient, r.Scheme, instance),
 		headless.NewHeadlessService(r.Client, r.DirectClient, r.Scheme, instance, "primary"),
+		headless.NewHeadlessService(r.Client, r.DirectClient, r.Scheme, instance, "replica"),
 		service.NewService(r.Client, r.DirectClient, r.Scheme, instance),
+		arbitrator.NewArbitrator(r.Client, r.DirectClient, r.Scheme, instance),
 	}
 
 	for _, rec := range reconcilers {
@@ -87,13 +140,52 @@ func (r *MariaDBClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		}
 	}
 
-	return ctrl.Result{}, nil
+	err = r.refreshGaleraStatus(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = r.reconcileRecovery(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = r.reconcileUpgrade(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = r.reconcileReplication(ctx, instance, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = r.updateStatus(ctx, instance, oldStatus)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// galera state is not reflected in any kubernetes object, so poll it periodically
+	return ctrl.Result{RequeueAfter: clusterStatusInterval}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *MariaDBClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &mariadbv1alpha1.MariaDBCluster{}, clusterSecretsField, func(obj client.Object) []string {
+		cluster := obj.(*mariadbv1alpha1.MariaDBCluster)
+		if cluster.IsTLSEnabled() {
+			return []string{cluster.Spec.RootPassword.Name, cluster.GetTLSSecretName()}
+		}
+		return []string{cluster.Spec.RootPassword.Name}
+	})
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&mariadbv1alpha1.MariaDBCluster{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.ServiceAccount{}).
 		Owns(&corev1.ConfigMap{}).
@@ -102,5 +194,28 @@ func (r *MariaDBClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&policyv1beta1.PodDisruptionBudget{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&corev1.Pod{}).
+		Owns(&batchv1.Job{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.clustersForSecret)).
 		Complete(r)
 }
+
+// clustersForSecret maps root password or TLS secret to the clusters referencing it.
+// A changed root password isn't applied to the server, the reconcile only starts using it to connect.
+func (r *MariaDBClusterReconciler) clustersForSecret(obj client.Object) []reconcile.Request {
+	clusters := &mariadbv1alpha1.MariaDBClusterList{}
+	err := r.List(context.Background(), clusters, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{clusterSecretsField: obj.GetName()})
+	if err != nil {
+		r.Log.Error(err, "failed to list clusters of secret", "secret", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for _, cluster := range clusters.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace},
+		})
+	}
+
+	return requests
+}
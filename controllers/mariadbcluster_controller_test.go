@@ -2,22 +2,108 @@ package controllers_test
 
 import (
 	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
 	"github.com/aldor007/mariadb-operator/api/v1alpha1"
 	"github.com/aldor007/mariadb-operator/controllers"
+	mysqlMock "github.com/aldor007/mariadb-operator/mocks/mysql"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/aldor007/mariadb-operator/resources/config"
+	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
 )
 
+// failingDeleteClient fails deleting pods, the fake client can't inject errors on its own
+type failingDeleteClient struct {
+	client.Client
+	err error
+}
+
+func (c failingDeleteClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if _, ok := obj.(*corev1.Pod); ok {
+		return c.err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+// galeraRows returns mocked rows of SHOW GLOBAL STATUS query
+func galeraRows(mockCtrl *gomock.Controller, vars [][]string) mysql.Rows {
+	rows := mysqlMock.NewMockRows(mockCtrl)
+	i := 0
+	rows.EXPECT().Next().DoAndReturn(func() bool {
+		i++
+		return i <= len(vars)
+	}).AnyTimes()
+	rows.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...interface{}) error {
+		*dest[0].(*string) = vars[i-1][0]
+		*dest[1].(*string) = vars[i-1][1]
+		return nil
+	}).AnyTimes()
+	rows.EXPECT().Err().Return(nil).AnyTimes()
+	return rows
+}
+
+// systemVariableRows returns mocked rows of information_schema.SYSTEM_VARIABLES query
+func systemVariableRows(mockCtrl *gomock.Controller, vars [][]string) mysql.Rows {
+	rows := mysqlMock.NewMockRows(mockCtrl)
+	i := 0
+	rows.EXPECT().Next().DoAndReturn(func() bool {
+		i++
+		return i <= len(vars)
+	}).AnyTimes()
+	rows.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...interface{}) error {
+		for j := range dest {
+			*dest[j].(*string) = vars[i-1][j]
+		}
+		return nil
+	}).AnyTimes()
+	rows.EXPECT().Err().Return(nil).AnyTimes()
+	return rows
+}
+
+// slaveStatusRows returns mocked rows of SHOW SLAVE STATUS query, no rows are returned for nil status
+func slaveStatusRows(mockCtrl *gomock.Controller, status map[string]string) mysql.Rows {
+	rows := mysqlMock.NewMockRows(mockCtrl)
+	rows.EXPECT().Next().Return(status != nil)
+	rows.EXPECT().Err().Return(nil).AnyTimes()
+	if status == nil {
+		return rows
+	}
+
+	columns := []string{}
+	for column := range status {
+		columns = append(columns, column)
+	}
+	rows.EXPECT().Columns().Return(columns, nil)
+	rows.EXPECT().Scan(gomock.Any()).DoAndReturn(func(dest ...interface{}) error {
+		for i, column := range columns {
+			*dest[i].(*sql.NullString) = sql.NullString{String: status[column], Valid: true}
+		}
+		return nil
+	})
+	return rows
+}
+
 var _ = Describe("MariadbCluster Controller", func() {
 	const (
 		Namespace   = "default"
@@ -103,7 +189,45 @@ var _ = Describe("MariadbCluster Controller", func() {
 				}, &s)
 				Ω(err).To(BeNil())
 				Expect(s.Spec.Template.Spec.Containers[0].Image).To(Equal(cluster.Spec.Image))
-				Expect(*s.Spec.Replicas).To(Equal(cluster.Spec.PrimaryCount))
+				// galera nodes are added one at a time, the first one starts alone
+				Expect(*s.Spec.Replicas).To(Equal(int32(1)))
+				// the operator restarts the galera pods during upgrades
+				Expect(s.Spec.UpdateStrategy.Type).To(Equal(appsv1.OnDeleteStatefulSetStrategyType))
+			})
+
+			It("should run backup agent next to galera nodes", func() {
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("primary"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				Expect(s.Spec.Template.Spec.Containers).To(HaveLen(2))
+				agent := s.Spec.Template.Spec.Containers[1]
+				Expect(agent.Name).To(Equal("backup-agent"))
+				Expect(agent.Ports[0].ContainerPort).To(Equal(int32(3307)))
+				Expect(agent.VolumeMounts[0].MountPath).To(Equal("/var/lib/mysql"))
+			})
+
+			It("should expose peer-finder status and let it watch the pods", func() {
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("primary"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				Expect(s.Spec.Template.Spec.Containers[0].Ports).To(ContainElement(corev1.ContainerPort{
+					Name:          "peer-finder",
+					ContainerPort: 3308,
+				}))
+
+				var role rbacv1.Role
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      ClusterName + "-mariadb-list-pods",
+					Namespace: Namespace,
+				}, &role)
+				Ω(err).To(BeNil())
+				Expect(role.Rules[0].Verbs).To(ContainElement("watch"))
 			})
 
 			It("should create headless svc", func() {
@@ -187,5 +311,1929 @@ var _ = Describe("MariadbCluster Controller", func() {
 				Expect(svc.Spec.LoadBalancerIP).To(Equal("1.2.3.4"))
 			})
 		})
+		When("create Mariadb cluster with TLS", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 3,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+						TLS: &v1alpha1.TLSConf{
+							Enabled: true,
+						},
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(cluster).Build()
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should issue server certificate signed by generated CA", func() {
+				var ca, cert corev1.Secret
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: cluster.GetCASecretName(), Namespace: Namespace}, &ca)
+				Ω(err).To(BeNil())
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: cluster.GetTLSSecretName(), Namespace: Namespace}, &cert)
+				Ω(err).To(BeNil())
+
+				roots := x509.NewCertPool()
+				Expect(roots.AppendCertsFromPEM(ca.Data["ca.crt"])).To(BeTrue())
+				block, _ := pem.Decode(cert.Data["tls.crt"])
+				Expect(block).NotTo(BeNil())
+				serverCert, err := x509.ParseCertificate(block.Bytes)
+				Ω(err).To(BeNil())
+				_, err = serverCert.Verify(x509.VerifyOptions{
+					DNSName: "example-primary-0.mariadb-headless-example-primary.default.svc.cluster.local",
+					Roots:   roots,
+				})
+				Ω(err).To(BeNil())
+			})
+
+			It("should enable TLS in server config", func() {
+				var cm corev1.ConfigMap
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: cluster.GetConfigMapName(), Namespace: Namespace}, &cm)
+				Ω(err).To(BeNil())
+				Expect(cm.Data["zz-tls.cnf"]).To(ContainSubstring("ssl_cert = /etc/mysql/tls/tls.crt\n"))
+				Expect(cm.Data["zz-tls.cnf"]).To(ContainSubstring("socket.ssl=yes"))
+			})
+
+			It("should mount server certificate", func() {
+				var c v1alpha1.MariaDBCluster
+				err = cl.Get(context.TODO(), req.NamespacedName, &c)
+				Ω(err).To(BeNil())
+				Expect(c.Status.TLSCertificateHash).NotTo(BeEmpty())
+
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("primary"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				Expect(s.Spec.Template.Annotations["mariadb/tls-certificate"]).To(Equal(c.Status.TLSCertificateHash))
+				Expect(s.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+					Name: "tls",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: cluster.GetTLSSecretName()},
+					},
+				}))
+				Expect(s.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+					Name:      "tls",
+					MountPath: "/etc/mysql/tls",
+					ReadOnly:  true,
+				}))
+			})
+
+			It("should stream backups over TLS", func() {
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("primary"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				agent := s.Spec.Template.Spec.Containers[1]
+				Expect(agent.Args[0]).To(Equal("OPENSSL-LISTEN:3307,reuseaddr,fork,cert=/etc/mysql/tls/tls.crt,key=/etc/mysql/tls/tls.key,cafile=/etc/mysql/tls/ca.crt,verify=1"))
+				Expect(agent.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+					Name:      "tls",
+					MountPath: "/etc/mysql/tls",
+					ReadOnly:  true,
+				}))
+			})
+		})
+		When("TLS is turned on for an existing cluster", func() {
+			var (
+				cl       client.Client
+				err      error
+				recorder *record.FakeRecorder
+				mockCtrl *gomock.Controller
+				sts      *appsv1.StatefulSet
+				pods     []runtime.Object
+			)
+
+			stsName := "example-primary"
+			galeraPod := func(ordinal int, revision string) *corev1.Pod {
+				return &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      fmt.Sprintf("%s-%d", stsName, ordinal),
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"mariadb/pods":                  stsName,
+							appsv1.StatefulSetRevisionLabel: revision,
+						},
+					},
+					Status: corev1.PodStatus{
+						PodIP:      fmt.Sprintf("10.0.0.%d", ordinal+1),
+						Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+					},
+				}
+			}
+			getCluster := func() v1alpha1.MariaDBCluster {
+				var c v1alpha1.MariaDBCluster
+				Expect(cl.Get(context.TODO(), req.NamespacedName, &c)).To(Succeed())
+				return c
+			}
+			getTLSConfig := func() string {
+				var cm corev1.ConfigMap
+				Expect(cl.Get(context.TODO(), types.NamespacedName{Name: cluster.GetConfigMapName(), Namespace: Namespace}, &cm)).To(Succeed())
+				return cm.Data["zz-tls.cnf"]
+			}
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 3,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+						TLS: &v1alpha1.TLSConf{
+							Enabled: true,
+						},
+					},
+					Status: v1alpha1.MariaDBClusterStatus{
+						SyncedNodes: 3,
+					},
+				}
+				for i := 0; i < 3; i++ {
+					cluster.Status.Nodes = append(cluster.Status.Nodes, v1alpha1.MariaDBNodeStatus{
+						Name:          fmt.Sprintf("%s-%d", stsName, i),
+						Ready:         true,
+						ClusterStatus: mysql.GaleraClusterPrimary,
+						LocalState:    mysql.GaleraStateSynced,
+					})
+				}
+				replicas := int32(3)
+				sts = &appsv1.StatefulSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      stsName,
+						Namespace: Namespace,
+					},
+					Spec: appsv1.StatefulSetSpec{
+						Replicas: &replicas,
+					},
+					Status: appsv1.StatefulSetStatus{
+						CurrentRevision: "plain",
+						UpdateRevision:  "plain",
+					},
+				}
+				pods = []runtime.Object{galeraPod(0, "plain"), galeraPod(1, "plain"), galeraPod(2, "plain")}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				recorder = record.NewFakeRecorder(10)
+			})
+
+			JustBeforeEach(func() {
+				rootSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret-key",
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"root": []byte("root-password"),
+					},
+				}
+				objects := append([]runtime.Object{cluster, sts, rootSecret}, pods...)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(objects...).Build()
+
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GLOBAL STATUS LIKE 'wsrep_%'"))).DoAndReturn(func(context.Context, mysql.Query) (mysql.Rows, error) {
+					return galeraRows(mockCtrl, [][]string{
+						{"wsrep_cluster_size", "3"},
+						{"wsrep_cluster_status", "Primary"},
+						{"wsrep_local_state_comment", "Synced"},
+						{"wsrep_ready", "ON"},
+					}), nil
+				}).AnyTimes()
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client:   cl,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			Context("and the nodes run without TLS", func() {
+				It("should restart the nodes with dynamic TLS socket first", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.TLSMode).To(Equal(v1alpha1.TLSModeDynamic))
+					Expect(getTLSConfig()).To(ContainSubstring("socket.ssl=yes;socket.dynamic=yes;"))
+					Expect(<-recorder.Events).To(ContainSubstring("TLSRollout"))
+
+					var found appsv1.StatefulSet
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName, Namespace: Namespace}, &found)).To(Succeed())
+					Expect(found.Spec.Template.Annotations["mariadb/tls-mode"]).To(Equal("Dynamic"))
+					Expect(found.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+						Name: "tls",
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{SecretName: cluster.GetTLSSecretName()},
+						},
+					}))
+				})
+			})
+
+			Context("and some nodes weren't restarted with dynamic TLS socket", func() {
+				BeforeEach(func() {
+					cluster.Status.TLSMode = v1alpha1.TLSModeDynamic
+					sts.Spec.Template.Annotations = map[string]string{"mariadb/tls-mode": "Dynamic"}
+					sts.Status.UpdateRevision = "dynamic"
+					pods = []runtime.Object{galeraPod(0, "plain"), galeraPod(1, "dynamic"), galeraPod(2, "dynamic")}
+				})
+
+				It("should keep the dynamic TLS socket", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.TLSMode).To(Equal(v1alpha1.TLSModeDynamic))
+					Expect(getTLSConfig()).To(ContainSubstring("socket.dynamic=yes"))
+				})
+			})
+
+			Context("and all nodes were restarted with dynamic TLS socket", func() {
+				BeforeEach(func() {
+					cluster.Status.TLSMode = v1alpha1.TLSModeDynamic
+					sts.Spec.Template.Annotations = map[string]string{"mariadb/tls-mode": "Dynamic"}
+					sts.Status.UpdateRevision = "dynamic"
+					pods = []runtime.Object{galeraPod(0, "dynamic"), galeraPod(1, "dynamic"), galeraPod(2, "dynamic")}
+				})
+
+				It("should restart the nodes with TLS only", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.TLSMode).To(Equal(v1alpha1.TLSModeEnabled))
+					Expect(getTLSConfig()).To(ContainSubstring("socket.ssl=yes;socket.ssl_ca="))
+					Expect(getTLSConfig()).NotTo(ContainSubstring("socket.dynamic"))
+
+					var found appsv1.StatefulSet
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName, Namespace: Namespace}, &found)).To(Succeed())
+					Expect(found.Spec.Template.Annotations["mariadb/tls-mode"]).To(Equal("Enabled"))
+				})
+			})
+
+			Context("and TLS is turned off again", func() {
+				BeforeEach(func() {
+					cluster.Spec.TLS.Enabled = false
+					cluster.Status.TLSMode = v1alpha1.TLSModeEnabled
+					cluster.Status.TLSCertificateHash = "hash"
+				})
+
+				It("should keep the certificate while the nodes accept connections without TLS", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.TLSMode).To(Equal(v1alpha1.TLSModeDynamic))
+					Expect(getTLSConfig()).To(ContainSubstring("socket.dynamic=yes"))
+				})
+			})
+		})
+		When("create Mariadb cluster with replicas", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 3,
+						ReplicaCount: 2,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should create replica statefulset", func() {
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("replica"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				Expect(*s.Spec.Replicas).To(Equal(cluster.Spec.ReplicaCount))
+				Expect(s.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "REPLICA_MODE", Value: "yes"}))
+				Expect(s.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(corev1.EnvVar{Name: "GALLERA_MODE", Value: "yes"}))
+			})
+
+			It("should keep galera mode for primary statefulset", func() {
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("primary"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				Expect(*s.Spec.Replicas).To(Equal(int32(1)))
+				Expect(s.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "GALLERA_MODE", Value: "yes"}))
+			})
+
+			It("should create replica headless svc", func() {
+				var svc corev1.Service
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetHeadlessSvcName("replica"),
+					Namespace: Namespace,
+				}, &svc)
+				Ω(err).To(BeNil())
+				Expect(svc.Spec.Selector["mariadb/type"]).To(Equal("replica"))
+			})
+		})
+		When("create Mariadb cluster from backup", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 3,
+						ReplicaCount: 1,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize:      "1Gi",
+						InitBucketURL:        "s3:backups/production",
+						InitBucketSecretName: "backup-secret",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should pass init bucket to primary statefulset", func() {
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("primary"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				container := s.Spec.Template.Spec.Containers[0]
+				Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "INIT_BUCKET_URL", Value: "s3:backups/production"}))
+				Expect(container.EnvFrom).To(HaveLen(2))
+				Expect(container.EnvFrom[1].SecretRef.Name).To(Equal("backup-secret"))
+			})
+
+			It("shouldn't restore backup on replicas", func() {
+				var s appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("replica"),
+					Namespace: Namespace,
+				}, &s)
+				Ω(err).To(BeNil())
+				Expect(s.Spec.Template.Spec.Containers[0].EnvFrom).To(HaveLen(1))
+				for _, env := range s.Spec.Template.Spec.Containers[0].Env {
+					Expect(env.Name).NotTo(Equal("INIT_BUCKET_URL"))
+				}
+			})
+		})
+		When("replica is not configured", func() {
+			var (
+				cl       client.Client
+				err      error
+				mockCtrl *gomock.Controller
+			)
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 1,
+						ReplicaCount: 1,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+					},
+				}
+				rootSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret-key",
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"root": []byte("root-password"),
+					},
+				}
+				operatorSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      cluster.GetOperatorSecretName(),
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"BACKUP_USER":          []byte("backup"),
+						"BACKUP_PASSWORD":      []byte("backup-password"),
+						"REPLICATION_USER":     []byte("replication"),
+						"REPLICATION_PASSWORD": []byte("replication-password"),
+					},
+				}
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      cluster.GetStatefulsetName("replica") + "-0",
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"mariadb/pods": cluster.GetStatefulsetName("replica"),
+						},
+					},
+					Status: corev1.PodStatus{
+						PodIP: "10.0.0.2",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, rootSecret, operatorSecret, pod)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW SLAVE STATUS"))).Return(slaveStatusRows(mockCtrl, nil), nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.ConcatenateQueries(
+						mysql.NewQuery("STOP SLAVE"),
+						mysql.NewQuery("CHANGE MASTER TO MASTER_HOST=?, MASTER_PORT=?, MASTER_USER=?, MASTER_PASSWORD=?, MASTER_USE_GTID=slave_pos"),
+						mysql.NewQuery("START SLAVE"),
+					))).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW SLAVE STATUS"))).Return(slaveStatusRows(mockCtrl, map[string]string{
+						"Master_Host":           cluster.GetPrimaryHeadlessAddress(),
+						"Slave_IO_Running":      "Yes",
+						"Slave_SQL_Running":     "Yes",
+						"Seconds_Behind_Master": "0",
+					}), nil),
+				)
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should publish replication state in status", func() {
+				var c v1alpha1.MariaDBCluster
+				err = cl.Get(context.TODO(), req.NamespacedName, &c)
+				Ω(err).To(BeNil())
+				Expect(c.Status.Replicas).To(HaveLen(1))
+				Expect(c.Status.Replicas[0].IORunning).To(BeTrue())
+				Expect(c.Status.Replicas[0].SQLRunning).To(BeTrue())
+				Expect(*c.Status.Replicas[0].SecondsBehindMaster).To(Equal(int64(0)))
+			})
+		})
+		When("dynamic variable is changed", func() {
+			var (
+				cl       client.Client
+				err      error
+				mockCtrl *gomock.Controller
+			)
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 1,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+						MariaDBConf: v1alpha1.MariaDBConf{
+							"max_connections":      intstr.FromInt(200),
+							"innodb_log_file_size": intstr.FromString("48M"),
+						},
+					},
+					Status: v1alpha1.MariaDBClusterStatus{
+						AppliedConfigHash: "old",
+						RestartConfigHash: "old",
+					},
+				}
+				rootSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret-key",
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"root": []byte("root-password"),
+					},
+				}
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      cluster.GetStatefulsetName("primary") + "-0",
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"mariadb/pods": cluster.GetStatefulsetName("primary"),
+						},
+					},
+					Status: corev1.PodStatus{
+						PodIP: "10.0.0.1",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, rootSecret, pod)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SELECT VARIABLE_NAME, IFNULL(GLOBAL_VALUE, ''), READ_ONLY FROM information_schema.SYSTEM_VARIABLES WHERE VARIABLE_NAME IN (?, ?)"))).Return(systemVariableRows(mockCtrl, [][]string{
+						{"INNODB_LOG_FILE_SIZE", "50331648", "YES"},
+						{"MAX_CONNECTIONS", "151", "NO"},
+					}), nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("SET GLOBAL max_connections = ?"))).Return(nil),
+				)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GLOBAL STATUS LIKE 'wsrep_%'"))).Return(galeraRows(mockCtrl, [][]string{}), nil)
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should render config map", func() {
+				var cm corev1.ConfigMap
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetConfigMapName(),
+					Namespace: Namespace,
+				}, &cm)
+				Ω(err).To(BeNil())
+				Expect(cm.Data[config.FileName]).To(ContainSubstring("[mysqld]\ninnodb_log_file_size = 48M\nmax_connections = 200\n"))
+			})
+
+			It("shouldn't restart the pods", func() {
+				var c v1alpha1.MariaDBCluster
+				err = cl.Get(context.TODO(), req.NamespacedName, &c)
+				Ω(err).To(BeNil())
+				Expect(c.Status.AppliedConfigHash).To(Equal(cluster.GetMariaDBConfHash()))
+				Expect(c.Status.RestartConfigHash).To(Equal("old"))
+
+				var sts appsv1.StatefulSet
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      cluster.GetStatefulsetName("primary"),
+					Namespace: Namespace,
+				}, &sts)
+				Ω(err).To(BeNil())
+				Expect(sts.Spec.Template.Annotations["mariadb/restart-config"]).To(Equal("old"))
+				Expect(sts.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+					Name:      "mariadb-conf",
+					MountPath: config.MountPath,
+					SubPath:   config.FileName,
+				}))
+			})
+		})
+		When("options are removed from the config", func() {
+			var (
+				cl        client.Client
+				err       error
+				mockCtrl  *gomock.Controller
+				sqlRunner *mysqlMock.MockSQLRunner
+			)
+
+			getCluster := func() v1alpha1.MariaDBCluster {
+				var c v1alpha1.MariaDBCluster
+				Expect(cl.Get(context.TODO(), req.NamespacedName, &c)).To(Succeed())
+				return c
+			}
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 1,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+					},
+					Status: v1alpha1.MariaDBClusterStatus{
+						AppliedConfigHash:    "old",
+						AppliedConfigOptions: []string{"innodb_log_file_size", "max_connections"},
+						RestartConfigHash:    "old",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner = mysqlMock.NewMockSQLRunner(mockCtrl)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GLOBAL STATUS LIKE 'wsrep_%'"))).Return(galeraRows(mockCtrl, [][]string{}), nil).AnyTimes()
+			})
+
+			JustBeforeEach(func() {
+				rootSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret-key",
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"root": []byte("root-password"),
+					},
+				}
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      cluster.GetStatefulsetName("primary") + "-0",
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"mariadb/pods": cluster.GetStatefulsetName("primary"),
+						},
+					},
+					Status: corev1.PodStatus{
+						PodIP: "10.0.0.1",
+					},
+				}
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(cluster, rootSecret, pod).Build()
+				r = &controllers.MariaDBClusterReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			Context("and the removed option is dynamic", func() {
+				BeforeEach(func() {
+					cluster.Spec.MariaDBConf = v1alpha1.MariaDBConf{
+						"innodb_log_file_size": intstr.FromString("48M"),
+					}
+					gomock.InOrder(
+						sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SELECT VARIABLE_NAME, IFNULL(GLOBAL_VALUE, ''), READ_ONLY FROM information_schema.SYSTEM_VARIABLES WHERE VARIABLE_NAME IN (?, ?)"))).Return(systemVariableRows(mockCtrl, [][]string{
+							{"INNODB_LOG_FILE_SIZE", "50331648", "YES"},
+							{"MAX_CONNECTIONS", "200", "NO"},
+						}), nil),
+						sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("SET GLOBAL max_connections = DEFAULT"))).Return(nil),
+					)
+				})
+
+				It("should reset it without restart", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.AppliedConfigHash).To(Equal(cluster.GetMariaDBConfHash()))
+					Expect(c.Status.AppliedConfigOptions).To(Equal([]string{"innodb_log_file_size"}))
+					Expect(c.Status.RestartConfigHash).To(Equal("old"))
+				})
+			})
+
+			Context("and the config is emptied", func() {
+				BeforeEach(func() {
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SELECT VARIABLE_NAME, IFNULL(GLOBAL_VALUE, ''), READ_ONLY FROM information_schema.SYSTEM_VARIABLES WHERE VARIABLE_NAME IN (?, ?)"))).Return(systemVariableRows(mockCtrl, [][]string{
+						{"INNODB_LOG_FILE_SIZE", "50331648", "YES"},
+						{"MAX_CONNECTIONS", "151", "NO"},
+					}), nil)
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("SET GLOBAL max_connections = DEFAULT"))).Return(nil)
+				})
+
+				It("should restart the pods for the static option", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.AppliedConfigOptions).To(BeEmpty())
+					Expect(c.Status.RestartConfigHash).To(Equal(cluster.GetMariaDBConfHash()))
+				})
+			})
+
+			Context("and the config contains a line break", func() {
+				BeforeEach(func() {
+					cluster.Spec.MariaDBConf = v1alpha1.MariaDBConf{
+						"max_connections": intstr.FromString("200\n[client]\npassword = x"),
+					}
+				})
+
+				It("should refuse to render it", func() {
+					Ω(err).NotTo(BeNil())
+					var cm corev1.ConfigMap
+					err = cl.Get(context.TODO(), types.NamespacedName{
+						Name:      cluster.GetConfigMapName(),
+						Namespace: Namespace,
+					}, &cm)
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+
+			Context("and the config contains an invalid option name", func() {
+				BeforeEach(func() {
+					cluster.Spec.MariaDBConf = v1alpha1.MariaDBConf{
+						"max_connections = 1\n[client]": intstr.FromInt(1),
+					}
+				})
+
+				It("should return an error", func() {
+					Ω(err).To(MatchError(ContainSubstring("invalid option name")))
+				})
+			})
+		})
+		When("galera nodes are synced", func() {
+			var (
+				cl       client.Client
+				err      error
+				mockCtrl *gomock.Controller
+			)
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 1,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+					},
+				}
+				rootSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret-key",
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"root": []byte("root-password"),
+					},
+				}
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      cluster.GetStatefulsetName("primary") + "-0",
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"mariadb/pods": cluster.GetStatefulsetName("primary"),
+						},
+					},
+					Status: corev1.PodStatus{
+						PodIP: "10.0.0.1",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, rootSecret, pod)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GLOBAL STATUS LIKE 'wsrep_%'"))).Return(galeraRows(mockCtrl, [][]string{
+					{"wsrep_cluster_size", "1"},
+					{"wsrep_cluster_status", "Primary"},
+					{"wsrep_local_state_comment", "Synced"},
+					{"wsrep_ready", "ON"},
+				}), nil)
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						Expect(cfg.Host).To(Equal("10.0.0.1"))
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should publish galera state in status", func() {
+				var c v1alpha1.MariaDBCluster
+				err = cl.Get(context.TODO(), req.NamespacedName, &c)
+				Ω(err).To(BeNil())
+				Expect(c.Status.ClusterSize).To(Equal(int32(1)))
+				Expect(c.Status.SyncedNodes).To(Equal(int32(1)))
+				Expect(c.Status.Nodes).To(HaveLen(1))
+				Expect(c.Status.Nodes[0].LocalState).To(Equal("Synced"))
+				Expect(meta.IsStatusConditionTrue(c.Status.Conditions, v1alpha1.ClusterConditionReady)).To(BeTrue())
+				Expect(meta.IsStatusConditionTrue(c.Status.Conditions, v1alpha1.ClusterConditionSynced)).To(BeTrue())
+				Expect(meta.IsStatusConditionFalse(c.Status.Conditions, v1alpha1.ClusterConditionQuorumLost)).To(BeTrue())
+			})
+		})
+		When("all galera nodes went down", func() {
+			var (
+				cl       client.Client
+				err      error
+				recorder *record.FakeRecorder
+				objects  []runtime.Object
+				mockCtrl *gomock.Controller
+			)
+
+			stsName := "example-primary"
+			galeraPod := func(name string, ready bool) *corev1.Pod {
+				status := corev1.ConditionFalse
+				if ready {
+					status = corev1.ConditionTrue
+				}
+				return &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: Namespace,
+						Labels:    map[string]string{"mariadb/pods": stsName},
+					},
+					Status: corev1.PodStatus{
+						Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+					},
+				}
+			}
+			// pods with IP report synced galera state
+			syncedPod := func(name string) *corev1.Pod {
+				pod := galeraPod(name, true)
+				pod.Status.PodIP = "10.0.0.1"
+				return pod
+			}
+			getStatefulSet := func() appsv1.StatefulSet {
+				var sts appsv1.StatefulSet
+				Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName, Namespace: Namespace}, &sts)).To(Succeed())
+				return sts
+			}
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 3,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+					},
+					Status: v1alpha1.MariaDBClusterStatus{
+						Conditions: []metav1.Condition{{
+							Type:               v1alpha1.ClusterConditionQuorumLost,
+							Status:             metav1.ConditionTrue,
+							Reason:             "NoPrimaryComponent",
+							LastTransitionTime: metav1.NewTime(time.Now().Add(-10 * time.Minute)),
+						}},
+					},
+				}
+				objects = nil
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				recorder = record.NewFakeRecorder(10)
+			})
+
+			JustBeforeEach(func() {
+				rootSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret-key",
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"root": []byte("root-password"),
+					},
+				}
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(append(objects, cluster, rootSecret)...).Build()
+
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GLOBAL STATUS LIKE 'wsrep_%'"))).DoAndReturn(func(context.Context, mysql.Query) (mysql.Rows, error) {
+					return galeraRows(mockCtrl, [][]string{
+						{"wsrep_cluster_size", "3"},
+						{"wsrep_cluster_status", "Primary"},
+						{"wsrep_local_state_comment", "Synced"},
+						{"wsrep_ready", "ON"},
+					}), nil
+				}).AnyTimes()
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client:   cl,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			getCluster := func() v1alpha1.MariaDBCluster {
+				var c v1alpha1.MariaDBCluster
+				Expect(cl.Get(context.TODO(), req.NamespacedName, &c)).To(Succeed())
+				return c
+			}
+
+			Context("and the quorum has been lost for the timeout", func() {
+				BeforeEach(func() {
+					objects = append(objects, galeraPod(stsName+"-0", false))
+				})
+
+				It("should start the recovery", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.Recovery).NotTo(BeNil())
+					Expect(c.Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryScalingDown))
+					Expect(c.Status.Recovery.StartTime).NotTo(BeNil())
+					Expect(<-recorder.Events).To(ContainSubstring("GaleraRecoveryStarted"))
+				})
+			})
+
+			Context("and the quorum was lost recently", func() {
+				BeforeEach(func() {
+					cluster.Status.Conditions[0].LastTransitionTime = metav1.Now()
+					objects = append(objects, galeraPod(stsName+"-0", false))
+				})
+
+				It("should wait", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.Recovery).To(BeNil())
+				})
+			})
+
+			Context("and the pods stopped", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{Phase: v1alpha1.GaleraRecoveryScalingDown}
+					for _, ordinal := range []string{"0", "1"} {
+						objects = append(objects, &corev1.PersistentVolumeClaim{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:      "data-primary-" + stsName + "-" + ordinal,
+								Namespace: Namespace,
+							},
+						})
+					}
+				})
+
+				It("should keep the statefulset stopped", func() {
+					sts := getStatefulSet()
+					Expect(*sts.Spec.Replicas).To(Equal(int32(0)))
+				})
+
+				It("should read galera state of the volumes", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryRecovering))
+
+					var job batchv1.Job
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-recovery-1", Namespace: Namespace}, &job)
+					Ω(err).To(BeNil())
+					Expect(job.Spec.Template.Spec.Containers).To(HaveLen(1))
+					Expect(job.Spec.Template.Spec.Containers[0].Command).To(Equal([]string{"/usr/share/container-scripts/mysql/galera-recovery.sh"}))
+					Expect(job.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+						Name: "data-primary",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-primary-example-primary-1"},
+						},
+					}))
+
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-recovery-2", Namespace: Namespace}, &job)
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+
+			Context("and the recovery jobs completed", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{Phase: v1alpha1.GaleraRecoveryRecovering}
+					states := []string{
+						"uuid: 6b1b4b7e-0000-11ec-8d3d-0242ac130003\nseqno: 10\nsafe_to_bootstrap: 0\n",
+						"uuid: 6b1b4b7e-0000-11ec-8d3d-0242ac130003\nseqno: 12\nsafe_to_bootstrap: 0\n",
+						"uuid: 6b1b4b7e-0000-11ec-8d3d-0242ac130003\nseqno: 12\nsafe_to_bootstrap: 1\n",
+					}
+					for i, state := range states {
+						name := fmt.Sprintf("%s-recovery-%d", stsName, i)
+						objects = append(objects, &batchv1.Job{
+							ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+							Status:     batchv1.JobStatus{Succeeded: 1},
+						}, &corev1.Pod{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:      name + "-abcde",
+								Namespace: Namespace,
+								Labels:    map[string]string{"job-name": name},
+							},
+							Status: corev1.PodStatus{
+								Phase: corev1.PodSucceeded,
+								ContainerStatuses: []corev1.ContainerStatus{{
+									State: corev1.ContainerState{
+										Terminated: &corev1.ContainerStateTerminated{Message: state},
+									},
+								}},
+							},
+						})
+					}
+				})
+
+				It("should elect the node with the highest seqno", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryBootstrapping))
+					Expect(c.Status.Recovery.BootstrapNode).To(Equal(stsName + "-2"))
+					Expect(c.Status.Recovery.Nodes).To(HaveLen(3))
+					Expect(c.Status.Recovery.Nodes[0]).To(Equal(v1alpha1.GaleraNodeState{
+						Name:  stsName + "-0",
+						UUID:  "6b1b4b7e-0000-11ec-8d3d-0242ac130003",
+						Seqno: 10,
+					}))
+					Expect(<-recorder.Events).To(ContainSubstring("BootstrapNodeElected"))
+				})
+
+				It("should remove the jobs", func() {
+					var job batchv1.Job
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-recovery-0", Namespace: Namespace}, &job)
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+
+			Context("and the nodes belong to different clusters", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{Phase: v1alpha1.GaleraRecoveryRecovering}
+					for i, uuid := range []string{"6b1b4b7e-0000-11ec-8d3d-0242ac130003", "7c2c5c8f-0000-11ec-8d3d-0242ac130003"} {
+						name := fmt.Sprintf("%s-recovery-%d", stsName, i)
+						objects = append(objects, &batchv1.Job{
+							ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+							Status:     batchv1.JobStatus{Succeeded: 1},
+						}, &corev1.Pod{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:      name + "-abcde",
+								Namespace: Namespace,
+								Labels:    map[string]string{"job-name": name},
+							},
+							Status: corev1.PodStatus{
+								Phase: corev1.PodSucceeded,
+								ContainerStatuses: []corev1.ContainerStatus{{
+									State: corev1.ContainerState{
+										Terminated: &corev1.ContainerStateTerminated{Message: "uuid: " + uuid + "\nseqno: 5\n"},
+									},
+								}},
+							},
+						})
+					}
+				})
+
+				It("should fail the recovery", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryFailed))
+					Expect(c.Status.Recovery.FinishTime).NotTo(BeNil())
+					Expect(c.Status.Recovery.Message).To(ContainSubstring("different clusters"))
+					Expect(<-recorder.Events).To(ContainSubstring("GaleraRecoveryFailed"))
+				})
+			})
+
+			Context("and the bootstrap node was elected", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryBootstrapping,
+						BootstrapNode: stsName + "-2",
+					}
+				})
+
+				It("should bootstrap new cluster from its volume", func() {
+					Ω(err).To(BeNil())
+					var pod corev1.Pod
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-bootstrap", Namespace: Namespace}, &pod)
+					Ω(err).To(BeNil())
+					Expect(pod.Labels["mariadb/pods"]).To(Equal(stsName))
+					Expect(pod.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "GALERA_NEW_CLUSTER", Value: "yes"}))
+					Expect(pod.Spec.Volumes).To(ContainElement(corev1.Volume{
+						Name: "data-primary",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-primary-example-primary-2"},
+						},
+					}))
+				})
+			})
+
+			Context("and the bootstrap pod is ready", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryBootstrapping,
+						BootstrapNode: stsName + "-2",
+					}
+					objects = append(objects, galeraPod(stsName+"-bootstrap", true))
+				})
+
+				It("should start the pods preceding the bootstrap node", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryRejoining))
+					Expect(<-recorder.Events).To(ContainSubstring("ClusterBootstrapped"))
+				})
+			})
+
+			Context("and the preceding pods joined the bootstrapped cluster", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryRejoining,
+						BootstrapNode: stsName + "-2",
+					}
+					objects = append(objects, syncedPod(stsName+"-0"), syncedPod(stsName+"-1"), syncedPod(stsName+"-bootstrap"))
+				})
+
+				It("should run only the preceding pods", func() {
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(2)))
+				})
+
+				It("should stop the bootstrap pod", func() {
+					Ω(err).To(BeNil())
+					var pod corev1.Pod
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-bootstrap", Namespace: Namespace}, &pod)
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+					Expect(getCluster().Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryRejoining))
+				})
+			})
+
+			Context("and the bootstrap pod stopped", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryRejoining,
+						BootstrapNode: stsName + "-2",
+					}
+					objects = append(objects, syncedPod(stsName+"-0"), syncedPod(stsName+"-1"))
+				})
+
+				It("should complete the recovery", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryCompleted))
+					Expect(c.Status.Recovery.FinishTime).NotTo(BeNil())
+					Expect(<-recorder.Events).To(ContainSubstring("GaleraRecovered"))
+				})
+			})
+
+			Context("and the preceding pods are running but not synced", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryRejoining,
+						BootstrapNode: stsName + "-2",
+					}
+					objects = append(objects, galeraPod(stsName+"-0", true), syncedPod(stsName+"-1"), syncedPod(stsName+"-bootstrap"))
+				})
+
+				It("should keep the bootstrap pod", func() {
+					Ω(err).To(BeNil())
+					var pod corev1.Pod
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-bootstrap", Namespace: Namespace}, &pod)).To(Succeed())
+					Expect(getCluster().Status.Recovery.Message).To(Equal("1 of 2 pods joined the bootstrapped cluster"))
+				})
+			})
+
+			Context("and the cluster was bootstrapped from the first node", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryRejoining,
+						BootstrapNode: stsName + "-0",
+					}
+					objects = append(objects, syncedPod(stsName+"-bootstrap"))
+				})
+
+				It("should keep the statefulset stopped", func() {
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(0)))
+				})
+
+				It("should join the volume of the second node using a separate pod", func() {
+					Ω(err).To(BeNil())
+					var pod corev1.Pod
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-bootstrap", Namespace: Namespace}, &pod)).To(Succeed())
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-joiner", Namespace: Namespace}, &pod)).To(Succeed())
+					Expect(pod.Labels["mariadb/pods"]).To(Equal(stsName))
+					Expect(pod.Spec.Containers[0].Env).NotTo(ContainElement(corev1.EnvVar{Name: "GALERA_NEW_CLUSTER", Value: "yes"}))
+					Expect(pod.Spec.Volumes).To(ContainElement(corev1.Volume{
+						Name: "data-primary",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-primary-example-primary-1"},
+						},
+					}))
+					Expect(getCluster().Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryRejoining))
+				})
+			})
+
+			Context("and the second node joined the cluster bootstrapped from the first node", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryRejoining,
+						BootstrapNode: stsName + "-0",
+					}
+					objects = append(objects, syncedPod(stsName+"-bootstrap"), syncedPod(stsName+"-joiner"))
+				})
+
+				It("should stop the bootstrap pod", func() {
+					Ω(err).To(BeNil())
+					var pod corev1.Pod
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-bootstrap", Namespace: Namespace}, &pod)
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+					Expect(getCluster().Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryRejoining))
+				})
+			})
+
+			Context("and the bootstrap pod of the first node stopped", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryRejoining,
+						BootstrapNode: stsName + "-0",
+					}
+					objects = append(objects, syncedPod(stsName+"-joiner"))
+				})
+
+				It("should start the first pod joining the second node", func() {
+					Ω(err).To(BeNil())
+					Expect(getCluster().Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryHandover))
+				})
+			})
+
+			Context("and the first pod is handed over", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryHandover,
+						BootstrapNode: stsName + "-0",
+					}
+					objects = append(objects, galeraPod(stsName+"-0", false), syncedPod(stsName+"-joiner"))
+				})
+
+				It("should run only the first pod", func() {
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(1)))
+				})
+
+				It("should keep the joiner pod until the first pod joins it", func() {
+					Ω(err).To(BeNil())
+					var pod corev1.Pod
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-joiner", Namespace: Namespace}, &pod)).To(Succeed())
+					Expect(getCluster().Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryHandover))
+				})
+			})
+
+			Context("and the first pod joined the second node", func() {
+				BeforeEach(func() {
+					cluster.Status.Recovery = &v1alpha1.GaleraRecoveryStatus{
+						Phase:         v1alpha1.GaleraRecoveryHandover,
+						BootstrapNode: stsName + "-0",
+					}
+					objects = append(objects, syncedPod(stsName+"-0"))
+				})
+
+				It("should complete the recovery once the joiner pod stopped", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.Recovery.Phase).To(Equal(v1alpha1.GaleraRecoveryCompleted))
+					Expect(<-recorder.Events).To(ContainSubstring("GaleraRecovered"))
+				})
+			})
+		})
+		When("the number of galera nodes changes", func() {
+			var (
+				cl       client.Client
+				err      error
+				recorder *record.FakeRecorder
+				replicas int32
+			)
+
+			stsName := "example-primary"
+			syncedNodes := func(count int) []v1alpha1.MariaDBNodeStatus {
+				nodes := []v1alpha1.MariaDBNodeStatus{}
+				for i := 0; i < count; i++ {
+					nodes = append(nodes, v1alpha1.MariaDBNodeStatus{
+						Name:          fmt.Sprintf("%s-%d", stsName, i),
+						Ready:         true,
+						ClusterStatus: mysql.GaleraClusterPrimary,
+						LocalState:    mysql.GaleraStateSynced,
+					})
+				}
+				return nodes
+			}
+			getStatefulSet := func() appsv1.StatefulSet {
+				var sts appsv1.StatefulSet
+				Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName, Namespace: Namespace}, &sts)).To(Succeed())
+				return sts
+			}
+			getCluster := func() v1alpha1.MariaDBCluster {
+				var c v1alpha1.MariaDBCluster
+				Expect(cl.Get(context.TODO(), req.NamespacedName, &c)).To(Succeed())
+				return c
+			}
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image",
+						PrimaryCount: 3,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+					},
+					Status: v1alpha1.MariaDBClusterStatus{
+						Nodes: syncedNodes(2),
+					},
+				}
+				replicas = 2
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				recorder = record.NewFakeRecorder(10)
+			})
+
+			JustBeforeEach(func() {
+				sts := &appsv1.StatefulSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      stsName,
+						Namespace: Namespace,
+					},
+					Spec: appsv1.StatefulSetSpec{
+						Replicas: &replicas,
+					},
+				}
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(cluster, sts).Build()
+				r = &controllers.MariaDBClusterReconciler{
+					Client:   cl,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						Fail("there are no pods to query")
+						return nil, nil, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			Context("and all nodes are synced", func() {
+				It("should add one node", func() {
+					Ω(err).To(BeNil())
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(3)))
+				})
+
+				It("should leave the cluster gracefully on shutdown", func() {
+					sts := getStatefulSet()
+					Expect(*sts.Spec.Template.Spec.TerminationGracePeriodSeconds).To(Equal(int64(120)))
+					Expect(sts.Spec.Template.Spec.Containers[0].Lifecycle.PreStop.Exec.Command).To(Equal([]string{"/usr/share/container-scripts/mysql/leave-cluster.sh"}))
+				})
+			})
+
+			Context("and a node is not synced yet", func() {
+				BeforeEach(func() {
+					cluster.Status.Nodes[1].LocalState = "Joined"
+				})
+
+				It("should wait", func() {
+					Ω(err).To(BeNil())
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(2)))
+					c := getCluster()
+					Expect(meta.IsStatusConditionTrue(c.Status.Conditions, v1alpha1.ClusterConditionScaling)).To(BeTrue())
+					Expect(meta.FindStatusCondition(c.Status.Conditions, v1alpha1.ClusterConditionScaling).Reason).To(Equal("ScalingUp"))
+				})
+			})
+
+			Context("and the count is lowered", func() {
+				BeforeEach(func() {
+					cluster.Spec.PrimaryCount = 1
+					cluster.Status.Nodes = syncedNodes(3)
+					replicas = 3
+				})
+
+				It("should remove one node", func() {
+					Ω(err).To(BeNil())
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(2)))
+					Expect(meta.FindStatusCondition(getCluster().Status.Conditions, v1alpha1.ClusterConditionScaling).Reason).To(Equal("ScalingDown"))
+				})
+			})
+
+			Context("and the count is even", func() {
+				BeforeEach(func() {
+					cluster.Spec.PrimaryCount = 4
+					cluster.Status.Nodes = syncedNodes(3)
+					replicas = 3
+				})
+
+				It("should refuse to scale", func() {
+					Ω(err).To(BeNil())
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(3)))
+					condition := meta.FindStatusCondition(getCluster().Status.Conditions, v1alpha1.ClusterConditionScaling)
+					Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+					Expect(condition.Reason).To(Equal("ScalingRefused"))
+					Expect(<-recorder.Events).To(ContainSubstring("ScalingRefused"))
+				})
+			})
+
+			Context("and the count is even with the arbitrator", func() {
+				BeforeEach(func() {
+					cluster.Spec.PrimaryCount = 4
+					cluster.Spec.Arbitrator = &v1alpha1.ArbitratorConf{Enabled: true}
+					cluster.Status.Nodes = syncedNodes(3)
+					replicas = 3
+				})
+
+				It("should add one node", func() {
+					Ω(err).To(BeNil())
+					Expect(*getStatefulSet().Spec.Replicas).To(Equal(int32(4)))
+				})
+
+				It("should run the arbitrator", func() {
+					var deployment appsv1.Deployment
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: cluster.GetArbitratorName(), Namespace: Namespace}, &deployment)).To(Succeed())
+					Expect(*deployment.Spec.Replicas).To(Equal(int32(1)))
+					container := deployment.Spec.Template.Spec.Containers[0]
+					Expect(container.Image).To(Equal(cluster.Spec.Image))
+					Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "PRIMARY_HOST", Value: cluster.GetPrimaryHeadlessAddress()}))
+				})
+			})
+		})
+		When("the galera pods are upgraded", func() {
+			var (
+				cl        client.Client
+				err       error
+				recorder  *record.FakeRecorder
+				mockCtrl  *gomock.Controller
+				pods      []runtime.Object
+				objects   []runtime.Object
+				version   string
+				desync    bool
+				deleteErr error
+			)
+
+			stsName := "example-primary"
+			galeraPod := func(ordinal int, revision, image string, ready bool) *corev1.Pod {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      fmt.Sprintf("%s-%d", stsName, ordinal),
+						Namespace: Namespace,
+						Labels: map[string]string{
+							"mariadb/pods":                  stsName,
+							appsv1.StatefulSetRevisionLabel: revision,
+						},
+					},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "mariadb-service", Image: image}},
+					},
+				}
+				if ready {
+					pod.Status.PodIP = fmt.Sprintf("10.0.0.%d", ordinal+1)
+					pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+				}
+				return pod
+			}
+			getCluster := func() v1alpha1.MariaDBCluster {
+				var c v1alpha1.MariaDBCluster
+				Expect(cl.Get(context.TODO(), req.NamespacedName, &c)).To(Succeed())
+				return c
+			}
+			getPod := func(ordinal int) error {
+				var pod corev1.Pod
+				return cl.Get(context.TODO(), types.NamespacedName{Name: fmt.Sprintf("%s-%d", stsName, ordinal), Namespace: Namespace}, &pod)
+			}
+
+			BeforeEach(func() {
+				cluster = &v1alpha1.MariaDBCluster{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ClusterName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBClusterSpec{
+						Image:        "image:10.6",
+						PrimaryCount: 3,
+						RootPassword: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "secret-key",
+							},
+							Key: "root",
+						},
+						DataStorageSize: "1Gi",
+					},
+				}
+				pods = []runtime.Object{
+					galeraPod(0, "old", "image:10.5", true),
+					galeraPod(1, "old", "image:10.5", true),
+					galeraPod(2, "old", "image:10.5", true),
+				}
+				objects = nil
+				version = "10.5.9-MariaDB"
+				desync = false
+				deleteErr = nil
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				recorder = record.NewFakeRecorder(10)
+			})
+
+			JustBeforeEach(func() {
+				replicas := int32(3)
+				sts := &appsv1.StatefulSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        stsName,
+						Namespace:   Namespace,
+						Annotations: map[string]string{"mariadb/config": cluster.GetConfigHash()},
+					},
+					Spec: appsv1.StatefulSetSpec{
+						Replicas: &replicas,
+					},
+					Status: appsv1.StatefulSetStatus{
+						CurrentRevision: "old",
+						UpdateRevision:  "new",
+					},
+				}
+				rootSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret-key",
+						Namespace: Namespace,
+					},
+					Data: map[string][]byte{
+						"root": []byte("root-password"),
+					},
+				}
+				objects = append(objects, cluster, sts, rootSecret)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(append(objects, pods...)...).Build()
+
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GLOBAL STATUS LIKE 'wsrep_%'"))).DoAndReturn(func(context.Context, mysql.Query) (mysql.Rows, error) {
+					return galeraRows(mockCtrl, [][]string{
+						{"wsrep_cluster_size", "3"},
+						{"wsrep_cluster_status", "Primary"},
+						{"wsrep_local_state_comment", "Synced"},
+						{"wsrep_ready", "ON"},
+					}), nil
+				}).AnyTimes()
+				sqlRunner.EXPECT().QueryRow(gomock.Any(), EqQuery(mysql.NewQuery("SELECT VERSION()")), gomock.Any()).DoAndReturn(func(_ context.Context, _ mysql.Query, dest ...interface{}) error {
+					*dest[0].(*string) = version
+					return nil
+				}).AnyTimes()
+				if desync {
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("SET GLOBAL wsrep_desync = ON"))).Return(nil)
+				}
+				var reconcilerClient client.Client = cl
+				if deleteErr != nil {
+					reconcilerClient = failingDeleteClient{Client: cl, err: deleteErr}
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("SET GLOBAL wsrep_desync = OFF"))).Return(nil)
+				}
+
+				r = &controllers.MariaDBClusterReconciler{
+					Client:   reconcilerClient,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
+					SQLRunnerFactory: func(cfg *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			Context("and the pods run the previous revision", func() {
+				BeforeEach(func() {
+					desync = true
+				})
+
+				It("should start the upgrade with the last pod", func() {
+					Ω(err).To(BeNil())
+					upgrade := getCluster().Status.Upgrade
+					Expect(upgrade).NotTo(BeNil())
+					Expect(upgrade.Phase).To(Equal(v1alpha1.RollingUpgradeUpdating))
+					Expect(upgrade.Revision).To(Equal("new"))
+					Expect(upgrade.FromImage).To(Equal("image:10.5"))
+					Expect(upgrade.ToImage).To(Equal("image:10.6"))
+					Expect(upgrade.FromVersion).To(Equal("10.5.9-MariaDB"))
+					Expect(upgrade.CurrentPod).To(Equal(stsName + "-2"))
+					Expect(<-recorder.Events).To(ContainSubstring("UpgradeStarted"))
+				})
+
+				It("should restart only one pod", func() {
+					Expect(apierrors.IsNotFound(getPod(2))).To(BeTrue())
+					Expect(getPod(0)).To(Succeed())
+					Expect(getPod(1)).To(Succeed())
+				})
+			})
+
+			Context("and the pod can't be deleted", func() {
+				BeforeEach(func() {
+					desync = true
+					deleteErr = fmt.Errorf("connection refused")
+				})
+
+				It("should resync the node", func() {
+					Ω(err).To(MatchError(ContainSubstring("connection refused")))
+					Expect(getPod(2)).To(Succeed())
+				})
+			})
+
+			Context("and the restarted pod rejoined with a new major version", func() {
+				BeforeEach(func() {
+					cluster.Status.Upgrade = &v1alpha1.RollingUpgradeStatus{
+						Phase:         v1alpha1.RollingUpgradeUpdating,
+						FromImage:     "image:10.5",
+						FromVersion:   "10.5.9-MariaDB",
+						CurrentPod:    stsName + "-2",
+						StepStartTime: &metav1.Time{Time: time.Now()},
+					}
+					pods[2] = galeraPod(2, "new", "image:10.6", true)
+					version = "10.6.3-MariaDB"
+				})
+
+				It("should run mariadb-upgrade on the node", func() {
+					Ω(err).To(BeNil())
+					var job batchv1.Job
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-upgrade-2", Namespace: Namespace}, &job)).To(Succeed())
+					container := job.Spec.Template.Spec.Containers[0]
+					Expect(container.Image).To(Equal("image:10.6"))
+					Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "MYSQL_HOST", Value: "10.0.0.3"}))
+					Expect(getCluster().Status.Upgrade.CurrentPod).To(Equal(stsName + "-2"))
+				})
+			})
+
+			Context("and the restarted pod rejoined with the same image", func() {
+				BeforeEach(func() {
+					cluster.Status.Upgrade = &v1alpha1.RollingUpgradeStatus{
+						Phase:         v1alpha1.RollingUpgradeUpdating,
+						FromImage:     "image:10.6",
+						FromVersion:   "10.5.9-MariaDB",
+						CurrentPod:    stsName + "-2",
+						StepStartTime: &metav1.Time{Time: time.Now()},
+					}
+					pods = []runtime.Object{
+						galeraPod(0, "old", "image:10.6", true),
+						galeraPod(1, "old", "image:10.6", true),
+						galeraPod(2, "new", "image:10.6", true),
+					}
+					version = "10.6.3-MariaDB"
+					desync = true
+				})
+
+				It("should restart the next pod without running mariadb-upgrade", func() {
+					Ω(err).To(BeNil())
+					var job batchv1.Job
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-upgrade-2", Namespace: Namespace}, &job)
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+					Expect(getCluster().Status.Upgrade.CurrentPod).To(Equal(stsName + "-1"))
+				})
+			})
+
+			Context("and mariadb-upgrade finished", func() {
+				BeforeEach(func() {
+					cluster.Status.Upgrade = &v1alpha1.RollingUpgradeStatus{
+						Phase:         v1alpha1.RollingUpgradeUpdating,
+						FromImage:     "image:10.5",
+						FromVersion:   "10.5.9-MariaDB",
+						CurrentPod:    stsName + "-2",
+						StepStartTime: &metav1.Time{Time: time.Now()},
+					}
+					pods[2] = galeraPod(2, "new", "image:10.6", true)
+					objects = append(objects, &batchv1.Job{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      stsName + "-upgrade-2",
+							Namespace: Namespace,
+						},
+						Status: batchv1.JobStatus{Succeeded: 1},
+					})
+					version = "10.6.3-MariaDB"
+					desync = true
+				})
+
+				It("should continue with the next pod", func() {
+					Ω(err).To(BeNil())
+					Expect(<-recorder.Events).To(ContainSubstring("SystemTablesUpgraded"))
+					var job batchv1.Job
+					err = cl.Get(context.TODO(), types.NamespacedName{Name: stsName + "-upgrade-2", Namespace: Namespace}, &job)
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+					Expect(getCluster().Status.Upgrade.CurrentPod).To(Equal(stsName + "-1"))
+					Expect(apierrors.IsNotFound(getPod(1))).To(BeTrue())
+				})
+			})
+
+			Context("and the restarted pod didn't rejoin in time", func() {
+				BeforeEach(func() {
+					cluster.Status.Upgrade = &v1alpha1.RollingUpgradeStatus{
+						Phase:         v1alpha1.RollingUpgradeUpdating,
+						FromImage:     "image:10.5",
+						CurrentPod:    stsName + "-2",
+						StepStartTime: &metav1.Time{Time: time.Now().Add(-20 * time.Minute)},
+					}
+					pods[2] = galeraPod(2, "new", "image:10.6", false)
+				})
+
+				It("should pause the upgrade", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.Upgrade.Phase).To(Equal(v1alpha1.RollingUpgradePaused))
+					Expect(meta.IsStatusConditionTrue(c.Status.Conditions, v1alpha1.ClusterConditionUpgradePaused)).To(BeTrue())
+					Expect(<-recorder.Events).To(ContainSubstring("UpgradePaused"))
+					Expect(getPod(1)).To(Succeed())
+				})
+			})
+
+			Context("and the paused upgrade is resumed", func() {
+				BeforeEach(func() {
+					cluster.Annotations = map[string]string{controllers.UpgradeAnnotation: controllers.UpgradeResume}
+					cluster.Status.Upgrade = &v1alpha1.RollingUpgradeStatus{
+						Phase:         v1alpha1.RollingUpgradePaused,
+						FromImage:     "image:10.5",
+						CurrentPod:    stsName + "-2",
+						StepStartTime: &metav1.Time{Time: time.Now().Add(-20 * time.Minute)},
+					}
+					pods[2] = galeraPod(2, "new", "image:10.6", false)
+				})
+
+				It("should wait for the pod again", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Annotations).NotTo(HaveKey(controllers.UpgradeAnnotation))
+					Expect(c.Status.Upgrade.Phase).To(Equal(v1alpha1.RollingUpgradeUpdating))
+					Expect(meta.IsStatusConditionFalse(c.Status.Conditions, v1alpha1.ClusterConditionUpgradePaused)).To(BeTrue())
+					Expect(<-recorder.Events).To(ContainSubstring("UpgradeResumed"))
+				})
+			})
+
+			Context("and the paused upgrade is rolled back", func() {
+				BeforeEach(func() {
+					cluster.Annotations = map[string]string{controllers.UpgradeAnnotation: controllers.UpgradeRollback}
+					cluster.Status.Upgrade = &v1alpha1.RollingUpgradeStatus{
+						Phase:      v1alpha1.RollingUpgradePaused,
+						FromImage:  "image:10.5",
+						ToImage:    "image:10.6",
+						CurrentPod: stsName + "-2",
+					}
+					pods[2] = galeraPod(2, "new", "image:10.6", false)
+				})
+
+				It("should restore the previous image", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Annotations).NotTo(HaveKey(controllers.UpgradeAnnotation))
+					Expect(c.Spec.Image).To(Equal("image:10.5"))
+					Expect(c.Status.Upgrade.Phase).To(Equal(v1alpha1.RollingUpgradeUpdating))
+					Expect(c.Status.Upgrade.ToImage).To(Equal("image:10.5"))
+					Expect(<-recorder.Events).To(ContainSubstring("UpgradeRolledBack"))
+
+					var sts appsv1.StatefulSet
+					Expect(cl.Get(context.TODO(), types.NamespacedName{Name: stsName, Namespace: Namespace}, &sts)).To(Succeed())
+					Expect(sts.Spec.Template.Spec.Containers[0].Image).To(Equal("image:10.5"))
+				})
+			})
+
+			Context("and all pods run the new revision", func() {
+				BeforeEach(func() {
+					cluster.Status.Upgrade = &v1alpha1.RollingUpgradeStatus{
+						Phase:     v1alpha1.RollingUpgradeUpdating,
+						FromImage: "image:10.5",
+					}
+					pods = []runtime.Object{
+						galeraPod(0, "new", "image:10.6", true),
+						galeraPod(1, "new", "image:10.6", true),
+						galeraPod(2, "new", "image:10.6", true),
+					}
+				})
+
+				It("should complete the upgrade", func() {
+					Ω(err).To(BeNil())
+					c := getCluster()
+					Expect(c.Status.Upgrade.Phase).To(Equal(v1alpha1.RollingUpgradeCompleted))
+					Expect(c.Status.Upgrade.FinishTime).NotTo(BeNil())
+					Expect(meta.FindStatusCondition(c.Status.Conditions, v1alpha1.ClusterConditionUpgradePaused).Reason).To(Equal("Completed"))
+					Expect(<-recorder.Events).To(ContainSubstring("UpgradeCompleted"))
+				})
+			})
+		})
 	})
 })
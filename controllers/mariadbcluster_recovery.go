@@ -0,0 +1,471 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/aldor007/mariadb-operator/resources/primary"
+	"github.com/aldor007/mariadb-operator/resources/recovery"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"time"
+)
+
+// reconcileRecovery bootstraps the galera cluster again when no node has been part of a primary component for
+// the cluster down timeout, e.g. after all pods were restarted at once. Galera lets only the node which left
+// the cluster last bootstrap it, so after a crash of all nodes none of them starts on its own.
+//
+// The recovery stops the statefulset pods, reads seqno of every volume using jobs and starts the node with
+// the highest seqno as a separate pod with --wsrep-new-cluster. The statefulset starts the pods one by one,
+// so the pods preceding the bootstrap node are started first and join it, then the bootstrap pod is stopped
+// and the statefulset starts the remaining pods. When the first node bootstraps the cluster there are no preceding
+// pods, the volume of the second node joins it using a separate pod instead and keeps the primary component
+// while the first statefulset pod takes over the volume of the bootstrap pod.
+func (r *MariaDBClusterReconciler) reconcileRecovery(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	if !cluster.IsRecovering() {
+		start, err := r.shouldStartRecovery(ctx, cluster)
+		if err != nil || !start {
+			return err
+		}
+
+		timeout := cluster.GetClusterDownTimeout()
+		log.Info("no galera node is part of a primary component, starting recovery", "timeout", timeout)
+		now := metav1.Now()
+		cluster.Status.Recovery = &mariadbv1alpha1.GaleraRecoveryStatus{
+			Phase:     mariadbv1alpha1.GaleraRecoveryScalingDown,
+			StartTime: &now,
+			Message:   "stopping galera pods",
+		}
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "GaleraRecoveryStarted",
+			"No node has been part of a primary component for %s, stopping galera pods to recover the cluster", timeout)
+		return nil
+	}
+
+	if !cluster.IsRecoveryEnabled() {
+		return r.failRecovery(ctx, cluster, "recovery was disabled", log)
+	}
+
+	sts, err := primary.NewPrimary(r.Client, r.DirectClient, r.Scheme, cluster).CreateStatefulSet("primary")
+	if err != nil {
+		return err
+	}
+
+	log = log.WithValues("phase", cluster.Status.Recovery.Phase)
+	switch cluster.Status.Recovery.Phase {
+	case mariadbv1alpha1.GaleraRecoveryScalingDown:
+		return r.startRecoveryJobs(ctx, cluster, &sts, log)
+	case mariadbv1alpha1.GaleraRecoveryRecovering:
+		return r.electBootstrapNode(ctx, cluster, &sts, log)
+	case mariadbv1alpha1.GaleraRecoveryBootstrapping:
+		return r.bootstrapCluster(ctx, cluster, &sts, log)
+	case mariadbv1alpha1.GaleraRecoveryRejoining:
+		return r.completeRecovery(ctx, cluster, &sts, log)
+	case mariadbv1alpha1.GaleraRecoveryHandover:
+		return r.handOverCluster(ctx, cluster, &sts, log)
+	}
+
+	return nil
+}
+
+// shouldStartRecovery checks if the cluster has been without primary component for the cluster down timeout.
+// Pods reported ready by kubernetes are running fine, the operator may just not be able to connect to them.
+func (r *MariaDBClusterReconciler) shouldStartRecovery(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster) (bool, error) {
+	if !cluster.IsRecoveryEnabled() || cluster.Spec.PrimaryCount == 0 {
+		return false, nil
+	}
+
+	condition := meta.FindStatusCondition(cluster.Status.Conditions, mariadbv1alpha1.ClusterConditionQuorumLost)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		return false, nil
+	}
+	since := condition.LastTransitionTime.Time
+	// a failed recovery is tried again after the timeout
+	if cluster.Status.Recovery != nil && cluster.Status.Recovery.FinishTime != nil && cluster.Status.Recovery.FinishTime.After(since) {
+		since = cluster.Status.Recovery.FinishTime.Time
+	}
+	if time.Since(since) < cluster.GetClusterDownTimeout() {
+		return false, nil
+	}
+
+	pods, err := r.listPods(ctx, cluster, "primary")
+	if err != nil {
+		return false, err
+	}
+	for i := range pods {
+		if isPodReady(&pods[i]) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// startRecoveryJobs creates jobs reading galera state of the volumes once all galera pods are stopped
+func (r *MariaDBClusterReconciler) startRecoveryJobs(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, log logr.Logger) error {
+	pods, err := r.listPods(ctx, cluster, "primary")
+	if err != nil {
+		return err
+	}
+	if len(pods) > 0 {
+		cluster.Status.Recovery.Message = fmt.Sprintf("waiting for %d galera pods to stop", len(pods))
+		return nil
+	}
+
+	jobs := 0
+	for ordinal := int32(0); ordinal < cluster.Spec.PrimaryCount; ordinal++ {
+		// pods which were never started have no volume to recover
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Name: recovery.ClaimName(sts, ordinal), Namespace: cluster.Namespace}, pvc)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		job := recovery.NewJob(cluster, sts, ordinal)
+		if err := controllerutil.SetControllerReference(cluster, job, r.Scheme); err != nil {
+			return err
+		}
+		log.Info("creating galera recovery job", "job", job.Name)
+		if err := r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create recovery job, err: %s", err)
+		}
+		jobs++
+	}
+	if jobs == 0 {
+		return r.failRecovery(ctx, cluster, "no galera volume found", log)
+	}
+
+	cluster.Status.Recovery.Phase = mariadbv1alpha1.GaleraRecoveryRecovering
+	cluster.Status.Recovery.Message = fmt.Sprintf("reading galera state of %d volumes", jobs)
+	return nil
+}
+
+// electBootstrapNode collects galera state recovered by the jobs and picks the node the cluster is bootstrapped from
+func (r *MariaDBClusterReconciler) electBootstrapNode(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, log logr.Logger) error {
+	nodes := []mariadbv1alpha1.GaleraNodeState{}
+	running := 0
+	for ordinal := int32(0); ordinal < cluster.Spec.PrimaryCount; ordinal++ {
+		job := &batchv1.Job{}
+		err := r.Get(ctx, types.NamespacedName{Name: recovery.JobName(cluster, ordinal), Namespace: cluster.Namespace}, job)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if isJobFailed(job) {
+			return r.failRecovery(ctx, cluster, fmt.Sprintf("recovery job %s failed", job.Name), log)
+		}
+		if job.Status.Succeeded == 0 {
+			running++
+			continue
+		}
+
+		state, err := r.getRecoveredState(ctx, job)
+		if err != nil {
+			return r.failRecovery(ctx, cluster, err.Error(), log)
+		}
+		node := mariadbv1alpha1.GaleraNodeState{
+			Name:            fmt.Sprintf("%s-%d", sts.Name, ordinal),
+			Seqno:           state.Seqno,
+			SafeToBootstrap: state.SafeToBootstrap,
+		}
+		if state.HasState() {
+			node.UUID = state.UUID
+		}
+		log.Info("recovered galera state", "pod", node.Name, "uuid", node.UUID, "seqno", node.Seqno, "safeToBootstrap", node.SafeToBootstrap)
+		nodes = append(nodes, node)
+	}
+
+	if running > 0 {
+		cluster.Status.Recovery.Message = fmt.Sprintf("waiting for %d recovery jobs", running)
+		return nil
+	}
+	cluster.Status.Recovery.Nodes = nodes
+
+	elected, err := pickBootstrapNode(nodes)
+	if err != nil {
+		return r.failRecovery(ctx, cluster, err.Error(), log)
+	}
+
+	log.Info("elected galera bootstrap node", "pod", elected.Name, "seqno", elected.Seqno)
+	cluster.Status.Recovery.BootstrapNode = elected.Name
+	cluster.Status.Recovery.Phase = mariadbv1alpha1.GaleraRecoveryBootstrapping
+	cluster.Status.Recovery.Message = fmt.Sprintf("bootstrapping new cluster from %s", elected.Name)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "BootstrapNodeElected",
+		"%s has the highest seqno %d of %d recovered nodes, bootstrapping the cluster from it", elected.Name, elected.Seqno, len(nodes))
+
+	return r.deleteRecoveryJobs(ctx, cluster)
+}
+
+// getRecoveredState parses grastate.dat written by the job into the termination message of its pod
+func (r *MariaDBClusterReconciler) getRecoveredState(ctx context.Context, job *batchv1.Job) (*mysql.GaleraState, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.State.Terminated == nil {
+				continue
+			}
+			state, err := mysql.ParseGaleraState(container.State.Terminated.Message)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse galera state recovered by %s, err: %s", job.Name, err)
+			}
+			return state, nil
+		}
+	}
+
+	return nil, fmt.Errorf("recovery job %s has no pod with galera state", job.Name)
+}
+
+// pickBootstrapNode returns the node with the highest seqno, the node marked safe to bootstrap
+// or the first one wins when there are more of them
+func pickBootstrapNode(nodes []mariadbv1alpha1.GaleraNodeState) (*mariadbv1alpha1.GaleraNodeState, error) {
+	var elected *mariadbv1alpha1.GaleraNodeState
+	for i := range nodes {
+		node := &nodes[i]
+		if node.UUID == "" {
+			continue
+		}
+		if elected != nil && elected.UUID != node.UUID {
+			return nil, fmt.Errorf("nodes %s and %s belong to different clusters", elected.Name, node.Name)
+		}
+
+		if elected == nil || node.Seqno > elected.Seqno || (node.Seqno == elected.Seqno && node.SafeToBootstrap && !elected.SafeToBootstrap) {
+			elected = node
+		}
+	}
+	if elected == nil {
+		return nil, errors.New("no volume has galera state")
+	}
+
+	return elected, nil
+}
+
+// bootstrapCluster starts the bootstrap pod and waits until it forms the new primary component
+func (r *MariaDBClusterReconciler) bootstrapCluster(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, log logr.Logger) error {
+	bootstrapNode := cluster.Status.Recovery.BootstrapNode
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: recovery.BootstrapPodName(cluster), Namespace: cluster.Namespace}, pod)
+	if apierrors.IsNotFound(err) {
+		pod = recovery.NewBootstrapPod(cluster, sts, mariadbv1alpha1.PodOrdinal(bootstrapNode))
+		if err := controllerutil.SetControllerReference(cluster, pod, r.Scheme); err != nil {
+			return err
+		}
+
+		log.Info("creating galera bootstrap pod", "pod", pod.Name, "volume", bootstrapNode)
+		return r.Create(ctx, pod)
+	} else if err != nil {
+		return err
+	}
+
+	switch {
+	case pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded:
+		return r.failRecovery(ctx, cluster, fmt.Sprintf("bootstrap pod %s stopped", pod.Name), log)
+	case !isPodReady(pod):
+		cluster.Status.Recovery.Message = fmt.Sprintf("waiting for %s to bootstrap new cluster from %s", pod.Name, bootstrapNode)
+		return nil
+	}
+
+	preceding := mariadbv1alpha1.PodOrdinal(bootstrapNode)
+	cluster.Status.Recovery.Phase = mariadbv1alpha1.GaleraRecoveryRejoining
+	cluster.Status.Recovery.Message = fmt.Sprintf("waiting for %d pods to join %s", preceding, pod.Name)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "ClusterBootstrapped", "New cluster was bootstrapped from %s", bootstrapNode)
+
+	return nil
+}
+
+// completeRecovery stops the bootstrap pod once the pods preceding it joined the cluster, the statefulset then starts
+// the bootstrap node and the rest of the pods. The new cluster has to keep its primary component after the bootstrap
+// pod stops, so at least one other node has to be synced when there are more of them. The first node has no preceding
+// pods, the volume of the second one joins the cluster using a separate pod and the first pod is handed over to it.
+func (r *MariaDBClusterReconciler) completeRecovery(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, log logr.Logger) error {
+	pods, err := r.listPods(ctx, cluster, "primary")
+	if err != nil {
+		return err
+	}
+	preceding := mariadbv1alpha1.PodOrdinal(cluster.Status.Recovery.BootstrapNode)
+	required := preceding
+	if required == 0 && cluster.Spec.PrimaryCount > 1 {
+		required = 1
+	}
+
+	joined := int32(0)
+	for i := range pods {
+		if pods[i].Name != recovery.BootstrapPodName(cluster) && isPodReady(&pods[i]) && isNodeSynced(cluster, pods[i].Name) {
+			joined++
+		}
+	}
+	if joined < required {
+		if preceding == 0 {
+			return r.startJoinerPod(ctx, cluster, sts, log)
+		}
+		cluster.Status.Recovery.Message = fmt.Sprintf("%d of %d pods joined the bootstrapped cluster", joined, required)
+		return nil
+	}
+
+	stopped, err := r.stopRecoveryPod(ctx, cluster, recovery.BootstrapPodName(cluster), log)
+	if err != nil || !stopped {
+		return err
+	}
+
+	if preceding == 0 && required > 0 {
+		cluster.Status.Recovery.Phase = mariadbv1alpha1.GaleraRecoveryHandover
+		cluster.Status.Recovery.Message = fmt.Sprintf("starting %s-0 joining %s", sts.Name, recovery.JoinerPodName(cluster))
+		return nil
+	}
+
+	return r.finishRecovery(cluster, log)
+}
+
+// startJoinerPod starts the pod joining the cluster bootstrapped from the volume of the first pod with the volume
+// of the second one and waits until it's synced
+func (r *MariaDBClusterReconciler) startJoinerPod(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, log logr.Logger) error {
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: recovery.JoinerPodName(cluster), Namespace: cluster.Namespace}, pod)
+	if apierrors.IsNotFound(err) {
+		pod = recovery.NewJoinerPod(cluster, sts, 1)
+		if err := controllerutil.SetControllerReference(cluster, pod, r.Scheme); err != nil {
+			return err
+		}
+
+		log.Info("creating galera joiner pod", "pod", pod.Name, "volume", fmt.Sprintf("%s-1", sts.Name))
+		cluster.Status.Recovery.Message = fmt.Sprintf("starting %s to join the bootstrapped cluster", pod.Name)
+		return r.Create(ctx, pod)
+	} else if err != nil {
+		return err
+	}
+
+	if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+		return r.failRecovery(ctx, cluster, fmt.Sprintf("joiner pod %s stopped", pod.Name), log)
+	}
+	cluster.Status.Recovery.Message = fmt.Sprintf("waiting for %s to join the bootstrapped cluster", pod.Name)
+	return nil
+}
+
+// handOverCluster stops the joiner pod once the first statefulset pod joined it, the statefulset then starts
+// the rest of the pods
+func (r *MariaDBClusterReconciler) handOverCluster(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, log logr.Logger) error {
+	first := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("%s-0", sts.Name), Namespace: cluster.Namespace}, first)
+	if apierrors.IsNotFound(err) || (err == nil && !(isPodReady(first) && isNodeSynced(cluster, first.Name))) {
+		cluster.Status.Recovery.Message = fmt.Sprintf("waiting for %s-0 to join %s", sts.Name, recovery.JoinerPodName(cluster))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	stopped, err := r.stopRecoveryPod(ctx, cluster, recovery.JoinerPodName(cluster), log)
+	if err != nil || !stopped {
+		return err
+	}
+
+	return r.finishRecovery(cluster, log)
+}
+
+// stopRecoveryPod deletes the pod started by the recovery and reports if it's gone
+func (r *MariaDBClusterReconciler) stopRecoveryPod(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, name string, log logr.Logger) (bool, error) {
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: cluster.Namespace}, pod)
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// galera nodes leaving gracefully keep the primary component, the last one marks itself safe to bootstrap
+	if pod.DeletionTimestamp == nil {
+		log.Info("stopping galera recovery pod", "pod", pod.Name)
+		if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	cluster.Status.Recovery.Message = fmt.Sprintf("waiting for %s to stop", pod.Name)
+	return false, nil
+}
+
+// finishRecovery marks the recovery completed, the statefulset starts all pods again
+func (r *MariaDBClusterReconciler) finishRecovery(cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	now := metav1.Now()
+	cluster.Status.Recovery.Phase = mariadbv1alpha1.GaleraRecoveryCompleted
+	cluster.Status.Recovery.FinishTime = &now
+	cluster.Status.Recovery.Message = fmt.Sprintf("cluster was bootstrapped from %s", cluster.Status.Recovery.BootstrapNode)
+	log.Info("galera recovery completed", "bootstrapNode", cluster.Status.Recovery.BootstrapNode)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "GaleraRecovered",
+		"Cluster was bootstrapped from %s, starting remaining galera pods", cluster.Status.Recovery.BootstrapNode)
+
+	return nil
+}
+
+// failRecovery stops the recovery and removes its jobs and pods, the statefulset pods are started again
+func (r *MariaDBClusterReconciler) failRecovery(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, message string, log logr.Logger) error {
+	log.Info("galera recovery failed", "reason", message)
+	now := metav1.Now()
+	cluster.Status.Recovery.Phase = mariadbv1alpha1.GaleraRecoveryFailed
+	cluster.Status.Recovery.FinishTime = &now
+	cluster.Status.Recovery.Message = message
+	r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "GaleraRecoveryFailed", "Recovery of the cluster failed: %s", message)
+
+	if err := r.deleteRecoveryJobs(ctx, cluster); err != nil {
+		return err
+	}
+
+	for _, name := range []string{recovery.BootstrapPodName(cluster), recovery.JoinerPodName(cluster)} {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cluster.Namespace,
+			},
+		}
+		if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteRecoveryJobs removes the jobs of the recovery together with their pods
+func (r *MariaDBClusterReconciler) deleteRecoveryJobs(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster) error {
+	for ordinal := int32(0); ordinal < cluster.Spec.PrimaryCount; ordinal++ {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      recovery.JobName(cluster, ordinal),
+				Namespace: cluster.Namespace,
+			},
+		}
+		err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete recovery job, err: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func isJobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
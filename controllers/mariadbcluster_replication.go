@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reconcileReplication attaches every replica pod to the galera primary set and records the replication status
+func (r *MariaDBClusterReconciler) reconcileReplication(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	pods, err := r.listPods(ctx, cluster, "replica")
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		cluster.Status.Replicas = nil
+		return nil
+	}
+
+	cfg, err := mysql.NewConfigFromClusterKey(ctx, r.Client, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace})
+	if err != nil {
+		return err
+	}
+
+	replicationUser, replicationPassword, err := r.getReplicationCredentials(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	primaryHost := cluster.GetPrimaryHeadlessAddress()
+	userCreated := false
+	replicas := make([]mariadbv1alpha1.MariaDBReplicaStatus, 0, len(pods))
+	for _, pod := range pods {
+		replicaStatus := mariadbv1alpha1.MariaDBReplicaStatus{Name: pod.Name}
+		if pod.Status.PodIP == "" {
+			replicaStatus.Message = "pod has no IP assigned"
+			replicas = append(replicas, replicaStatus)
+			continue
+		}
+
+		status, err := r.getReplicaStatus(ctx, cfg.WithHost(pod.Status.PodIP))
+		if err != nil {
+			log.V(1).Info("unable to read replica status", "pod", pod.Name, "err", err.Error())
+			replicaStatus.Message = err.Error()
+			replicas = append(replicas, replicaStatus)
+			continue
+		}
+
+		if status == nil || status.MasterHost != primaryHost {
+			// the replication user is needed only when a replica has to be (re)configured
+			if !userCreated {
+				if err = r.createReplicationUser(ctx, cfg, replicationUser, replicationPassword); err != nil {
+					return err
+				}
+				userCreated = true
+			}
+
+			log.Info("configuring replication", "pod", pod.Name, "primary", primaryHost)
+			status, err = r.configureReplica(ctx, cfg.WithHost(pod.Status.PodIP), primaryHost, cfg.Port, replicationUser, replicationPassword)
+			if err != nil {
+				replicaStatus.Message = err.Error()
+				replicas = append(replicas, replicaStatus)
+				continue
+			}
+		}
+
+		if status != nil {
+			replicaStatus.IORunning = status.IORunning
+			replicaStatus.SQLRunning = status.SQLRunning
+			replicaStatus.SecondsBehindMaster = status.SecondsBehindMaster
+			replicaStatus.GtidIOPos = status.GtidIOPos
+			replicaStatus.Message = status.LastIOError
+			if status.LastSQLError != "" {
+				replicaStatus.Message = status.LastSQLError
+			}
+		}
+		replicas = append(replicas, replicaStatus)
+	}
+
+	cluster.Status.Replicas = replicas
+	return nil
+}
+
+func (r *MariaDBClusterReconciler) getReplicationCredentials(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster) (string, string, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: cluster.GetOperatorSecretName(), Namespace: cluster.Namespace}, secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	user := string(secret.Data["REPLICATION_USER"])
+	password := string(secret.Data["REPLICATION_PASSWORD"])
+	if user == "" || password == "" {
+		return "", "", fmt.Errorf("missing replication credentials in secret %s", secret.Name)
+	}
+
+	return user, password, nil
+}
+
+func (r *MariaDBClusterReconciler) createReplicationUser(ctx context.Context, cfg *mysql.Config, user, password string) error {
+	sql, closeConn, err := r.SQLRunnerFactory(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	permissions := []mariadbv1alpha1.MariaDBPermission{
+		{
+			Schema:      "*",
+			Tables:      []string{"*"},
+			Permissions: []string{"REPLICATION SLAVE"},
+		},
+	}
+
+	return mysql.CreateUserIfNotExists(ctx, sql, user, password, []string{"%"}, permissions, mariadbv1alpha1.MariaDBUserLimits{})
+}
+
+func (r *MariaDBClusterReconciler) getReplicaStatus(ctx context.Context, cfg *mysql.Config) (*mysql.ReplicaStatus, error) {
+	sql, closeConn, err := r.SQLRunnerFactory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	return mysql.GetReplicaStatus(ctx, sql)
+}
+
+func (r *MariaDBClusterReconciler) configureReplica(ctx context.Context, cfg *mysql.Config, primaryHost string, port int32, user, password string) (*mysql.ReplicaStatus, error) {
+	sql, closeConn, err := r.SQLRunnerFactory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	if err = mysql.ConfigureReplication(ctx, sql, primaryHost, port, user, password); err != nil {
+		return nil, err
+	}
+
+	return mysql.GetReplicaStatus(ctx, sql)
+}
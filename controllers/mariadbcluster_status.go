@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+)
+
+// updateStatus publishes the status gathered during the reconcile if it differs from oldStatus
+func (r *MariaDBClusterReconciler) updateStatus(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, oldStatus *mariadbv1alpha1.MariaDBClusterStatus) error {
+	cluster.Status.ObservedGeneration = cluster.Generation
+
+	if reflect.DeepEqual(oldStatus, &cluster.Status) {
+		return nil
+	}
+
+	return r.Status().Update(ctx, cluster)
+}
+
+// listPods returns pods of the given type sorted by name
+func (r *MariaDBClusterReconciler) listPods(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, dbType string) ([]corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(cluster.Namespace),
+		client.MatchingLabels{"mariadb/pods": cluster.GetStatefulsetName(dbType)})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+
+	return pods.Items, nil
+}
+
+// refreshGaleraStatus queries every primary pod for its galera state and sets nodes and conditions in the cluster status
+func (r *MariaDBClusterReconciler) refreshGaleraStatus(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	pods, err := r.listPods(ctx, cluster, "primary")
+	if err != nil {
+		return err
+	}
+
+	var cfg *mysql.Config
+	var cfgErr error
+	nodes := make([]mariadbv1alpha1.MariaDBNodeStatus, 0, len(pods))
+	clusterSize := int32(0)
+	syncedNodes := int32(0)
+	primaryNodes := 0
+	for _, pod := range pods {
+		node := mariadbv1alpha1.MariaDBNodeStatus{Name: pod.Name}
+		if pod.Status.PodIP == "" {
+			node.Message = "pod has no IP assigned"
+			nodes = append(nodes, node)
+			continue
+		}
+
+		// the config is loaded lazily, there is no need for the root password when there are no pods
+		if cfg == nil && cfgErr == nil {
+			cfg, cfgErr = mysql.NewConfigFromClusterKey(ctx, r.Client, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace})
+		}
+
+		galera, err := r.getGaleraStatus(ctx, cfg, cfgErr, pod.Status.PodIP)
+		if err != nil {
+			log.V(1).Info("unable to read galera status", "pod", pod.Name, "err", err.Error())
+			node.Message = err.Error()
+			nodes = append(nodes, node)
+			continue
+		}
+
+		node.Ready = galera.Ready
+		node.ClusterSize = galera.ClusterSize
+		node.LocalState = galera.LocalStateComment
+		node.ClusterStatus = galera.ClusterStatus
+		nodes = append(nodes, node)
+
+		if galera.ClusterStatus == mysql.GaleraClusterPrimary {
+			primaryNodes++
+			if galera.ClusterSize > clusterSize {
+				clusterSize = galera.ClusterSize
+			}
+		}
+		if galera.IsSynced() {
+			syncedNodes++
+		}
+	}
+
+	cluster.Status.Nodes = nodes
+	cluster.Status.ClusterSize = clusterSize
+	cluster.Status.SyncedNodes = syncedNodes
+
+	progressing, progressingMsg, err := r.isRollingOut(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionProgressing, progressing, "RollingOut", "RolloutComplete", progressingMsg)
+
+	if err := r.refreshScalingCondition(ctx, cluster); err != nil {
+		return err
+	}
+
+	quorumLost := len(pods) > 0 && primaryNodes == 0
+	setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionQuorumLost, quorumLost, "NoPrimaryComponent", "PrimaryComponentFound",
+		fmt.Sprintf("%d of %d nodes are part of a primary component", primaryNodes, len(pods)))
+
+	synced := len(pods) > 0 && int(syncedNodes) == len(pods)
+	setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionSynced, synced, "AllNodesSynced", "NodesNotSynced",
+		fmt.Sprintf("%d of %d nodes are synced", syncedNodes, len(pods)))
+
+	ready := synced && !quorumLost && syncedNodes == cluster.Spec.PrimaryCount
+	setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionReady, ready, "ClusterReady", "ClusterNotReady",
+		fmt.Sprintf("%d of %d primary nodes are ready", syncedNodes, cluster.Spec.PrimaryCount))
+
+	return nil
+}
+
+// refreshScalingCondition reports if the primary statefulset is being scaled towards the spec one node at a time
+func (r *MariaDBClusterReconciler) refreshScalingCondition(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster) error {
+	if err := cluster.ValidatePrimaryCount(); err != nil {
+		previous := meta.FindStatusCondition(cluster.Status.Conditions, mariadbv1alpha1.ClusterConditionScaling)
+		if previous == nil || previous.Reason != "ScalingRefused" {
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "ScalingRefused", "Refusing to scale the cluster: %s", err)
+		}
+		setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionScaling, false, "", "ScalingRefused", err.Error())
+		return nil
+	}
+	if cluster.IsRecovering() {
+		setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionScaling, false, "", "Recovering", "the recovery manages the galera nodes")
+		return nil
+	}
+
+	sts := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      cluster.GetStatefulsetName("primary"),
+		Namespace: cluster.Namespace,
+	}, sts)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	current := int32(0)
+	if err == nil && sts.Spec.Replicas != nil {
+		current = *sts.Spec.Replicas
+	}
+
+	desired := cluster.Spec.PrimaryCount
+	message := fmt.Sprintf("%d of %d primary nodes, %d synced", current, desired, cluster.Status.SyncedNodes)
+	switch {
+	case current < desired:
+		setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionScaling, true, "ScalingUp", "", message)
+	case current > desired:
+		setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionScaling, true, "ScalingDown", "", message)
+	default:
+		setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionScaling, false, "", "Scaled", message)
+	}
+
+	return nil
+}
+
+func (r *MariaDBClusterReconciler) getGaleraStatus(ctx context.Context, cfg *mysql.Config, cfgErr error, host string) (*mysql.GaleraStatus, error) {
+	if cfgErr != nil {
+		return nil, cfgErr
+	}
+
+	sql, closeConn, err := r.SQLRunnerFactory(cfg.WithHost(host))
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	return mysql.GetGaleraStatus(ctx, sql)
+}
+
+// isRollingOut checks if the primary statefulset has not converged to the desired state yet
+func (r *MariaDBClusterReconciler) isRollingOut(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster) (bool, string, error) {
+	sts := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      cluster.GetStatefulsetName("primary"),
+		Namespace: cluster.Namespace,
+	}, sts)
+	if errors.IsNotFound(err) {
+		return true, "statefulset not created yet", nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	desired := int32(1)
+	if sts.Spec.Replicas != nil {
+		desired = *sts.Spec.Replicas
+	}
+
+	switch {
+	case sts.Status.ObservedGeneration < sts.Generation:
+		return true, "statefulset spec change not observed yet", nil
+	case sts.Status.UpdateRevision != sts.Status.CurrentRevision:
+		return true, fmt.Sprintf("%d of %d pods updated", sts.Status.UpdatedReplicas, desired), nil
+	case sts.Status.ReadyReplicas != desired:
+		return true, fmt.Sprintf("%d of %d pods ready", sts.Status.ReadyReplicas, desired), nil
+	}
+
+	return false, "statefulset is up to date", nil
+}
+
+func setClusterCondition(cluster *mariadbv1alpha1.MariaDBCluster, conditionType string, value bool, trueReason, falseReason, message string) {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             falseReason,
+		Message:            message,
+		ObservedGeneration: cluster.Generation,
+	}
+	if value {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = trueReason
+	}
+
+	meta.SetStatusCondition(&cluster.Status.Conditions, condition)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources/primary"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reconcileTLSMode turns TLS of galera nodes on or off. A node with TLS can't join nodes without it, so the nodes
+// are restarted first with the dynamic socket accepting both and once all of them rejoined the cluster
+// they're restarted again with the requested setting. It has to run before the statefulsets are reconciled.
+func (r *MariaDBClusterReconciler) reconcileTLSMode(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	desired := cluster.GetDesiredTLSMode()
+	current := cluster.Status.TLSMode
+	if current == "" {
+		// clusters created before the mode was recorded, the certificate hash is set once the pods use TLS
+		current = mariadbv1alpha1.TLSModeDisabled
+		if desired == mariadbv1alpha1.TLSModeEnabled && cluster.Status.TLSCertificateHash != "" {
+			current = mariadbv1alpha1.TLSModeEnabled
+		}
+	}
+	if current == desired {
+		cluster.Status.TLSMode = current
+		return nil
+	}
+
+	pods, err := r.listPods(ctx, cluster, "primary")
+	if err != nil {
+		return err
+	}
+
+	if current != mariadbv1alpha1.TLSModeDynamic {
+		// pods of a new cluster start with the requested setting
+		if len(pods) == 0 {
+			cluster.Status.TLSMode = desired
+			return nil
+		}
+
+		log.Info("restarting galera nodes with dynamic TLS socket", "from", current, "to", desired)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "TLSRollout",
+			"Restarting galera nodes accepting connections with and without TLS before switching TLS to %s", desired)
+		cluster.Status.TLSMode = mariadbv1alpha1.TLSModeDynamic
+		return nil
+	}
+
+	restarted, err := r.isDynamicTLSRolledOut(ctx, cluster, pods)
+	if err != nil || !restarted {
+		return err
+	}
+
+	log.Info("all galera nodes accept connections with and without TLS", "to", desired)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "TLSRollout", "Restarting galera nodes with TLS %s", desired)
+	cluster.Status.TLSMode = desired
+
+	return nil
+}
+
+// isDynamicTLSRolledOut checks that every galera node was restarted with the dynamic TLS socket and is synced
+func (r *MariaDBClusterReconciler) isDynamicTLSRolledOut(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, pods []corev1.Pod) (bool, error) {
+	sts := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: cluster.GetStatefulsetName("primary"), Namespace: cluster.Namespace}, sts)
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// the cached statefulset can be older than the update with the dynamic socket
+	if sts.Spec.Template.Annotations[primary.TLSModeAnnotation] != string(mariadbv1alpha1.TLSModeDynamic) {
+		return false, nil
+	}
+	revision := sts.Status.UpdateRevision
+	if revision == "" || sts.Status.ObservedGeneration < sts.Generation {
+		return false, nil
+	}
+
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if int32(len(pods)) != replicas || len(outdatedPods(pods, revision)) > 0 {
+		return false, nil
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !isNodeSynced(cluster, pod.Name) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/aldor007/mariadb-operator/resources/upgrade"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"time"
+)
+
+const (
+	// UpgradeAnnotation set on the MariaDBCluster resumes or rolls back the paused upgrade, it's removed once it's done
+	UpgradeAnnotation = "mariadb/upgrade"
+	// UpgradeResume gives the restarted node another rejoin timeout
+	UpgradeResume = "resume"
+	// UpgradeRollback restarts the pods with the image they ran before the upgrade
+	UpgradeRollback = "rollback"
+)
+
+// handleUpgradeAnnotation resumes or rolls back the paused upgrade as requested by the annotation.
+// The rollback changes the image in the spec, so it has to run before the statefulset is reconciled.
+func (r *MariaDBClusterReconciler) handleUpgradeAnnotation(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	action, ok := cluster.Annotations[UpgradeAnnotation]
+	if !ok {
+		return nil
+	}
+
+	status := cluster.Status.Upgrade
+	rollback := action == UpgradeRollback && cluster.IsUpgrading() && status.FromImage != ""
+	// a patch doesn't conflict with the spec changed by the user in the meantime
+	patch := client.MergeFrom(cluster.DeepCopy())
+	delete(cluster.Annotations, UpgradeAnnotation)
+	if rollback {
+		cluster.Spec.Image = status.FromImage
+	}
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("failed to remove upgrade annotation, err: %s", err)
+	}
+	// the patch returns the stored status, the upgrade is changed afterwards
+	cluster.Status.Upgrade = status
+
+	now := metav1.Now()
+	switch {
+	case rollback:
+		log.Info("rolling back galera upgrade", "image", status.FromImage)
+		status.FromImage, status.ToImage = status.ToImage, status.FromImage
+		status.Phase = mariadbv1alpha1.RollingUpgradeUpdating
+		status.StepStartTime = &now
+		status.Message = fmt.Sprintf("rolling back to %s", status.ToImage)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "UpgradeRolledBack", "Restarting galera pods with %s", status.ToImage)
+	case action == UpgradeResume && status != nil && status.Phase == mariadbv1alpha1.RollingUpgradePaused:
+		log.Info("resuming galera upgrade", "pod", status.CurrentPod)
+		status.Phase = mariadbv1alpha1.RollingUpgradeUpdating
+		status.StepStartTime = &now
+		status.Message = fmt.Sprintf("waiting for %s to rejoin the cluster", status.CurrentPod)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "UpgradeResumed", "Waiting for %s to rejoin the cluster", status.CurrentPod)
+	default:
+		log.Info("ignoring upgrade annotation", "value", action)
+	}
+
+	return nil
+}
+
+// reconcileUpgrade rolls out a new revision of the primary statefulset, e.g. a new image. The statefulset uses
+// OnDelete strategy, so the operator restarts the outdated pods one at a time. The next node is desynced and
+// restarted only when all nodes are synced and mariadb-upgrade runs on the restarted node when the image and
+// the major version of the server changed. When a node doesn't rejoin the cluster in time the upgrade is paused until it's resumed
+// or rolled back using the upgrade annotation.
+func (r *MariaDBClusterReconciler) reconcileUpgrade(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	err := r.rollOutPrimary(ctx, cluster, log)
+
+	paused := cluster.Status.Upgrade != nil && cluster.Status.Upgrade.Phase == mariadbv1alpha1.RollingUpgradePaused
+	falseReason, message := "NoUpgrade", "the galera pods were never upgraded"
+	if cluster.Status.Upgrade != nil {
+		falseReason, message = string(cluster.Status.Upgrade.Phase), cluster.Status.Upgrade.Message
+	}
+	setClusterCondition(cluster, mariadbv1alpha1.ClusterConditionUpgradePaused, paused, string(mariadbv1alpha1.RollingUpgradePaused), falseReason, message)
+
+	return err
+}
+
+func (r *MariaDBClusterReconciler) rollOutPrimary(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) error {
+	// the recovery starts the pods with the current revision on its own
+	if cluster.IsRecovering() {
+		return nil
+	}
+
+	sts := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: cluster.GetStatefulsetName("primary"), Namespace: cluster.Namespace}, sts)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// the revision is known once the statefulset controller observed the spec
+	revision := sts.Status.UpdateRevision
+	if revision == "" || sts.Status.ObservedGeneration < sts.Generation {
+		return nil
+	}
+
+	pods, err := r.listPods(ctx, cluster, "primary")
+	if err != nil {
+		return err
+	}
+
+	if !cluster.IsUpgrading() {
+		outdated := outdatedPods(pods, revision)
+		if len(outdated) == 0 {
+			return nil
+		}
+
+		now := metav1.Now()
+		cluster.Status.Upgrade = &mariadbv1alpha1.RollingUpgradeStatus{
+			Phase:     mariadbv1alpha1.RollingUpgradeUpdating,
+			FromImage: serverImage(&outdated[0]),
+			StartTime: &now,
+		}
+		log.Info("starting galera upgrade", "revision", revision, "outdatedPods", len(outdated))
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "UpgradeStarted",
+			"Restarting %d galera pods with %s one at a time", len(outdated), cluster.Spec.Image)
+	}
+
+	status := cluster.Status.Upgrade
+	// the target changes when the spec is changed or rolled back during the upgrade
+	status.Revision = revision
+	status.ToImage = cluster.Spec.Image
+	if status.Phase == mariadbv1alpha1.RollingUpgradePaused {
+		return nil
+	}
+
+	log = log.WithValues("revision", revision)
+	if status.CurrentPod != "" {
+		rejoined, err := r.waitForRejoin(ctx, cluster, log)
+		if err != nil || !rejoined {
+			return err
+		}
+	}
+
+	return r.restartNextPod(ctx, cluster, sts, pods, log)
+}
+
+// restartNextPod desyncs and deletes the outdated pod with the highest ordinal, the statefulset creates it again
+// with the current revision. It's done only when all nodes are synced, so the cluster keeps quorum.
+func (r *MariaDBClusterReconciler) restartNextPod(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, pods []corev1.Pod, log logr.Logger) error {
+	status := cluster.Status.Upgrade
+	outdated := outdatedPods(pods, status.Revision)
+	if len(outdated) == 0 {
+		now := metav1.Now()
+		status.Phase = mariadbv1alpha1.RollingUpgradeCompleted
+		status.CurrentPod = ""
+		status.FinishTime = &now
+		status.Message = fmt.Sprintf("%d galera pods run %s", len(pods), status.ToImage)
+		log.Info("galera upgrade completed")
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "UpgradeCompleted", "All %d galera pods run %s", len(pods), status.ToImage)
+		return nil
+	}
+
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	// a node removed by scaling is leaving the cluster at the same time
+	if int32(len(pods)) != replicas {
+		status.Message = fmt.Sprintf("waiting for %d of %d galera pods", len(pods), replicas)
+		return nil
+	}
+	if int(cluster.Status.SyncedNodes) != len(pods) {
+		status.Message = fmt.Sprintf("waiting for %d of %d nodes to be synced", cluster.Status.SyncedNodes, len(pods))
+		return nil
+	}
+
+	// the pods are restarted in the same order as by the statefulset controller
+	pod := outdated[0]
+	for _, p := range outdated {
+		if mariadbv1alpha1.PodOrdinal(p.Name) > mariadbv1alpha1.PodOrdinal(pod.Name) {
+			pod = p
+		}
+	}
+	version, err := r.desyncNode(ctx, cluster, pod)
+	if err != nil {
+		log.Info("unable to desync galera node", "pod", pod.Name, "err", err.Error())
+		status.Message = fmt.Sprintf("unable to desync %s: %s", pod.Name, err)
+		return nil
+	}
+	if status.FromVersion == "" {
+		status.FromVersion = version
+	}
+
+	log.Info("restarting galera node", "pod", pod.Name, "outdatedPods", len(outdated))
+	if err := r.Delete(ctx, &pod); err != nil && !apierrors.IsNotFound(err) {
+		// the desynced node would never be counted as synced and the upgrade would wait for it forever
+		if resyncErr := r.resyncNode(ctx, cluster, pod); resyncErr != nil {
+			log.Info("unable to resync galera node", "pod", pod.Name, "err", resyncErr.Error())
+		}
+		return fmt.Errorf("failed to delete pod %s, err: %s", pod.Name, err)
+	}
+	now := metav1.Now()
+	status.CurrentPod = pod.Name
+	status.StepStartTime = &now
+	status.Message = fmt.Sprintf("restarting %s, %d outdated pods left", pod.Name, len(outdated)-1)
+
+	return nil
+}
+
+// waitForRejoin checks if the restarted pod runs the current revision and its node is synced again,
+// the upgrade is paused when it doesn't rejoin the cluster in time
+func (r *MariaDBClusterReconciler) waitForRejoin(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, log logr.Logger) (bool, error) {
+	status := cluster.Status.Upgrade
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: status.CurrentPod, Namespace: cluster.Namespace}, pod)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+
+	switch {
+	case apierrors.IsNotFound(err) || pod.DeletionTimestamp != nil:
+		status.Message = fmt.Sprintf("waiting for %s to be created again", status.CurrentPod)
+	case pod.Labels[appsv1.StatefulSetRevisionLabel] != status.Revision:
+		// the revision changed after the pod was created, e.g. the upgrade was rolled back
+		log.Info("restarting galera node with new revision", "pod", pod.Name)
+		if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to delete pod %s, err: %s", pod.Name, err)
+		}
+		status.Message = fmt.Sprintf("restarting %s", pod.Name)
+		return false, nil
+	case !isPodReady(pod) || !isNodeSynced(cluster, pod.Name):
+		status.Message = fmt.Sprintf("waiting for %s to rejoin the cluster", pod.Name)
+	default:
+		upgraded, err := r.upgradeSystemTables(ctx, cluster, pod, log)
+		if err != nil || !upgraded {
+			return false, err
+		}
+
+		log.Info("galera node rejoined the cluster", "pod", pod.Name)
+		status.CurrentPod = ""
+		status.StepStartTime = nil
+		return true, nil
+	}
+
+	if status.StepStartTime != nil && time.Since(status.StepStartTime.Time) > cluster.GetRejoinTimeout() {
+		r.pauseUpgrade(cluster, fmt.Sprintf("%s didn't rejoin the cluster in %s", status.CurrentPod, cluster.GetRejoinTimeout()), log)
+	}
+
+	return false, nil
+}
+
+// upgradeSystemTables runs mariadb-upgrade on the node when the image and the major version changed and waits
+// for it to finish
+func (r *MariaDBClusterReconciler) upgradeSystemTables(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, pod *corev1.Pod, log logr.Logger) (bool, error) {
+	status := cluster.Status.Upgrade
+	version, err := r.getServerVersion(ctx, cluster, pod.Status.PodIP)
+	if err != nil {
+		status.Message = fmt.Sprintf("unable to read server version of %s: %s", pod.Name, err)
+		return false, nil
+	}
+	// other changes of the statefulset, e.g. the config, are rolled out the same way without changing the server
+	if status.FromImage == status.ToImage || status.FromVersion == "" || mysql.MajorVersion(version) == mysql.MajorVersion(status.FromVersion) {
+		return true, nil
+	}
+
+	ordinal := mariadbv1alpha1.PodOrdinal(pod.Name)
+	job := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: upgrade.JobName(cluster, ordinal), Namespace: cluster.Namespace}, job)
+	if apierrors.IsNotFound(err) {
+		job = upgrade.NewJob(cluster, pod)
+		if err := controllerutil.SetControllerReference(cluster, job, r.Scheme); err != nil {
+			return false, err
+		}
+		log.Info("creating mariadb-upgrade job", "job", job.Name, "fromVersion", status.FromVersion, "version", version)
+		if err := r.Create(ctx, job); err != nil {
+			return false, fmt.Errorf("failed to create upgrade job, err: %s", err)
+		}
+		status.Message = fmt.Sprintf("running mariadb-upgrade on %s", pod.Name)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if isJobFailed(job) {
+		r.pauseUpgrade(cluster, fmt.Sprintf("mariadb-upgrade job %s failed", job.Name), log)
+		return false, nil
+	}
+	if job.Status.Succeeded == 0 {
+		status.Message = fmt.Sprintf("waiting for mariadb-upgrade on %s", pod.Name)
+		return false, nil
+	}
+
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "SystemTablesUpgraded",
+		"mariadb-upgrade finished on %s after upgrade from %s to %s", pod.Name, status.FromVersion, version)
+	err = r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete upgrade job, err: %s", err)
+	}
+
+	return true, nil
+}
+
+func (r *MariaDBClusterReconciler) pauseUpgrade(cluster *mariadbv1alpha1.MariaDBCluster, message string, log logr.Logger) {
+	log.Info("pausing galera upgrade", "reason", message)
+	cluster.Status.Upgrade.Phase = mariadbv1alpha1.RollingUpgradePaused
+	cluster.Status.Upgrade.Message = message
+	r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "UpgradePaused",
+		"%s, set annotation %s=%s or %s=%s to continue", message, UpgradeAnnotation, UpgradeResume, UpgradeAnnotation, UpgradeRollback)
+}
+
+// desyncNode returns the server version of the node and desyncs it before it's restarted
+func (r *MariaDBClusterReconciler) desyncNode(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, pod corev1.Pod) (string, error) {
+	sql, closeConn, err := r.connectNode(ctx, cluster, pod.Status.PodIP)
+	if err != nil {
+		return "", err
+	}
+	defer closeConn()
+
+	version, err := mysql.GetServerVersion(ctx, sql)
+	if err != nil {
+		return "", err
+	}
+
+	return version, mysql.DesyncNode(ctx, sql)
+}
+
+// resyncNode reverts desyncNode when the node wasn't restarted
+func (r *MariaDBClusterReconciler) resyncNode(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, pod corev1.Pod) error {
+	sql, closeConn, err := r.connectNode(ctx, cluster, pod.Status.PodIP)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	return mysql.ResyncNode(ctx, sql)
+}
+
+func (r *MariaDBClusterReconciler) getServerVersion(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, host string) (string, error) {
+	sql, closeConn, err := r.connectNode(ctx, cluster, host)
+	if err != nil {
+		return "", err
+	}
+	defer closeConn()
+
+	return mysql.GetServerVersion(ctx, sql)
+}
+
+// connectNode opens connection to the galera node as root
+func (r *MariaDBClusterReconciler) connectNode(ctx context.Context, cluster *mariadbv1alpha1.MariaDBCluster, host string) (mysql.SQLRunner, func(), error) {
+	cfg, err := mysql.NewConfigFromClusterKey(ctx, r.Client, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r.SQLRunnerFactory(cfg.WithHost(host))
+}
+
+// outdatedPods returns the pods not running the revision, the terminating ones are already being restarted
+func outdatedPods(pods []corev1.Pod, revision string) []corev1.Pod {
+	outdated := []corev1.Pod{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Labels[appsv1.StatefulSetRevisionLabel] != revision {
+			outdated = append(outdated, pod)
+		}
+	}
+	return outdated
+}
+
+// serverImage returns the image the pod runs mysqld with
+func serverImage(pod *corev1.Pod) string {
+	if len(pod.Spec.Containers) == 0 {
+		return ""
+	}
+	return pod.Spec.Containers[0].Image
+}
+
+// isNodeSynced checks the galera state of the pod read by the last status refresh
+func isNodeSynced(cluster *mariadbv1alpha1.MariaDBCluster, name string) bool {
+	for _, node := range cluster.Status.Nodes {
+		if node.Name == name {
+			return node.Ready && node.LocalState == mysql.GaleraStateSynced && node.ClusterStatus == mysql.GaleraClusterPrimary
+		}
+	}
+	return false
+}
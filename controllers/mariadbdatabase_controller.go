@@ -20,8 +20,12 @@ import (
 	"context"
 	"github.com/aldor007/mariadb-operator/mysql"
 	"github.com/aldor007/mariadb-operator/utils"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -33,6 +37,8 @@ import (
 
 const (
 	mariadbPreventDeletionFinalizer = "mariadb-operator.mkaciuba.com/database"
+	// databaseStatsInterval is how often number of tables and size of the database are refreshed
+	databaseStatsInterval = 5 * time.Minute
 )
 
 // MariaDBDatabaseReconciler reconciles a MariaDBDatabase object
@@ -40,12 +46,14 @@ type MariaDBDatabaseReconciler struct {
 	client.Client
 	Log              logr.Logger
 	Scheme           *runtime.Scheme
+	Recorder         record.EventRecorder
 	SQLRunnerFactory mysql.SQLRunnerFactory
 }
 
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbdatabases,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbdatabases/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbdatabases/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -69,11 +77,21 @@ func (r *MariaDBDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
 	}
-	// if the user has been deleted then remove it from mysql cluster
+	// if the database resource has been deleted then remove it from mysql cluster when it's requested
 	if !instance.ObjectMeta.DeletionTimestamp.IsZero() {
-		err = r.deleteDatabase(ctx, instance, log)
-		if err != nil {
-			return reconcile.Result{}, err
+		if !utils.HasFinalizer(&instance.ObjectMeta, mariadbPreventDeletionFinalizer) {
+			return reconcile.Result{}, nil
+		}
+
+		if instance.GetDeletionPolicy() == mariadbv1alpha1.DeletionPolicyDelete {
+			if err = r.deleteDatabase(ctx, instance, log); err != nil {
+				return reconcile.Result{}, err
+			}
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, "DatabaseDeleted", "Database %s was dropped", instance.Spec.Database)
+		} else {
+			log.Info("retaining MySQL database", "name", instance.Name, "database", instance.Spec.Database)
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, "DatabaseRetained",
+				"Database %s was left in the cluster because of %s deletion policy", instance.Spec.Database, instance.GetDeletionPolicy())
 		}
 
 		// remove finalizer
@@ -83,7 +101,13 @@ func (r *MariaDBDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return reconcile.Result{}, r.Update(ctx, instance)
 	}
 	// reconcile database in mysql
+	oldStatus := instance.Status.DeepCopy()
 	err = r.createDatabase(ctx, instance, log)
+	if !reflect.DeepEqual(oldStatus, &instance.Status) {
+		if errUpdate := r.Status().Update(ctx, instance); errUpdate != nil {
+			log.Error(errUpdate, "error updating status")
+		}
+	}
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -96,9 +120,9 @@ func (r *MariaDBDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}
 	}
 
-	return reconcile.Result{}, nil // r.updateReadyCondition(ctx, oldDBStatus, db, err)
-
+	return reconcile.Result{RequeueAfter: databaseStatsInterval}, nil
 }
+
 func (r *MariaDBDatabaseReconciler) deleteDatabase(ctx context.Context, db *mariadbv1alpha1.MariaDBDatabase, log logr.Logger) error {
 	log.Info("deleting MySQL database", "name", db.Name, "database", db.Spec.Database)
 
@@ -106,9 +130,7 @@ func (r *MariaDBDatabaseReconciler) deleteDatabase(ctx context.Context, db *mari
 	if errors.IsNotFound(err) {
 		// if the mysql cluster does not exists then we can safely assume that
 		// the db is deleted so exist successfully
-
-		return err
-
+		return nil
 	} else if err != nil {
 		return err
 	}
@@ -133,7 +155,34 @@ func (r *MariaDBDatabaseReconciler) createDatabase(ctx context.Context, db *mari
 	defer closeConn()
 
 	// Create database if does not exists
-	return mysql.CreateDatabaseIfNotExists(ctx, sql, db.Spec.Database, db.Spec.CharacterSet, db.Spec.Collation)
+	if err := mysql.CreateDatabaseIfNotExists(ctx, sql, db.Spec.Database, db.Spec.CharacterSet, db.Spec.Collation); err != nil {
+		return err
+	}
+
+	info, err := mysql.GetDatabase(ctx, sql, db.Spec.Database)
+	if err != nil {
+		return err
+	}
+
+	// defaults are used only for tables created later, existing tables are not converted
+	if mysql.DatabaseDefaultsDiffer(info, db.Spec.CharacterSet, db.Spec.Collation) {
+		log.Info("changing MySQL database defaults", "database", db.Spec.Database,
+			"characterSet", db.Spec.CharacterSet, "collation", db.Spec.Collation)
+		if err := mysql.AlterDatabaseDefaults(ctx, sql, db.Spec.Database, db.Spec.CharacterSet, db.Spec.Collation); err != nil {
+			return err
+		}
+
+		if info, err = mysql.GetDatabase(ctx, sql, db.Spec.Database); err != nil {
+			return err
+		}
+	}
+
+	db.Status.CharacterSet = info.CharacterSet
+	db.Status.Collation = info.Collation
+	db.Status.Tables = info.Tables
+	db.Status.SizeBytes = info.SizeBytes
+
+	return nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
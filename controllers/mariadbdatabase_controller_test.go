@@ -15,10 +15,12 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
 )
 
 type queryMatcher struct {
@@ -41,6 +43,17 @@ func EqQuery(q mysql.Query) gomock.Matcher {
 	return queryMatcher{query: q}
 }
 
+// databaseRow returns mocked QueryRow reading database from information_schema
+func databaseRow(info *mysql.DatabaseInfo) func(context.Context, mysql.Query, ...interface{}) error {
+	return func(_ context.Context, _ mysql.Query, dest ...interface{}) error {
+		*dest[0].(*string) = info.CharacterSet
+		*dest[1].(*string) = info.Collation
+		*dest[2].(*int32) = info.Tables
+		*dest[3].(*int64) = info.SizeBytes
+		return nil
+	}
+}
+
 var _ = Describe("MariadbDatabase Controller", func() {
 	const (
 		Namespace   = "default"
@@ -60,6 +73,7 @@ var _ = Describe("MariadbDatabase Controller", func() {
 			db       *v1alpha1.MariaDBDatabase
 			cluster  *v1alpha1.MariaDBCluster
 			mockCtrl *gomock.Controller
+			recorder *record.FakeRecorder
 		)
 
 		BeforeEach(func() {
@@ -70,6 +84,7 @@ var _ = Describe("MariadbDatabase Controller", func() {
 				},
 			}
 			s.AddKnownTypes(v1alpha1.GroupVersion, db)
+			recorder = record.NewFakeRecorder(10)
 		})
 
 		When("create Mariadb database", func() {
@@ -133,11 +148,18 @@ var _ = Describe("MariadbDatabase Controller", func() {
 				mockCtrl = gomock.NewController(GinkgoT())
 				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
 				sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", mysql.Escape(dbName))))).Return(nil)
+				sqlRunner.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(databaseRow(&mysql.DatabaseInfo{
+					CharacterSet: "latin1",
+					Collation:    "latin1_swedish_ci",
+					Tables:       2,
+					SizeBytes:    32768,
+				}))
 
 				r = &controllers.MariaDBDatabaseReconciler{
-					Client: cl,
-					Scheme: s,
-					Log:    logf.Log,
+					Client:   cl,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
 					SQLRunnerFactory: func(_ *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
 						return sqlRunner, func() {
 
@@ -155,8 +177,220 @@ var _ = Describe("MariadbDatabase Controller", func() {
 				Ω(err).To(BeNil())
 			})
 
-			It("shouldn't requeue the request", func() {
+			It("should requeue the request to refresh the stats", func() {
 				Ω(res.Requeue).To(BeFalse())
+				Ω(res.RequeueAfter).To(Equal(5 * time.Minute))
+			})
+
+			It("should report database in status", func() {
+				var d v1alpha1.MariaDBDatabase
+				err = cl.Get(context.TODO(), req.NamespacedName, &d)
+				Ω(err).To(BeNil())
+				Expect(d.Status).To(Equal(v1alpha1.MariaDBDatabaseStatus{
+					CharacterSet: "latin1",
+					Collation:    "latin1_swedish_ci",
+					Tables:       2,
+					SizeBytes:    32768,
+				}))
+			})
+		})
+
+		When("Mariadb database collation is changed", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				db = &v1alpha1.MariaDBDatabase{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      dbName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBDatabaseSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+						},
+						Database:     dbName,
+						CharacterSet: "utf8mb4",
+						Collation:    "utf8mb4_unicode_ci",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(db).Build()
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("CREATE DATABASE IF NOT EXISTS `db-name` CHARACTER SET ? COLLATE ?"))).Return(nil),
+					sqlRunner.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(databaseRow(&mysql.DatabaseInfo{
+						CharacterSet: "utf8mb4",
+						Collation:    "utf8mb4_general_ci",
+					})),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("ALTER DATABASE `db-name` CHARACTER SET ? COLLATE ?"))).Return(nil),
+					sqlRunner.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(databaseRow(&mysql.DatabaseInfo{
+						CharacterSet: "utf8mb4",
+						Collation:    "utf8mb4_unicode_ci",
+					})),
+				)
+
+				r = &controllers.MariaDBDatabaseReconciler{
+					Client:   cl,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
+					SQLRunnerFactory: func(_ *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			It("should alter database and report new collation", func() {
+				Ω(err).To(BeNil())
+				var d v1alpha1.MariaDBDatabase
+				err = cl.Get(context.TODO(), req.NamespacedName, &d)
+				Ω(err).To(BeNil())
+				Expect(d.Status.Collation).To(Equal("utf8mb4_unicode_ci"))
+			})
+		})
+
+		When("Mariadb database uses utf8 reported as utf8mb3", func() {
+			var (
+				cl  client.Client
+				err error
+			)
+
+			BeforeEach(func() {
+				db = &v1alpha1.MariaDBDatabase{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      dbName,
+						Namespace: Namespace,
+					},
+					Spec: v1alpha1.MariaDBDatabaseSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+						},
+						Database:     dbName,
+						CharacterSet: "utf8",
+						Collation:    "UTF8_general_ci",
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(db).Build()
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner := mysqlMock.NewMockSQLRunner(mockCtrl)
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("CREATE DATABASE IF NOT EXISTS `db-name` CHARACTER SET ? COLLATE ?"))).Return(nil),
+					sqlRunner.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(databaseRow(&mysql.DatabaseInfo{
+						CharacterSet: "utf8mb3",
+						Collation:    "utf8mb3_general_ci",
+					})),
+				)
+
+				r = &controllers.MariaDBDatabaseReconciler{
+					Client:   cl,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
+					SQLRunnerFactory: func(_ *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			It("shouldn't alter the database", func() {
+				Ω(err).To(BeNil())
+				var d v1alpha1.MariaDBDatabase
+				err = cl.Get(context.TODO(), req.NamespacedName, &d)
+				Ω(err).To(BeNil())
+				Expect(d.Status.Collation).To(Equal("utf8mb3_general_ci"))
+			})
+		})
+
+		When("Mariadb database is deleted", func() {
+			var (
+				cl        client.Client
+				sqlRunner *mysqlMock.MockSQLRunner
+				err       error
+			)
+
+			BeforeEach(func() {
+				now := metav1.Now()
+				db = &v1alpha1.MariaDBDatabase{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              dbName,
+						Namespace:         Namespace,
+						DeletionTimestamp: &now,
+						Finalizers:        []string{"mariadb-operator.mkaciuba.com/database"},
+					},
+					Spec: v1alpha1.MariaDBDatabaseSpec{
+						ClusterRef: v1alpha1.ClusterReference{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: ClusterName,
+							},
+						},
+						Database: dbName,
+					},
+				}
+				err = v1alpha1.AddToScheme(s)
+				Expect(err).To(BeNil())
+				mockCtrl = gomock.NewController(GinkgoT())
+				sqlRunner = mysqlMock.NewMockSQLRunner(mockCtrl)
+			})
+
+			JustBeforeEach(func() {
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(db).Build()
+				r = &controllers.MariaDBDatabaseReconciler{
+					Client:   cl,
+					Scheme:   s,
+					Log:      logf.Log,
+					Recorder: recorder,
+					SQLRunnerFactory: func(_ *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+						return sqlRunner, func() {}, nil
+					},
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			AfterEach(func() {
+				mockCtrl.Finish()
+			})
+
+			It("should retain the database and remove finalizer", func() {
+				Ω(err).To(BeNil())
+				Expect(<-recorder.Events).To(ContainSubstring("DatabaseRetained"))
+
+				var d v1alpha1.MariaDBDatabase
+				err = cl.Get(context.TODO(), req.NamespacedName, &d)
+				Ω(err).To(BeNil())
+				Expect(d.Finalizers).To(BeEmpty())
+			})
+
+			Context("with Delete policy", func() {
+				BeforeEach(func() {
+					db.Spec.DeletionPolicy = v1alpha1.DeletionPolicyDelete
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("DROP DATABASE IF EXISTS `db-name`"))).Return(nil)
+				})
+
+				It("should drop the database", func() {
+					Ω(err).To(BeNil())
+					Expect(<-recorder.Events).To(ContainSubstring("DatabaseDeleted"))
+				})
 			})
 		})
 	})
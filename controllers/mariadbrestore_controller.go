@@ -0,0 +1,213 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/aldor007/mariadb-operator/resources/restore"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+)
+
+const (
+	// restorePollInterval is how often a pending or running restore is checked
+	restorePollInterval = 30 * time.Second
+)
+
+// MariaDBRestoreReconciler reconciles a MariaDBRestore object
+type MariaDBRestoreReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbrestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbrestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbrestores/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile runs the restore job once the cluster is ready and reflects the job state in the restore status
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.2/pkg/reconcile
+func (r *MariaDBRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("Request.Namespace", req.NamespacedName, "Request.Name", req.Name)
+
+	restoreCr := &mariadbv1alpha1.MariaDBRestore{}
+	err := r.Client.Get(ctx, req.NamespacedName, restoreCr)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// restore is never repeated
+	if restoreCr.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	oldStatus := restoreCr.Status.DeepCopy()
+	result, err := r.reconcileRestore(ctx, restoreCr, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !reflect.DeepEqual(oldStatus, &restoreCr.Status) {
+		if err = r.Status().Update(ctx, restoreCr); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return result, nil
+}
+
+func (r *MariaDBRestoreReconciler) reconcileRestore(ctx context.Context, restoreCr *mariadbv1alpha1.MariaDBRestore, log logr.Logger) (ctrl.Result, error) {
+	cluster := &mariadbv1alpha1.MariaDBCluster{}
+	err := r.Client.Get(ctx, restoreCr.GetClusterKey(), cluster)
+	if err != nil {
+		log.Error(err, "Unable to get cluster")
+		return ctrl.Result{}, err
+	}
+
+	job := &batchv1.Job{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: restoreCr.GetJobName(), Namespace: cluster.Namespace}, job)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	if errors.IsNotFound(err) {
+		backupURL, backupSecretName, backupPrefix, err := r.getBackupSource(ctx, restoreCr)
+		if err == nil {
+			err = validatePointInTime(restoreCr)
+		}
+		if err != nil {
+			restoreCr.Status.Phase = mariadbv1alpha1.RestorePhaseFailed
+			restoreCr.Status.Error = err.Error()
+			return ctrl.Result{}, nil
+		}
+
+		if !meta.IsStatusConditionTrue(cluster.Status.Conditions, mariadbv1alpha1.ClusterConditionReady) {
+			log.Info("cluster is not ready, waiting with restore", "cluster", cluster.Name)
+			restoreCr.Status.Phase = mariadbv1alpha1.RestorePhasePending
+			restoreCr.Status.Error = fmt.Sprintf("cluster %s is not ready", cluster.Name)
+			return ctrl.Result{RequeueAfter: restorePollInterval}, nil
+		}
+
+		err = restore.NewRestoreJob(r.Client, nil, r.Scheme, cluster, restoreCr, backupURL, backupSecretName, backupPrefix).Reconcile(ctx, log)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		now := metav1.Now()
+		restoreCr.Status.Phase = mariadbv1alpha1.RestorePhaseRunning
+		restoreCr.Status.StartTime = &now
+		restoreCr.Status.Error = ""
+		return ctrl.Result{RequeueAfter: restorePollInterval}, nil
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			restoreCr.Status.Phase = mariadbv1alpha1.RestorePhaseSucceeded
+			restoreCr.Status.CompletionTime = job.Status.CompletionTime
+			restoreCr.Status.Error = ""
+			return ctrl.Result{}, nil
+		case batchv1.JobFailed:
+			completionTime := condition.LastTransitionTime
+			if completionTime.IsZero() {
+				completionTime = metav1.Now()
+			}
+			restoreCr.Status.Phase = mariadbv1alpha1.RestorePhaseFailed
+			restoreCr.Status.CompletionTime = &completionTime
+			restoreCr.Status.Error = condition.Message
+			return ctrl.Result{}, nil
+		}
+	}
+
+	restoreCr.Status.Phase = mariadbv1alpha1.RestorePhaseRunning
+	if restoreCr.Status.StartTime == nil {
+		restoreCr.Status.StartTime = job.Status.StartTime
+	}
+	return ctrl.Result{RequeueAfter: restorePollInterval}, nil
+}
+
+// getBackupSource returns URL of the backup, name of the secret with credentials to it
+// and prefix of the archives when the backup is referenced
+func (r *MariaDBRestoreReconciler) getBackupSource(ctx context.Context, restoreCr *mariadbv1alpha1.MariaDBRestore) (string, string, string, error) {
+	if restoreCr.Spec.BackupRef == nil {
+		if restoreCr.Spec.BackupURL == "" {
+			return "", "", "", fmt.Errorf("either backupRef or backupURL has to be set")
+		}
+		return restoreCr.Spec.BackupURL, restoreCr.Spec.BackupSecretName, "", nil
+	}
+
+	backupCr := &mariadbv1alpha1.MariaDBBackup{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: restoreCr.Spec.BackupRef.Name, Namespace: restoreCr.Namespace}, backupCr)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unable to get backup %s, err: %s", restoreCr.Spec.BackupRef.Name, err)
+	}
+
+	secretName := restoreCr.Spec.BackupSecretName
+	if secretName == "" {
+		secretName = backupCr.Spec.BackupSecretName
+	}
+
+	return backupCr.Spec.BackupURL, secretName, backupCr.GetArchivePrefix(), nil
+}
+
+// validatePointInTime checks that the point in time target can be reached
+func validatePointInTime(restoreCr *mariadbv1alpha1.MariaDBRestore) error {
+	target := restoreCr.Spec.PointInTime
+	if target == nil {
+		return nil
+	}
+
+	if (target.Time == nil) == (target.GTID == "") {
+		return fmt.Errorf("exactly one of pointInTime.time and pointInTime.gtid has to be set")
+	}
+	// binary logs contain statements for all databases, they can't be replayed into another one
+	if restoreCr.Spec.DBName != "" {
+		return fmt.Errorf("pointInTime can't be used together with dbName")
+	}
+
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MariaDBRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&mariadbv1alpha1.MariaDBRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
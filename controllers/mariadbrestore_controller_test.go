@@ -0,0 +1,347 @@
+package controllers_test
+
+import (
+	"context"
+	"github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/controllers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("MariadbRestore Controller", func() {
+	const (
+		RestoreName = "restore"
+		BackupName  = "backup"
+		Namespace   = "default"
+		ClusterName = "example"
+	)
+
+	var (
+		s = scheme.Scheme
+		r *controllers.MariaDBRestoreReconciler
+	)
+
+	Context("Reconcile", func() {
+		var (
+			res     reconcile.Result
+			req     reconcile.Request
+			restore *v1alpha1.MariaDBRestore
+			backup  *v1alpha1.MariaDBBackup
+			cluster *v1alpha1.MariaDBCluster
+			cl      client.Client
+			err     error
+		)
+
+		BeforeEach(func() {
+			req = reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      RestoreName,
+					Namespace: Namespace,
+				},
+			}
+			restore = &v1alpha1.MariaDBRestore{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RestoreName,
+					Namespace: Namespace,
+				},
+				Spec: v1alpha1.MariaDBRestoreSpec{
+					ClusterRef: v1alpha1.ClusterReference{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: ClusterName,
+						},
+					},
+					BackupRef: &corev1.LocalObjectReference{
+						Name: BackupName,
+					},
+					DBName: "app",
+				},
+			}
+			backup = &v1alpha1.MariaDBBackup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      BackupName,
+					Namespace: Namespace,
+				},
+				Spec: v1alpha1.MariaDBBackupSpec{
+					ClusterRef: v1alpha1.ClusterReference{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: ClusterName,
+						},
+					},
+					BackupURL:        "s3:backups/example",
+					BackupSecretName: "secret",
+				},
+			}
+			cluster = &v1alpha1.MariaDBCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ClusterName,
+					Namespace: Namespace,
+				},
+				Spec: v1alpha1.MariaDBClusterSpec{
+					Image: "image",
+					RootPassword: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "secret-key",
+						},
+						Key: "root",
+					},
+				},
+			}
+			err = v1alpha1.AddToScheme(s)
+			Expect(err).To(BeNil())
+		})
+
+		When("cluster is not ready", func() {
+			BeforeEach(func() {
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, restore)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBRestoreReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("shouldn't create job", func() {
+				var job batchv1.Job
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      restore.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).NotTo(BeNil())
+			})
+
+			It("should wait for the cluster", func() {
+				var rs v1alpha1.MariaDBRestore
+				err = cl.Get(context.TODO(), req.NamespacedName, &rs)
+				Ω(err).To(BeNil())
+				Expect(rs.Status.Phase).To(Equal(v1alpha1.RestorePhasePending))
+				Expect(rs.Status.Error).NotTo(BeEmpty())
+				Expect(res.RequeueAfter).NotTo(BeZero())
+			})
+		})
+
+		When("cluster is ready", func() {
+			BeforeEach(func() {
+				cluster.Status.Conditions = []metav1.Condition{
+					{
+						Type:               v1alpha1.ClusterConditionReady,
+						Status:             metav1.ConditionTrue,
+						Reason:             "ClusterReady",
+						LastTransitionTime: metav1.Now(),
+					},
+				}
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, restore)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBRestoreReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should create job restoring the backup", func() {
+				var job batchv1.Job
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      restore.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				container := job.Spec.Template.Spec.Containers[0]
+				Expect(container.Image).To(Equal(cluster.Spec.Image))
+				Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "BACKUP_URL", Value: "s3:backups/example"}))
+				Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "RESTORE_DB", Value: "app"}))
+				Expect(container.EnvFrom[0].SecretRef.Name).To(Equal("secret"))
+				Expect(container.EnvFrom[1].SecretRef.Name).To(Equal(cluster.GetOperatorSecretName()))
+				Expect(*job.Spec.BackoffLimit).To(BeZero())
+			})
+
+			It("should mark restore as running", func() {
+				var rs v1alpha1.MariaDBRestore
+				err = cl.Get(context.TODO(), req.NamespacedName, &rs)
+				Ω(err).To(BeNil())
+				Expect(rs.Status.Phase).To(Equal(v1alpha1.RestorePhaseRunning))
+				Expect(rs.Status.StartTime).NotTo(BeNil())
+			})
+		})
+
+		When("restore with the same name in another namespace", func() {
+			BeforeEach(func() {
+				cluster.Status.Conditions = []metav1.Condition{
+					{
+						Type:               v1alpha1.ClusterConditionReady,
+						Status:             metav1.ConditionTrue,
+						Reason:             "ClusterReady",
+						LastTransitionTime: metav1.Now(),
+					},
+				}
+				failedJob := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      restore.GetJobName(),
+						Namespace: Namespace,
+					},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}},
+					},
+				}
+				restore.Namespace = "other"
+				restore.Spec.ClusterRef.Namespace = Namespace
+				backup.Namespace = "other"
+				req.Namespace = "other"
+
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(cluster, backup, restore, failedJob).Build()
+				r = &controllers.MariaDBRestoreReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("should run its own job", func() {
+				Ω(err).To(BeNil())
+				var job batchv1.Job
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      "restore-other-" + RestoreName,
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+
+				var rs v1alpha1.MariaDBRestore
+				Expect(cl.Get(context.TODO(), req.NamespacedName, &rs)).To(Succeed())
+				Expect(rs.Status.Phase).To(Equal(v1alpha1.RestorePhaseRunning))
+			})
+		})
+
+		When("restore job failed", func() {
+			BeforeEach(func() {
+				job := &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      restore.GetJobName(),
+						Namespace: Namespace,
+					},
+					Status: batchv1.JobStatus{
+						Conditions: []batchv1.JobCondition{
+							{
+								Type:    batchv1.JobFailed,
+								Status:  corev1.ConditionTrue,
+								Message: "Job has reached the specified backoff limit",
+							},
+						},
+					},
+				}
+				restore.Status.Phase = v1alpha1.RestorePhaseRunning
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, restore, job)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBRestoreReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should publish the error", func() {
+				var rs v1alpha1.MariaDBRestore
+				err = cl.Get(context.TODO(), req.NamespacedName, &rs)
+				Ω(err).To(BeNil())
+				Expect(rs.Status.Phase).To(Equal(v1alpha1.RestorePhaseFailed))
+				Expect(rs.Status.Error).To(Equal("Job has reached the specified backoff limit"))
+				Expect(rs.Status.CompletionTime).NotTo(BeNil())
+			})
+		})
+
+		When("restore to a point in time", func() {
+			BeforeEach(func() {
+				cluster.Status.Conditions = []metav1.Condition{
+					{
+						Type:               v1alpha1.ClusterConditionReady,
+						Status:             metav1.ConditionTrue,
+						Reason:             "ClusterReady",
+						LastTransitionTime: metav1.Now(),
+					},
+				}
+				restore.Spec.DBName = ""
+				restore.Spec.PointInTime = &v1alpha1.PointInTimeTarget{GTID: "1-1-1234"}
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, restore)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBRestoreReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should pass the target to the restore job", func() {
+				var job batchv1.Job
+				err = cl.Get(context.TODO(), types.NamespacedName{
+					Name:      restore.GetJobName(),
+					Namespace: Namespace,
+				}, &job)
+				Ω(err).To(BeNil())
+				Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "RESTORE_GTID", Value: "1-1-1234"}))
+			})
+		})
+
+		When("restore to a point in time into a single database", func() {
+			BeforeEach(func() {
+				restore.Spec.PointInTime = &v1alpha1.PointInTimeTarget{GTID: "1-1-1234"}
+				var fakeObjects []runtime.Object
+				fakeObjects = append(fakeObjects, cluster, backup, restore)
+				cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+				r = &controllers.MariaDBRestoreReconciler{
+					Client: cl,
+					Scheme: s,
+					Log:    logf.Log,
+				}
+				res, err = r.Reconcile(context.Background(), req)
+			})
+
+			It("should fail the restore", func() {
+				Ω(err).To(BeNil())
+				var rs v1alpha1.MariaDBRestore
+				err = cl.Get(context.TODO(), req.NamespacedName, &rs)
+				Ω(err).To(BeNil())
+				Expect(rs.Status.Phase).To(Equal(v1alpha1.RestorePhaseFailed))
+				Expect(rs.Status.Error).To(ContainSubstring("dbName"))
+			})
+		})
+	})
+})
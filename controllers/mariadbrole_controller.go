@@ -0,0 +1,163 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/aldor007/mariadb-operator/utils"
+	"github.com/go-logr/logr"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+)
+
+const (
+	roleFinalizer = "mariadb-operator.mkaciuba.com/role"
+)
+
+// MariaDBRoleReconciler reconciles a MariaDBRole object
+type MariaDBRoleReconciler struct {
+	client.Client
+	Log              logr.Logger
+	Scheme           *runtime.Scheme
+	SQLRunnerFactory mysql.SQLRunnerFactory
+}
+
+//+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbroles,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbroles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbroles/finalizers,verbs=update
+
+// Reconcile creates the role in the database and keeps its permissions in sync with the spec
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.2/pkg/reconcile
+func (r *MariaDBRoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("mariadbrole", req.NamespacedName)
+	role := &mariadbv1alpha1.MariaDBRole{}
+	err := r.Get(ctx, req.NamespacedName, role)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// if the role has been deleted then remove it from mysql cluster
+	if !role.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.removeRole(ctx, role, log)
+	}
+
+	oldStatus := role.Status.DeepCopy()
+	err = r.reconcileRoleInDB(ctx, role, log)
+	if err != nil {
+		role.UpdateStatusCondition(mariadbv1alpha1.MariaDBStatusError, "create role in db", err.Error())
+	} else {
+		role.UpdateStatusCondition(mariadbv1alpha1.MariaDBStatusReady, "role created", "The role provisioning has succeeded.")
+	}
+
+	// add finalizer if is not added on the resource
+	if err == nil && !utils.HasFinalizer(&role.ObjectMeta, roleFinalizer) {
+		utils.AddFinalizer(&role.ObjectMeta, roleFinalizer)
+		status := role.Status.DeepCopy()
+		if err = r.Update(ctx, role); err != nil {
+			return ctrl.Result{}, err
+		}
+		role.Status = *status
+	}
+
+	if !reflect.DeepEqual(oldStatus, &role.Status) {
+		if errUpdate := r.Status().Update(ctx, role); errUpdate != nil {
+			log.Error(errUpdate, "error updating status")
+		}
+	}
+
+	return ctrl.Result{}, err
+}
+
+func (r *MariaDBRoleReconciler) removeRole(ctx context.Context, role *mariadbv1alpha1.MariaDBRole, log logr.Logger) error {
+	if !utils.HasFinalizer(&role.ObjectMeta, roleFinalizer) {
+		return nil
+	}
+
+	// the role is gone together with the cluster
+	sql, closeConn, err := r.SQLRunnerFactory(mysql.NewConfigFromClusterKey(ctx, r.Client, role.GetClusterKey()))
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		defer closeConn()
+		log.Info("removing role from mysql cluster", "role", role.Spec.Role, "cluster", role.GetClusterKey())
+		if err := mysql.DropRole(ctx, sql, role.Spec.Role); err != nil {
+			return err
+		}
+	}
+
+	utils.RemoveFinalizer(&role.ObjectMeta, roleFinalizer)
+	return r.Update(ctx, role)
+}
+
+func (r *MariaDBRoleReconciler) reconcileRoleInDB(ctx context.Context, role *mariadbv1alpha1.MariaDBRole, log logr.Logger) error {
+	sql, closeConn, err := r.SQLRunnerFactory(mysql.NewConfigFromClusterKey(ctx, r.Client, role.GetClusterKey()))
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	log.Info("creating mysql role", "role", role.Spec.Role, "cluster", role.GetClusterKey())
+	if err := mysql.CreateRoleIfNotExists(ctx, sql, role.Spec.Role, role.Spec.Permissions); err != nil {
+		return err
+	}
+
+	current, err := mysql.GetRoleGrants(ctx, sql, role.Spec.Role)
+	if err != nil {
+		return err
+	}
+
+	extra := mysql.PermissionsDiff(role.Spec.Permissions, current.Permissions)
+	if len(extra) > 0 {
+		log.Info("revoking permissions removed from spec", "role", role.Spec.Role, "permissions", extra)
+		if err := mysql.RevokeRolePermissions(ctx, sql, role.Spec.Role, extra); err != nil {
+			return err
+		}
+		// revoking ALL PRIVILEGES takes away also the privileges which should stay
+		if err := mysql.GrantRolePermissions(ctx, sql, role.Spec.Role, role.Spec.Permissions); err != nil {
+			return err
+		}
+		if current, err = mysql.GetRoleGrants(ctx, sql, role.Spec.Role); err != nil {
+			return err
+		}
+	}
+
+	role.Status.Permissions = nil
+	if len(current.Permissions) > 0 {
+		role.Status.Permissions = current.Permissions
+	}
+
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MariaDBRoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&mariadbv1alpha1.MariaDBRole{}).
+		Complete(r)
+}
@@ -0,0 +1,153 @@
+package controllers_test
+
+import (
+	"context"
+	"github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/controllers"
+	mysqlMock "github.com/aldor007/mariadb-operator/mocks/mysql"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("MariadbRole Controller", func() {
+	const (
+		Namespace   = "default"
+		ClusterName = "example"
+		RoleName    = "readonly"
+	)
+
+	var (
+		s = scheme.Scheme
+		r *controllers.MariaDBRoleReconciler
+	)
+
+	Context("Reconcile", func() {
+		var (
+			req       reconcile.Request
+			role      *v1alpha1.MariaDBRole
+			cl        client.Client
+			mockCtrl  *gomock.Controller
+			sqlRunner *mysqlMock.MockSQLRunner
+			err       error
+		)
+
+		showGrants := mysql.NewQuery("SHOW GRANTS FOR `readonly`")
+
+		BeforeEach(func() {
+			req = reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      RoleName,
+					Namespace: Namespace,
+				},
+			}
+			role = &v1alpha1.MariaDBRole{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RoleName,
+					Namespace: Namespace,
+				},
+				Spec: v1alpha1.MariaDBRoleSpec{
+					ClusterRef: v1alpha1.ClusterReference{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: ClusterName,
+						},
+					},
+					Role: RoleName,
+					Permissions: []v1alpha1.MariaDBPermission{
+						{
+							Schema:      "app",
+							Tables:      []string{"*"},
+							Permissions: []string{"SELECT"},
+						},
+					},
+				},
+			}
+			err = v1alpha1.AddToScheme(s)
+			Expect(err).To(BeNil())
+
+			mockCtrl = gomock.NewController(GinkgoT())
+			sqlRunner = mysqlMock.NewMockSQLRunner(mockCtrl)
+		})
+
+		JustBeforeEach(func() {
+			var fakeObjects []runtime.Object
+			fakeObjects = append(fakeObjects, role)
+			cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+			r = &controllers.MariaDBRoleReconciler{
+				Client: cl,
+				Scheme: s,
+				Log:    logf.Log,
+				SQLRunnerFactory: func(_ *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+					return sqlRunner, func() {}, nil
+				},
+			}
+			_, err = r.Reconcile(context.Background(), req)
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		When("role is created", func() {
+			BeforeEach(func() {
+				create := mysql.BuildAtomicQuery(
+					mysql.NewQuery("CREATE ROLE IF NOT EXISTS `readonly`"),
+					mysql.NewQuery("GRANT SELECT ON `app`.* TO `readonly`"),
+				)
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(create)).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT USAGE ON *.* TO `readonly`",
+					"GRANT SELECT ON `app`.* TO `readonly`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should add finalizer and record permissions", func() {
+				var rl v1alpha1.MariaDBRole
+				err = cl.Get(context.TODO(), req.NamespacedName, &rl)
+				Ω(err).To(BeNil())
+				Expect(rl.Finalizers).To(ContainElement("mariadb-operator.mkaciuba.com/role"))
+				Expect(rl.Status.Condition.Status).To(Equal(v1alpha1.MariaDBStatusReady))
+				Expect(rl.Status.Permissions).To(Equal([]v1alpha1.MariaDBPermission{
+					{Schema: "app", Tables: []string{"*"}, Permissions: []string{"SELECT"}},
+				}))
+			})
+		})
+
+		When("permissions were removed from spec", func() {
+			BeforeEach(func() {
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+						"GRANT SELECT, DELETE ON `app`.* TO `readonly`",
+					}), nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.BuildAtomicQuery(
+						mysql.NewQuery("REVOKE DELETE ON `app`.* FROM `readonly`"),
+					))).Return(nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("GRANT SELECT ON `app`.* TO `readonly`"))).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+						"GRANT SELECT ON `app`.* TO `readonly`",
+					}), nil),
+				)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+		})
+	})
+})
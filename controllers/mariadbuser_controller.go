@@ -18,14 +18,17 @@ package controllers
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"github.com/aldor007/mariadb-operator/mysql"
 	"github.com/aldor007/mariadb-operator/utils"
 	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	"time"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -37,6 +40,8 @@ import (
 
 const (
 	userFinalizer = "mariadb-operator.mkaciuba.com/user"
+	// userPasswordSecretField indexes users by name of the secret with their password or its hash
+	userPasswordSecretField = ".spec.password.name"
 )
 
 // MariaDBUserReconciler reconciles a MariaDBUser object
@@ -44,12 +49,14 @@ type MariaDBUserReconciler struct {
 	client.Client
 	Log              logr.Logger
 	Scheme           *runtime.Scheme
+	Recorder         record.EventRecorder
 	SQLRunnerFactory mysql.SQLRunnerFactory
 }
 
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbusers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbusers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=mariadb.mkaciuba.com,resources=mariadbusers/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -79,26 +86,39 @@ func (r *MariaDBUserReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return reconcile.Result{}, r.removeUser(ctx, user, log)
 	}
 
+	oldStatus := user.Status.DeepCopy()
 	err = r.createUser(ctx, user, log)
-	if err != nil {
-		errUpdate := r.Update(ctx, user)
+	if !reflect.DeepEqual(oldStatus, &user.Status) {
+		errUpdate := r.Status().Update(ctx, user)
 		if errUpdate != nil {
 			log.Error(errUpdate, "error updating status")
 		}
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// changes of the password secret are watched, so only periodic rotation needs requeue
+	requeueAfter, err := r.getRotationRequeue(ctx, user)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return reconcile.Result{
-		Requeue:      true,
-		RequeueAfter: 2 * time.Minute,
-	}, nil
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
 }
 func (r *MariaDBUserReconciler) removeUser(ctx context.Context, user *mariadbv1alpha1.MariaDBUser, log logr.Logger) error {
 	// The resource has been deleted
 	if utils.HasFinalizer(&user.ObjectMeta, userFinalizer) {
-		// Drop the user if the finalizer is still present
-		if err := r.dropUserFromDB(ctx, user, log); err != nil {
-			return err
+		// Drop the user if the finalizer is still present and the deletion policy allows it
+		if user.GetDeletionPolicy() == mariadbv1alpha1.DeletionPolicyDelete {
+			if err := r.dropUserFromDB(ctx, user, log); err != nil {
+				return err
+			}
+			r.Recorder.Eventf(user, corev1.EventTypeNormal, "UserDeleted", "User %s was dropped", user.Spec.User)
+		} else {
+			log.Info("retaining mysql user", "username", user.Spec.User)
+			r.Recorder.Eventf(user, corev1.EventTypeNormal, "UserRetained",
+				"User %s was left in the cluster because of %s deletion policy", user.Spec.User, user.GetDeletionPolicy())
 		}
 
 		utils.RemoveFinalizer(&user.ObjectMeta, userFinalizer)
@@ -113,18 +133,20 @@ func (r *MariaDBUserReconciler) removeUser(ctx context.Context, user *mariadbv1a
 
 func (r *MariaDBUserReconciler) dropUserFromDB(ctx context.Context, user *mariadbv1alpha1.MariaDBUser, log logr.Logger) error {
 	sql, closeConn, err := r.SQLRunnerFactory(mysql.NewConfigFromClusterKey(ctx, r.Client, user.GetClusterKey()))
-	defer closeConn()
 	if apiErrors.IsNotFound(err) {
 		return nil
 	}
 	if err != nil {
 		return err
 	}
+	defer closeConn()
 
-	for _, host := range user.Status.AllowedHosts {
-		log.Info("removing user from mysql cluster", "username", user.Spec.User, "cluster", user.GetClusterKey())
-		if err := mysql.DropUser(ctx, sql, user.Spec.User, host); err != nil {
-			return err
+	for _, username := range user.GetUsernames() {
+		for _, host := range user.Status.AllowedHosts {
+			log.Info("removing user from mysql cluster", "username", username, "cluster", user.GetClusterKey())
+			if err := mysql.DropUser(ctx, sql, username, host); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -137,48 +159,221 @@ func (r *MariaDBUserReconciler) reconcileUserInDB(ctx context.Context, user *mar
 	}
 	defer closeConn()
 
-	secret := &corev1.Secret{}
-	secretKey := client.ObjectKey{Name: user.Spec.Password.Name, Namespace: user.Namespace}
+	if err := validateUser(user); err != nil {
+		return err
+	}
 
-	if err := r.Get(ctx, secretKey, secret); err != nil {
+	credentials, err := r.getCredentials(ctx, user, log)
+	if err != nil {
 		return err
 	}
 
-	password := string(secret.Data[user.Spec.Password.Key])
-	if password == "" {
-		return errors.New("the MariaDB user's password must not be empty")
+	// the previous user of dual user scheme keeps working with the old password until the next rotation
+	if credentials.previousPassword != "" {
+		auth := userAuthentication(user, credentials.previousPassword, "")
+		if _, err := r.reconcileAccount(ctx, sql, user, credentials.previousUser, auth, log); err != nil {
+			return err
+		}
 	}
 
-	// create/ update user in database
-	log.Info("creating mysql user", "username", user.Spec.User, "cluster", user.GetClusterKey())
-	if err := mysql.CreateUserIfNotExists(ctx, sql, user.Spec.User, password, user.Spec.AllowedHosts,
-		user.Spec.Permissions, user.Spec.ResourceLimits); err != nil {
+	auth := userAuthentication(user, credentials.password, credentials.passwordHash)
+	grants, err := r.reconcileAccount(ctx, sql, user, credentials.activeUser, auth, log)
+	if err != nil {
 		return err
 	}
+	user.Status.Grants = grants
+
+	if err := r.dropObsoleteUsers(ctx, sql, user, log); err != nil {
+		return err
+	}
+	user.Status.ActiveUser = credentials.activeUser
+
+	return r.reconcileConnectionSecret(ctx, user, credentials, log)
+}
+
+// reconcileAccount creates or updates the database user and returns its effective grants
+func (r *MariaDBUserReconciler) reconcileAccount(ctx context.Context, sql mysql.SQLRunner, user *mariadbv1alpha1.MariaDBUser,
+	username string, auth mysql.Authentication, log logr.Logger) ([]mariadbv1alpha1.MariaDBUserGrants, error) {
+	// create/ update user in database
+	log.Info("creating mysql user", "username", username, "cluster", user.GetClusterKey())
+	err := mysql.ConfigureUser(ctx, sql, username, user.Spec.AllowedHosts, user.Spec.Permissions, mysql.UserOptions{
+		Authentication:     auth,
+		Require:            user.Spec.Require,
+		ResourceLimits:     user.Spec.ResourceLimits,
+		Locked:             user.Spec.Suspended,
+		PasswordExpireDays: user.Spec.PasswordExpireIntervalDays,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// remove allowed hosts for user
 	toRemove := utils.StringDiffIn(user.Status.AllowedHosts, user.Spec.AllowedHosts)
 	for _, host := range toRemove {
-		if err := mysql.DropUser(ctx, sql, user.Spec.User, host); err != nil {
-			return err
+		if err := mysql.DropUser(ctx, sql, username, host); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.reconcileGrants(ctx, sql, user, username, log)
+}
+
+// validateUser checks the combinations of fields which can't be expressed in the CRD schema
+func validateUser(user *mariadbv1alpha1.MariaDBUser) error {
+	if user.Spec.DefaultRole != "" {
+		if _, ok := utils.StringIn(user.Spec.DefaultRole, user.Spec.Roles); !ok {
+			return fmt.Errorf("default role %s is not one of roles", user.Spec.DefaultRole)
 		}
 	}
 
+	hashed := user.Spec.Authentication != nil && user.Spec.Authentication.PasswordHash != nil
+	if user.Spec.PasswordRotation != nil && (hashed || !user.UsesPassword()) {
+		return fmt.Errorf("passwordRotation requires plain password authentication")
+	}
+	if hashed && !user.UsesPassword() {
+		return fmt.Errorf("passwordHash can't be used with %s plugin", user.GetAuthPlugin())
+	}
+
 	return nil
 }
 
+// userAuthentication returns authentication of the user with the password or its hash
+func userAuthentication(user *mariadbv1alpha1.MariaDBUser, password, passwordHash string) mysql.Authentication {
+	auth := mysql.Authentication{
+		Plugin:       user.GetAuthPlugin(),
+		Password:     password,
+		PasswordHash: passwordHash,
+	}
+	if user.Spec.Authentication != nil {
+		auth.Principal = user.Spec.Authentication.Principal
+	}
+
+	return auth
+}
+
+// dropObsoleteUsers removes users left over after switching between single and dual user scheme
+func (r *MariaDBUserReconciler) dropObsoleteUsers(ctx context.Context, sql mysql.SQLRunner, user *mariadbv1alpha1.MariaDBUser, log logr.Logger) error {
+	if user.Status.ActiveUser == "" {
+		return nil
+	}
+	usernames := user.GetUsernames()
+	if _, ok := utils.StringIn(user.Status.ActiveUser, usernames); ok {
+		return nil
+	}
+
+	obsolete := []string{user.Spec.User}
+	if len(usernames) == 1 {
+		obsolete = []string{user.Spec.User + "_a", user.Spec.User + "_b"}
+	}
+	for _, username := range obsolete {
+		for _, host := range user.Status.AllowedHosts {
+			log.Info("removing user of the previous user scheme", "username", username, "host", host)
+			if err := mysql.DropUser(ctx, sql, username, host); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reconcileGrants revokes privileges and roles which are not in the spec, grants missing roles
+// and returns the effective grants and limits of the user
+func (r *MariaDBUserReconciler) reconcileGrants(ctx context.Context, sql mysql.SQLRunner, user *mariadbv1alpha1.MariaDBUser,
+	username string, log logr.Logger) ([]mariadbv1alpha1.MariaDBUserGrants, error) {
+	result := make([]mariadbv1alpha1.MariaDBUserGrants, 0, len(user.Spec.AllowedHosts))
+	for _, host := range user.Spec.AllowedHosts {
+		current, err := mysql.GetUserGrants(ctx, sql, username, host)
+		if err != nil {
+			return nil, err
+		}
+		changed := false
+
+		extra := mysql.PermissionsDiff(user.Spec.Permissions, current.Permissions)
+		if len(extra) > 0 {
+			log.Info("revoking permissions removed from spec", "username", username, "host", host, "permissions", extra)
+			if err := mysql.RevokePermissions(ctx, sql, username, host, extra); err != nil {
+				return nil, err
+			}
+			// revoking ALL PRIVILEGES takes away also the privileges which should stay
+			if err := mysql.GrantPermissions(ctx, sql, username, []string{host}, user.Spec.Permissions); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+
+		if missing := utils.StringDiffIn(user.Spec.Roles, current.Roles); len(missing) > 0 {
+			log.Info("granting roles", "username", username, "host", host, "roles", missing)
+			if err := mysql.GrantRoles(ctx, sql, username, []string{host}, missing); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+
+		if current.DefaultRole != user.Spec.DefaultRole {
+			log.Info("setting default role", "username", username, "host", host, "role", user.Spec.DefaultRole)
+			if err := mysql.SetDefaultRole(ctx, sql, username, host, user.Spec.DefaultRole); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+
+		if removed := utils.StringDiffIn(current.Roles, user.Spec.Roles); len(removed) > 0 {
+			log.Info("revoking roles removed from spec", "username", username, "host", host, "roles", removed)
+			if err := mysql.RevokeRoles(ctx, sql, username, host, removed); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+
+		if changed {
+			if current, err = mysql.GetUserGrants(ctx, sql, username, host); err != nil {
+				return nil, err
+			}
+		}
+
+		grants := mariadbv1alpha1.MariaDBUserGrants{
+			Host:        host,
+			Roles:       current.Roles,
+			DefaultRole: current.DefaultRole,
+		}
+		if len(current.Permissions) > 0 {
+			grants.Permissions = current.Permissions
+		}
+
+		grants.Limits, err = mysql.GetUserLimits(ctx, sql, username, host)
+		if err != nil {
+			return nil, err
+		}
+		if *grants.Limits != user.Spec.ResourceLimits {
+			log.Info("user limits differ from spec", "username", username, "host", host, "limits", grants.Limits)
+		}
+		result = append(result, grants)
+	}
+
+	return result, nil
+}
+
 func (r *MariaDBUserReconciler) createUser(ctx context.Context, user *mariadbv1alpha1.MariaDBUser, log logr.Logger) (err error) {
+	_, rotationRequested := user.Annotations[RotatePasswordAnnotation]
 
 	// Reconcile the user into mysql
 	if err = r.reconcileUserInDB(ctx, user, log); err != nil {
 		user.UpdateStatusCondition(mariadbv1alpha1.MariaDBStatusError, "create user in db", err.Error())
+		// the password has been already rotated, it mustn't be rotated again on retry
+		if _, rotationPending := user.Annotations[RotatePasswordAnnotation]; rotationRequested && !rotationPending {
+			if errUpdate := r.updateUser(ctx, user); errUpdate != nil {
+				log.Error(errUpdate, "error removing rotation request")
+			}
+		}
 		return
 	}
 
-	// add finalizer if is not added on the resource
-	if !utils.HasFinalizer(&user.ObjectMeta, userFinalizer) {
+	// add finalizer if is not added on the resource, rotation request is removed once the password is rotated
+	_, rotationPending := user.Annotations[RotatePasswordAnnotation]
+	if !utils.HasFinalizer(&user.ObjectMeta, userFinalizer) || rotationRequested != rotationPending {
 		utils.AddFinalizer(&user.ObjectMeta, userFinalizer)
-		if err = r.Update(ctx, user); err != nil {
+		if err = r.updateUser(ctx, user); err != nil {
 			return
 		}
 	}
@@ -189,14 +384,62 @@ func (r *MariaDBUserReconciler) createUser(ctx context.Context, user *mariadbv1a
 	}
 
 	// Update the status according to the result
+	if user.Spec.Suspended {
+		user.UpdateStatusCondition(mariadbv1alpha1.MariaDBStatusReady, "user suspended", "The user account is locked.")
+		return
+	}
 	user.UpdateStatusCondition(mariadbv1alpha1.MariaDBStatusReady, "user created", "The user provisioning has succeeded.")
 
 	return
 }
 
+// updateUser updates metadata and spec of the user, the status changed in memory is kept
+func (r *MariaDBUserReconciler) updateUser(ctx context.Context, user *mariadbv1alpha1.MariaDBUser) error {
+	status := user.Status.DeepCopy()
+	if err := r.Update(ctx, user); err != nil {
+		return err
+	}
+	user.Status = *status
+
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *MariaDBUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &mariadbv1alpha1.MariaDBUser{}, userPasswordSecretField, func(obj client.Object) []string {
+		user := obj.(*mariadbv1alpha1.MariaDBUser)
+		if auth := user.Spec.Authentication; auth != nil && auth.PasswordHash != nil {
+			return []string{auth.PasswordHash.Name}
+		}
+		return []string{user.GetPasswordSecretKey().Name}
+	})
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&mariadbv1alpha1.MariaDBUser{}).
+		Owns(&corev1.Secret{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.usersForSecret)).
 		Complete(r)
 }
+
+// usersForSecret maps password secret to the users referencing it
+func (r *MariaDBUserReconciler) usersForSecret(obj client.Object) []reconcile.Request {
+	users := &mariadbv1alpha1.MariaDBUserList{}
+	err := r.List(context.Background(), users, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{userPasswordSecretField: obj.GetName()})
+	if err != nil {
+		r.Log.Error(err, "failed to list users of secret", "secret", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(users.Items))
+	for _, user := range users.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: user.Name, Namespace: user.Namespace},
+		})
+	}
+
+	return requests
+}
@@ -0,0 +1,594 @@
+package controllers_test
+
+import (
+	"context"
+	"github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/controllers"
+	mysqlMock "github.com/aldor007/mariadb-operator/mocks/mysql"
+	"github.com/aldor007/mariadb-operator/mysql"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+)
+
+// grantRows returns mocked rows of SHOW GRANTS query
+func grantRows(mockCtrl *gomock.Controller, grants []string) mysql.Rows {
+	rows := mysqlMock.NewMockRows(mockCtrl)
+	i := 0
+	rows.EXPECT().Next().DoAndReturn(func() bool {
+		i++
+		return i <= len(grants)
+	}).AnyTimes()
+	rows.EXPECT().Scan(gomock.Any()).DoAndReturn(func(dest ...interface{}) error {
+		*dest[0].(*string) = grants[i-1]
+		return nil
+	}).AnyTimes()
+	rows.EXPECT().Err().Return(nil).AnyTimes()
+	return rows
+}
+
+var _ = Describe("MariadbUser Controller", func() {
+	const (
+		Namespace   = "default"
+		ClusterName = "example"
+		UserName    = "app"
+	)
+
+	var (
+		s = scheme.Scheme
+		r *controllers.MariaDBUserReconciler
+	)
+
+	Context("Reconcile", func() {
+		var (
+			res       reconcile.Result
+			req       reconcile.Request
+			user      *v1alpha1.MariaDBUser
+			cluster   *v1alpha1.MariaDBCluster
+			secret    *corev1.Secret
+			cl        client.Client
+			mockCtrl  *gomock.Controller
+			sqlRunner *mysqlMock.MockSQLRunner
+			limits    v1alpha1.MariaDBUserLimits
+			recorder  *record.FakeRecorder
+			err       error
+		)
+
+		showGrants := mysql.NewQuery("SHOW GRANTS FOR ?@?", UserName, "%")
+		withLimits := " WITH MAX_CONNECTIONS_PER_HOUR ? MAX_QUERIES_PER_HOUR ? MAX_STATEMENT_TIME ? MAX_UPDATES_PER_HOUR ? MAX_USER_CONNECTIONS ?"
+		accountOptions := " PASSWORD EXPIRE DEFAULT ACCOUNT UNLOCK"
+
+		BeforeEach(func() {
+			req = reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      UserName,
+					Namespace: Namespace,
+				},
+			}
+			cluster = &v1alpha1.MariaDBCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ClusterName,
+					Namespace: Namespace,
+				},
+				Spec: v1alpha1.MariaDBClusterSpec{
+					Image:        "image",
+					PrimaryCount: 3,
+					RootPassword: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "mariadb-secret-key",
+						},
+						Key: "root",
+					},
+				},
+			}
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "user-secret",
+					Namespace: Namespace,
+				},
+				Data: map[string][]byte{
+					"password": []byte("user-password"),
+				},
+			}
+			user = &v1alpha1.MariaDBUser{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      UserName,
+					Namespace: Namespace,
+				},
+				Spec: v1alpha1.MariaDBUserSpec{
+					ClusterRef: v1alpha1.ClusterReference{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: ClusterName,
+						},
+					},
+					User: UserName,
+					Password: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "user-secret",
+						},
+						Key: "password",
+					},
+					AllowedHosts: []string{"%"},
+					Permissions: []v1alpha1.MariaDBPermission{
+						{
+							Schema:      "app",
+							Tables:      []string{"*"},
+							Permissions: []string{"select"},
+						},
+					},
+				},
+			}
+			err = v1alpha1.AddToScheme(s)
+			Expect(err).To(BeNil())
+
+			mockCtrl = gomock.NewController(GinkgoT())
+			sqlRunner = mysqlMock.NewMockSQLRunner(mockCtrl)
+			limits = v1alpha1.MariaDBUserLimits{}
+			recorder = record.NewFakeRecorder(10)
+			sqlRunner.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ mysql.Query, dest ...interface{}) error {
+					*dest[0].(*int) = limits.MaxQueriesPerHour
+					*dest[1].(*int) = limits.MaxUpdatePerHour
+					*dest[2].(*int) = limits.MaxConnectionsPerHour
+					*dest[3].(*int) = limits.MaxUserConnections
+					*dest[4].(*float64) = float64(limits.MaxStatementTime)
+					return nil
+				}).AnyTimes()
+		})
+
+		JustBeforeEach(func() {
+			var fakeObjects []runtime.Object
+			fakeObjects = append(fakeObjects, cluster, secret, user)
+			cl = fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(fakeObjects...).Build()
+
+			r = &controllers.MariaDBUserReconciler{
+				Client:   cl,
+				Scheme:   s,
+				Log:      logf.Log,
+				Recorder: recorder,
+				SQLRunnerFactory: func(_ *mysql.Config, errs ...error) (mysql.SQLRunner, func(), error) {
+					return sqlRunner, func() {}, nil
+				},
+			}
+			res, err = r.Reconcile(context.Background(), req)
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		When("user has only the permissions from spec", func() {
+			BeforeEach(func() {
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT USAGE ON *.* TO `app`@`%` IDENTIFIED BY PASSWORD '*8232A1298A49F710DBEE0B330C42EEC825D4190A'",
+					"GRANT SELECT ON `app`.* TO `app`@`%`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should record effective grants", func() {
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Status.Grants).To(Equal([]v1alpha1.MariaDBUserGrants{
+					{
+						Host: "%",
+						Permissions: []v1alpha1.MariaDBPermission{
+							{Schema: "app", Tables: []string{"*"}, Permissions: []string{"SELECT"}},
+						},
+						Limits: &v1alpha1.MariaDBUserLimits{},
+					},
+				}))
+				Expect(u.Status.AllowedHosts).To(Equal([]string{"%"}))
+			})
+
+			It("shouldn't requeue the request", func() {
+				Ω(res.Requeue).To(BeFalse())
+				Ω(res.RequeueAfter).To(BeZero())
+			})
+		})
+
+		When("password is generated and connection secret is requested", func() {
+			BeforeEach(func() {
+				user.Spec.Password = nil
+				user.Spec.ConnectionSecret = &v1alpha1.MariaDBUserConnectionSecret{
+					Name:     "app-connection",
+					Database: "app",
+				}
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT SELECT ON `app`.* TO `app`@`%`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should store generated password in a secret owned by the user", func() {
+				var generated corev1.Secret
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: user.GetGeneratedPasswordSecretName(), Namespace: Namespace}, &generated)
+				Ω(err).To(BeNil())
+				Expect(generated.Data["password"]).To(HaveLen(32))
+				Expect(generated.OwnerReferences).To(HaveLen(1))
+				Expect(generated.OwnerReferences[0].Name).To(Equal(UserName))
+			})
+
+			It("should write connection details", func() {
+				var generated, connection corev1.Secret
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: user.GetGeneratedPasswordSecretName(), Namespace: Namespace}, &generated)
+				Ω(err).To(BeNil())
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: "app-connection", Namespace: Namespace}, &connection)
+				Ω(err).To(BeNil())
+				password := string(generated.Data["password"])
+				Expect(string(connection.Data["host"])).To(Equal(cluster.GetPrimaryAddress()))
+				Expect(string(connection.Data["port"])).To(Equal("3306"))
+				Expect(string(connection.Data["password"])).To(Equal(password))
+				Expect(string(connection.Data["dsn"])).To(Equal("app:" + password + "@tcp(" + cluster.GetPrimaryAddress() + ":3306)/app"))
+				Expect(string(connection.Data["jdbcUrl"])).To(HavePrefix("jdbc:mariadb://" + cluster.GetPrimaryAddress() + ":3306/app?"))
+			})
+		})
+
+		When("password rotation is requested", func() {
+			BeforeEach(func() {
+				user.Annotations = map[string]string{controllers.RotatePasswordAnnotation: ""}
+				user.Finalizers = []string{"mariadb-operator.mkaciuba.com/user"}
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT SELECT ON `app`.* TO `app`@`%`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should store new password in the secret", func() {
+				var s corev1.Secret
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: "user-secret", Namespace: Namespace}, &s)
+				Ω(err).To(BeNil())
+				Expect(string(s.Data["password"])).NotTo(Equal("user-password"))
+				Expect(s.Data["password"]).To(HaveLen(32))
+			})
+
+			It("should record rotation and remove the request", func() {
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Annotations).NotTo(HaveKey(controllers.RotatePasswordAnnotation))
+				Expect(u.Status.LastRotationTime).NotTo(BeNil())
+				Expect(u.Status.ActiveUser).To(Equal(UserName))
+			})
+		})
+
+		When("password rotation in dual user scheme is due", func() {
+			BeforeEach(func() {
+				lastRotation := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+				user.Spec.PasswordRotation = &v1alpha1.PasswordRotation{
+					Interval: &metav1.Duration{Duration: time.Hour},
+					DualUser: true,
+				}
+				user.Status.LastRotationTime = &lastRotation
+				user.Status.ActiveUser = "app_a"
+				user.Status.AllowedHosts = []string{"%"}
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GRANTS FOR ?@?", "app_a", "%"))).Return(grantRows(mockCtrl, []string{
+						"GRANT SELECT ON `app`.* TO `app_a`@`%`",
+					}), nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(mysql.NewQuery("SHOW GRANTS FOR ?@?", "app_b", "%"))).Return(grantRows(mockCtrl, []string{
+						"GRANT SELECT ON `app`.* TO `app_b`@`%`",
+					}), nil),
+				)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should give new password to the inactive user and keep the old one", func() {
+				var s corev1.Secret
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: "user-secret", Namespace: Namespace}, &s)
+				Ω(err).To(BeNil())
+				Expect(s.Annotations[controllers.ActiveUserAnnotation]).To(Equal("app_b"))
+				Expect(string(s.Data["password-previous"])).To(Equal("user-password"))
+				Expect(string(s.Data["password"])).NotTo(Equal("user-password"))
+			})
+
+			It("should switch the active user", func() {
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Status.ActiveUser).To(Equal("app_b"))
+				Expect(u.Status.LastRotationTime.Time).To(BeTemporally("~", time.Now(), time.Minute))
+			})
+
+			It("should requeue for the next rotation", func() {
+				Ω(res.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+			})
+		})
+
+		When("roles changed in spec", func() {
+			BeforeEach(func() {
+				user.Spec.Roles = []string{"analytics", "readonly"}
+				user.Spec.DefaultRole = "readonly"
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+						"GRANT `analytics` TO `app`@`%`",
+						"GRANT `writer` TO `app`@`%`",
+						"GRANT SELECT ON `app`.* TO `app`@`%`",
+						"SET DEFAULT ROLE `writer` FOR `app`@`%`",
+					}), nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("GRANT `readonly` TO ?@?", UserName, "%"))).Return(nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("SET DEFAULT ROLE `readonly` FOR ?@?", UserName, "%"))).Return(nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("REVOKE `writer` FROM ?@?", UserName, "%"))).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+						"GRANT `analytics` TO `app`@`%`",
+						"GRANT `readonly` TO `app`@`%`",
+						"GRANT SELECT ON `app`.* TO `app`@`%`",
+						"SET DEFAULT ROLE `readonly` FOR `app`@`%`",
+					}), nil),
+				)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should record roles of the user", func() {
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Status.Grants).To(HaveLen(1))
+				Expect(u.Status.Grants[0].Roles).To(Equal([]string{"analytics", "readonly"}))
+				Expect(u.Status.Grants[0].DefaultRole).To(Equal("readonly"))
+			})
+		})
+
+		When("default role is not granted", func() {
+			BeforeEach(func() {
+				user.Spec.Roles = []string{"analytics"}
+				user.Spec.DefaultRole = "readonly"
+			})
+
+			It("should error", func() {
+				Ω(err).NotTo(BeNil())
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Status.Condition.Status).To(Equal(v1alpha1.MariaDBStatusError))
+			})
+		})
+
+		When("user authenticates with ed25519 password hash and client certificate", func() {
+			BeforeEach(func() {
+				secret.Data["hash"] = []byte("ZIgUREUg5PVgQ6LskhXmO+eZLS0nC8be6HPjYWR4YJY")
+				user.Spec.Authentication = &v1alpha1.MariaDBUserAuthentication{
+					Plugin: v1alpha1.AuthPluginED25519,
+					PasswordHash: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "user-secret",
+						},
+						Key: "hash",
+					},
+				}
+				user.Spec.Require = &v1alpha1.MariaDBUserTLSRequirement{
+					Subject: "/CN=app",
+					Issuer:  "/CN=ca",
+				}
+				configure := mysql.BuildAtomicQuery(
+					mysql.NewQuery("CREATE USER IF NOT EXISTS ?@? IDENTIFIED VIA ed25519 USING ?", UserName, "%", "hash"),
+					mysql.NewQuery("ALTER USER ?@? IDENTIFIED VIA ed25519 USING ? REQUIRE SUBJECT ? AND ISSUER ?"+withLimits+accountOptions,
+						UserName, "%", "hash", "/CN=app", "/CN=ca", 0, 0, 0, 0, 0),
+					mysql.NewQuery("GRANT select ON `app`.* TO ?@?", UserName, "%"),
+				)
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(configure)).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT SELECT ON `app`.* TO `app`@`%`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+		})
+
+		When("user authenticates with unix socket", func() {
+			BeforeEach(func() {
+				user.Spec.Password = nil
+				user.Spec.Authentication = &v1alpha1.MariaDBUserAuthentication{
+					Plugin: v1alpha1.AuthPluginUnixSocket,
+				}
+				configure := mysql.BuildAtomicQuery(
+					mysql.NewQuery("CREATE USER IF NOT EXISTS ?@? IDENTIFIED VIA unix_socket", UserName, "%"),
+					mysql.NewQuery("ALTER USER ?@? IDENTIFIED VIA unix_socket REQUIRE NONE"+withLimits+accountOptions, UserName, "%", 0, 0, 0, 0, 0),
+					mysql.NewQuery("GRANT select ON `app`.* TO ?@?", UserName, "%"),
+				)
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(configure)).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT SELECT ON `app`.* TO `app`@`%`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("shouldn't generate password", func() {
+				var s corev1.Secret
+				err = cl.Get(context.TODO(), types.NamespacedName{Name: UserName + "-password", Namespace: Namespace}, &s)
+				Ω(err).NotTo(BeNil())
+			})
+		})
+
+		When("password rotation is combined with password hash", func() {
+			BeforeEach(func() {
+				user.Spec.Authentication = &v1alpha1.MariaDBUserAuthentication{
+					PasswordHash: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "user-secret",
+						},
+						Key: "hash",
+					},
+				}
+				user.Spec.PasswordRotation = &v1alpha1.PasswordRotation{}
+			})
+
+			It("should error", func() {
+				Ω(err).NotTo(BeNil())
+			})
+		})
+
+		When("limits are set in spec", func() {
+			BeforeEach(func() {
+				user.Spec.ResourceLimits = v1alpha1.MariaDBUserLimits{
+					MaxUserConnections: 10,
+					MaxStatementTime:   30,
+				}
+				limits = v1alpha1.MariaDBUserLimits{MaxUserConnections: 10, MaxStatementTime: 30}
+				configure := mysql.BuildAtomicQuery(
+					mysql.NewQuery("CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?", UserName, "%", "user-password"),
+					mysql.NewQuery("ALTER USER ?@? IDENTIFIED BY ? REQUIRE NONE"+withLimits+accountOptions, UserName, "%", "user-password", 0, 0, 30, 0, 10),
+					mysql.NewQuery("GRANT select ON `app`.* TO ?@?", UserName, "%"),
+				)
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(configure)).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT SELECT ON `app`.* TO `app`@`%`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should record effective limits", func() {
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Status.Grants).To(HaveLen(1))
+				Expect(u.Status.Grants[0].Limits).To(Equal(&v1alpha1.MariaDBUserLimits{MaxUserConnections: 10, MaxStatementTime: 30}))
+			})
+		})
+
+		When("user is suspended", func() {
+			BeforeEach(func() {
+				days := int32(90)
+				user.Spec.Suspended = true
+				user.Spec.PasswordExpireIntervalDays = &days
+				configure := mysql.BuildAtomicQuery(
+					mysql.NewQuery("CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?", UserName, "%", "user-password"),
+					mysql.NewQuery("ALTER USER ?@? IDENTIFIED BY ? REQUIRE NONE"+withLimits+" PASSWORD EXPIRE INTERVAL ? DAY ACCOUNT LOCK",
+						UserName, "%", "user-password", 0, 0, 0, 0, 0, 90),
+					mysql.NewQuery("GRANT select ON `app`.* TO ?@?", UserName, "%"),
+				)
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(configure)).Return(nil)
+				sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+					"GRANT SELECT ON `app`.* TO `app`@`%`",
+				}), nil)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should keep grants and report the user as suspended", func() {
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Status.Condition.Reason).To(Equal("user suspended"))
+				Expect(u.Status.Grants).To(HaveLen(1))
+				Expect(u.Status.Grants[0].Permissions).NotTo(BeEmpty())
+			})
+		})
+
+		When("user with Retain policy is deleted", func() {
+			BeforeEach(func() {
+				now := metav1.Now()
+				user.DeletionTimestamp = &now
+				user.Finalizers = []string{"mariadb-operator.mkaciuba.com/user"}
+				user.Status.AllowedHosts = []string{"%"}
+				user.Spec.DeletionPolicy = v1alpha1.DeletionPolicyRetain
+			})
+
+			It("should keep the user in database and remove finalizer", func() {
+				Ω(err).To(BeNil())
+				Expect(<-recorder.Events).To(ContainSubstring("UserRetained"))
+
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Finalizers).To(BeEmpty())
+			})
+		})
+
+		When("user is deleted", func() {
+			BeforeEach(func() {
+				now := metav1.Now()
+				user.DeletionTimestamp = &now
+				user.Finalizers = []string{"mariadb-operator.mkaciuba.com/user"}
+				user.Status.AllowedHosts = []string{"%"}
+				sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(mysql.NewQuery("DROP USER IF EXISTS ?@?;", UserName, "%"))).Return(nil)
+			})
+
+			It("should drop the user", func() {
+				Ω(err).To(BeNil())
+				Expect(<-recorder.Events).To(ContainSubstring("UserDeleted"))
+			})
+		})
+
+		When("permissions were removed from spec", func() {
+			BeforeEach(func() {
+				revoke := mysql.BuildAtomicQuery(
+					mysql.NewQuery("REVOKE INSERT, UPDATE ON `app`.* FROM ?@?", UserName, "%"),
+					mysql.NewQuery("REVOKE ALL PRIVILEGES, GRANT OPTION ON `other`.`table` FROM ?@?", UserName, "%"),
+				)
+				grant := mysql.NewQuery("GRANT select ON `app`.* TO ?@?", UserName, "%")
+				gomock.InOrder(
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), gomock.Any()).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+						"GRANT USAGE ON *.* TO `app`@`%`",
+						"GRANT SELECT, INSERT, UPDATE ON `app`.* TO `app`@`%`",
+						"GRANT ALL PRIVILEGES ON `other`.`table` TO `app`@`%` WITH GRANT OPTION",
+					}), nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(revoke)).Return(nil),
+					sqlRunner.EXPECT().QueryExec(gomock.Any(), EqQuery(grant)).Return(nil),
+					sqlRunner.EXPECT().QueryRows(gomock.Any(), EqQuery(showGrants)).Return(grantRows(mockCtrl, []string{
+						"GRANT USAGE ON *.* TO `app`@`%`",
+						"GRANT SELECT ON `app`.* TO `app`@`%`",
+					}), nil),
+				)
+			})
+
+			It("shouldn't error", func() {
+				Ω(err).To(BeNil())
+			})
+
+			It("should record grants left after revoke", func() {
+				var u v1alpha1.MariaDBUser
+				err = cl.Get(context.TODO(), req.NamespacedName, &u)
+				Ω(err).To(BeNil())
+				Expect(u.Status.Grants).To(HaveLen(1))
+				Expect(u.Status.Grants[0].Permissions).To(Equal([]v1alpha1.MariaDBPermission{
+					{Schema: "app", Tables: []string{"*"}, Permissions: []string{"SELECT"}},
+				}))
+			})
+		})
+	})
+})
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/utils"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+const (
+	// RotatePasswordAnnotation set on the MariaDBUser requests rotation of the password, it's removed once it's done
+	RotatePasswordAnnotation = "mariadb/rotate-password"
+	// ActiveUserAnnotation is set on the password secret in dual user scheme to the user the password belongs to
+	ActiveUserAnnotation = "mariadb/active-user"
+)
+
+// isRotationDue checks if the password has to be rotated now
+func (r *MariaDBUserReconciler) isRotationDue(user *mariadbv1alpha1.MariaDBUser, secret *corev1.Secret) bool {
+	if _, ok := user.Annotations[RotatePasswordAnnotation]; ok {
+		return true
+	}
+
+	next := nextRotationTime(user, secret)
+	return next != nil && !next.After(time.Now())
+}
+
+// nextRotationTime returns time of the next periodic rotation, the first one is counted from creation of the password secret
+func nextRotationTime(user *mariadbv1alpha1.MariaDBUser, secret *corev1.Secret) *time.Time {
+	rotation := user.Spec.PasswordRotation
+	if rotation == nil || rotation.Interval == nil || rotation.Interval.Duration <= 0 {
+		return nil
+	}
+
+	last := secret.CreationTimestamp.Time
+	if user.Status.LastRotationTime != nil {
+		last = user.Status.LastRotationTime.Time
+	}
+	next := last.Add(rotation.Interval.Duration)
+
+	return &next
+}
+
+// getRotationRequeue returns time until the next periodic rotation, zero when the password isn't rotated periodically
+func (r *MariaDBUserReconciler) getRotationRequeue(ctx context.Context, user *mariadbv1alpha1.MariaDBUser) (time.Duration, error) {
+	rotation := user.Spec.PasswordRotation
+	if rotation == nil || rotation.Interval == nil {
+		return 0, nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Name: user.GetPasswordSecretKey().Name, Namespace: user.Namespace}, secret)
+	if err != nil {
+		return 0, err
+	}
+
+	next := nextRotationTime(user, secret)
+	if next == nil {
+		return 0, nil
+	}
+	if wait := time.Until(*next); wait > time.Second {
+		return wait, nil
+	}
+
+	return time.Second, nil
+}
+
+// rotatePassword writes a new password to the secret, in dual user scheme the password is given to the inactive user
+// and the current password is kept for the previous user
+func (r *MariaDBUserReconciler) rotatePassword(ctx context.Context, user *mariadbv1alpha1.MariaDBUser, secret *corev1.Secret, log logr.Logger) error {
+	selector := user.GetPasswordSecretKey()
+	password, err := utils.RandPassword(generatedPasswordLength)
+	if err != nil {
+		return fmt.Errorf("failed to generate password, err: %s", err)
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	if usernames := user.GetUsernames(); len(usernames) > 1 {
+		next := usernames[0]
+		if getActiveUser(user, secret) == usernames[0] {
+			next = usernames[1]
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[ActiveUserAnnotation] = next
+		secret.Data[previousPasswordKey(selector.Key)] = secret.Data[selector.Key]
+	}
+	secret.Data[selector.Key] = []byte(password)
+
+	log.Info("rotating password", "username", user.Spec.User, "secret", secret.Name)
+	if err := r.Update(ctx, secret); err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	user.Status.LastRotationTime = &now
+	delete(user.Annotations, RotatePasswordAnnotation)
+
+	return nil
+}
+
+// getActiveUser returns the user the password in the secret belongs to in dual user scheme
+func getActiveUser(user *mariadbv1alpha1.MariaDBUser, secret *corev1.Secret) string {
+	usernames := user.GetUsernames()
+	if active := secret.Annotations[ActiveUserAnnotation]; active == usernames[1] {
+		return active
+	}
+
+	return usernames[0]
+}
+
+func previousPasswordKey(key string) string {
+	return key + "-previous"
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/utils"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// generatedPasswordLength is the length of passwords generated for users
+	generatedPasswordLength = 32
+	// mysqlPort is the port the cluster services listen on
+	mysqlPort = 3306
+)
+
+// userCredentials are the accounts of the MariaDBUser in the database
+type userCredentials struct {
+	activeUser       string
+	password         string
+	passwordHash     string
+	previousUser     string
+	previousPassword string
+}
+
+// getCredentials returns credentials of the user, password secret is created when the password is generated by the operator
+// and the password is rotated when it's due
+func (r *MariaDBUserReconciler) getCredentials(ctx context.Context, user *mariadbv1alpha1.MariaDBUser, log logr.Logger) (*userCredentials, error) {
+	if !user.UsesPassword() {
+		return &userCredentials{activeUser: user.Spec.User}, nil
+	}
+	if user.Spec.Authentication != nil && user.Spec.Authentication.PasswordHash != nil {
+		return r.getHashedCredentials(ctx, user)
+	}
+
+	selector := user.GetPasswordSecretKey()
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Name: selector.Name, Namespace: user.Namespace}, secret)
+	if apiErrors.IsNotFound(err) && user.Spec.Password == nil {
+		password, err := utils.RandPassword(generatedPasswordLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate password, err: %s", err)
+		}
+
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      selector.Name,
+				Namespace: user.Namespace,
+			},
+			Data: map[string][]byte{
+				selector.Key: []byte(password),
+			},
+		}
+		if err := controllerutil.SetControllerReference(user, secret, r.Scheme); err != nil {
+			return nil, err
+		}
+
+		log.Info("creating secret with generated password", "secret", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if r.isRotationDue(user, secret) {
+		if err := r.rotatePassword(ctx, user, secret, log); err != nil {
+			return nil, err
+		}
+	}
+
+	credentials := &userCredentials{
+		activeUser: user.Spec.User,
+		password:   string(secret.Data[selector.Key]),
+	}
+	if credentials.password == "" {
+		return nil, errors.New("the MariaDB user's password must not be empty")
+	}
+
+	if usernames := user.GetUsernames(); len(usernames) > 1 {
+		credentials.activeUser = getActiveUser(user, secret)
+		credentials.previousUser = usernames[0]
+		if credentials.activeUser == usernames[0] {
+			credentials.previousUser = usernames[1]
+		}
+		credentials.previousPassword = string(secret.Data[previousPasswordKey(selector.Key)])
+	}
+
+	return credentials, nil
+}
+
+// getHashedCredentials returns credentials with the password hash of the user
+func (r *MariaDBUserReconciler) getHashedCredentials(ctx context.Context, user *mariadbv1alpha1.MariaDBUser) (*userCredentials, error) {
+	selector := user.Spec.Authentication.PasswordHash
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Name: selector.Name, Namespace: user.Namespace}, secret); err != nil {
+		return nil, err
+	}
+
+	hash := string(secret.Data[selector.Key])
+	if hash == "" {
+		return nil, errors.New("the MariaDB user's password hash must not be empty")
+	}
+
+	return &userCredentials{activeUser: user.Spec.User, passwordHash: hash}, nil
+}
+
+// reconcileConnectionSecret writes connection details of the user into the secret owned by the user
+func (r *MariaDBUserReconciler) reconcileConnectionSecret(ctx context.Context, user *mariadbv1alpha1.MariaDBUser, credentials *userCredentials, log logr.Logger) error {
+	if user.Spec.ConnectionSecret == nil {
+		return nil
+	}
+
+	cluster := &mariadbv1alpha1.MariaDBCluster{}
+	if err := r.Get(ctx, user.GetClusterKey(), cluster); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      user.Spec.ConnectionSecret.Name,
+			Namespace: user.Namespace,
+		},
+		Data: connectionSecretData(cluster.GetPrimaryAddress(), credentials.activeUser, credentials.password, user.Spec.ConnectionSecret.Database),
+	}
+	if err := controllerutil.SetControllerReference(user, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	found := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Name: secret.Name, Namespace: secret.Namespace}, found)
+	if err != nil && apiErrors.IsNotFound(err) {
+		log.Info("creating connection secret", "secret", secret.Name)
+		return r.Create(ctx, secret)
+	} else if err != nil {
+		return err
+	}
+
+	if !metav1.IsControlledBy(found, user) {
+		return fmt.Errorf("secret %s already exists and is not owned by the user", secret.Name)
+	}
+
+	if !reflect.DeepEqual(found.Data, secret.Data) {
+		log.Info("updating connection secret", "secret", secret.Name)
+		found.Data = secret.Data
+		return r.Update(ctx, found)
+	}
+
+	return nil
+}
+
+// connectionSecretData returns connection details in the formats commonly used by applications
+func connectionSecretData(host, user, password, database string) map[string][]byte {
+	address := fmt.Sprintf("%s:%d", host, mysqlPort)
+	uri := url.URL{
+		Scheme: "mysql",
+		User:   url.UserPassword(user, password),
+		Host:   address,
+		Path:   "/" + database,
+	}
+	jdbcQuery := url.Values{}
+	jdbcQuery.Set("user", user)
+	jdbcQuery.Set("password", password)
+
+	return map[string][]byte{
+		"host":     []byte(host),
+		"port":     []byte(fmt.Sprintf("%d", mysqlPort)),
+		"user":     []byte(user),
+		"password": []byte(password),
+		"database": []byte(database),
+		"dsn":      []byte(fmt.Sprintf("%s:%s@tcp(%s)/%s", user, password, address, database)),
+		"uri":      []byte(uri.String()),
+		"jdbcUrl":  []byte(fmt.Sprintf("jdbc:mariadb://%s/%s?%s", address, database, jdbcQuery.Encode())),
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// galeraConfig holds the options of galera.cnf managed by the agent
+type galeraConfig struct {
+	NodeAddress    string
+	ClusterName    string
+	ClusterAddress string
+}
+
+// clusterAddress returns wsrep_cluster_address listing the peers, an empty list bootstraps a new cluster
+func clusterAddress(peers []string) string {
+	return "gcomm://" + strings.Join(peers, ",")
+}
+
+// render replaces the managed options in the galera config, other lines are kept untouched
+func (c galeraConfig) render(current string) string {
+	options := map[string]string{
+		"wsrep_node_address":    c.NodeAddress,
+		"wsrep_cluster_name":    c.ClusterName,
+		"wsrep_cluster_address": c.ClusterAddress,
+	}
+
+	var b strings.Builder
+	written := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(current))
+	for scanner.Scan() {
+		line := scanner.Text()
+		name := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		if value, ok := options[name]; ok && strings.Contains(line, "=") {
+			if !written[name] {
+				fmt.Fprintf(&b, "%s=%s\n", name, value)
+				written[name] = true
+			}
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	// options missing in the file are appended, they have to be in the galera section which is the only one of the file
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !written[name] {
+			fmt.Fprintf(&b, "%s=%s\n", name, options[name])
+		}
+	}
+
+	return b.String()
+}
+
+// write renders the config into the file, the file is replaced atomically so mysqld never reads it half written
+func (c galeraConfig) write(path string) error {
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	rendered := c.render(string(current))
+	if rendered == string(current) {
+		return nil
+	}
+
+	// mysqld includes every .cnf file of the directory, a temporary file left behind mustn't be one of them
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".galera-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(rendered); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// mysqld ignores world-writable config files
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
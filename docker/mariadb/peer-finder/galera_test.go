@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGaleraConfigRender(t *testing.T) {
+	config := galeraConfig{
+		NodeAddress:    "10.0.0.1",
+		ClusterName:    "example",
+		ClusterAddress: "gcomm://10.0.0.2,10.0.0.3",
+	}
+
+	tests := []struct {
+		name    string
+		current string
+		want    string
+	}{
+		{
+			name:    "empty config",
+			current: "",
+			want: "wsrep_cluster_address=gcomm://10.0.0.2,10.0.0.3\n" +
+				"wsrep_cluster_name=example\n" +
+				"wsrep_node_address=10.0.0.1\n",
+		},
+		{
+			name: "options are replaced in place",
+			current: "[galera]\n" +
+				"wsrep_on=ON\n" +
+				"wsrep_cluster_address = gcomm://\n" +
+				"wsrep_cluster_name=old\n" +
+				"wsrep_node_address=10.0.0.9\n" +
+				"binlog_format=ROW\n",
+			want: "[galera]\n" +
+				"wsrep_on=ON\n" +
+				"wsrep_cluster_address=gcomm://10.0.0.2,10.0.0.3\n" +
+				"wsrep_cluster_name=example\n" +
+				"wsrep_node_address=10.0.0.1\n" +
+				"binlog_format=ROW\n",
+		},
+		{
+			name: "missing options are appended",
+			current: "[galera]\n" +
+				"wsrep_cluster_name=old\n",
+			want: "[galera]\n" +
+				"wsrep_cluster_name=example\n" +
+				"wsrep_cluster_address=gcomm://10.0.0.2,10.0.0.3\n" +
+				"wsrep_node_address=10.0.0.1\n",
+		},
+		{
+			name: "duplicate options are written once",
+			current: "wsrep_cluster_address=gcomm://10.0.0.4\n" +
+				"wsrep_cluster_address=gcomm://10.0.0.5\n",
+			want: "wsrep_cluster_address=gcomm://10.0.0.2,10.0.0.3\n" +
+				"wsrep_cluster_name=example\n" +
+				"wsrep_node_address=10.0.0.1\n",
+		},
+		{
+			name: "comments and options without value are kept",
+			current: "# wsrep_cluster_address=gcomm://\n" +
+				"wsrep_cluster_address\n",
+			want: "# wsrep_cluster_address=gcomm://\n" +
+				"wsrep_cluster_address\n" +
+				"wsrep_cluster_address=gcomm://10.0.0.2,10.0.0.3\n" +
+				"wsrep_cluster_name=example\n" +
+				"wsrep_node_address=10.0.0.1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.render(tt.current); got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGaleraConfigRenderIsStable(t *testing.T) {
+	config := galeraConfig{NodeAddress: "10.0.0.1", ClusterName: "example", ClusterAddress: "gcomm://10.0.0.2"}
+	rendered := config.render("[galera]\nwsrep_on=ON\n")
+	if again := config.render(rendered); again != rendered {
+		t.Errorf("render() of rendered config = %q, want %q", again, rendered)
+	}
+}
+
+func TestGaleraConfigWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "galera.cnf")
+	if err := ioutil.WriteFile(path, []byte("[galera]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := galeraConfig{NodeAddress: "10.0.0.1", ClusterName: "example", ClusterAddress: "gcomm://10.0.0.2"}
+	if err := config.write(path); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := config.render("[galera]\n"); string(written) != want {
+		t.Errorf("written config = %q, want %q", written, want)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("config directory contains %v, want only %s", files, path)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/aldor007/mariadb-operator/docker/mariadb/peer-finder
 go 1.16
 
 require (
+	k8s.io/api v0.21.0
 	k8s.io/apimachinery v0.21.0
 	k8s.io/client-go v0.21.0
 )
@@ -14,108 +14,249 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// A small utility program to lookup hostnames of endpoints in a service.
+// An agent keeping wsrep_cluster_address of the local galera node in sync with the pods of the cluster.
+// It watches the pods with an informer, writes galera.cnf once every peer has an IP and keeps it up to date
+// while mysqld runs. The membership it sees is served as JSON on /status.
 package main
 
 import (
-	"context"
+	"encoding/json"
 	"flag"
-	"fmt"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
-	"os/exec"
 	"sort"
-	"strings"
+	"sync"
 	"time"
 
-	//
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
 var (
-	onStart    = flag.String("on-start", "", "Script to run on start, must accept a new line separated list of peers via stdin.")
-	namespace  = flag.String("ns", "", "The namespace this pod is running in. If unspecified, the POD_NAMESPACE env var is used.")
-	labelSelector = flag.String("labels", "", "Label selector")
+	namespace     = flag.String("ns", os.Getenv("MY_POD_NAMESPACE"), "The namespace this pod is running in. If unspecified, the MY_POD_NAMESPACE env var is used.")
+	labelSelector = flag.String("labels", "", "Label selector of the pods of the galera cluster")
+	podIP         = flag.String("pod-ip", os.Getenv("MY_POD_IP"), "IP of this pod, used as wsrep_node_address. If unspecified, the MY_POD_IP env var is used.")
+	clusterName   = flag.String("cluster-name", os.Getenv("CLUSTER_NAME"), "The wsrep_cluster_name. If unspecified, the CLUSTER_NAME env var is used.")
+	configFile    = flag.String("config", "/etc/mysql/conf.d/galera.cnf", "The galera config kept up to date by the agent")
+	readyFile     = flag.String("ready-file", "", "File created once the galera config is written for the first time")
+	bootstrap     = flag.Bool("bootstrap", false, "Bootstrap a new cluster instead of joining the peers")
+	listenAddress = flag.String("listen-address", ":3308", "Address of the HTTP status endpoint")
 )
 
-func shellOut(sendStdin, script string) {
-	log.Printf("execing: %v with stdin: %v", script, sendStdin)
-	// TODO: Switch to sending stdin from go
-	out, err := exec.Command("bash", "-c", fmt.Sprintf("echo -e '%v' | %v", sendStdin, script)).CombinedOutput()
-	if err != nil {
-		log.Fatalf("Failed to execute %v: %v, err: %v", script, string(out), err)
+// status is the membership seen by the agent, it's served on /status
+type status struct {
+	// Ready is true once the galera config was written
+	Ready bool `json:"ready"`
+	// PodIP is the address of the local node
+	PodIP string `json:"podIP"`
+	// Peers are IPs of the pods of the cluster, including the local one
+	Peers []string `json:"peers"`
+	// Pending are names of the pods without IP, the config is not written until they get one
+	Pending []string `json:"pending,omitempty"`
+	// ClusterAddress is the wsrep_cluster_address written into the config
+	ClusterAddress string `json:"clusterAddress,omitempty"`
+	// Bootstrap is true when the local node starts a new cluster
+	Bootstrap bool `json:"bootstrap"`
+	// UpdateTime is when the config was written last time
+	UpdateTime *time.Time `json:"updateTime,omitempty"`
+	// Error is the last error of writing the config
+	Error string `json:"error,omitempty"`
+}
+
+type agent struct {
+	config    galeraConfig
+	path      string
+	readyFile string
+	pods      corelisters.PodLister
+	changes   chan struct{}
+
+	mu     sync.RWMutex
+	status status
+}
+
+func newAgent(pods corelisters.PodLister) *agent {
+	return &agent{
+		config: galeraConfig{
+			NodeAddress: *podIP,
+			ClusterName: *clusterName,
+		},
+		path:      *configFile,
+		readyFile: *readyFile,
+		pods:      pods,
+		changes:   make(chan struct{}, 1),
+		status: status{
+			PodIP:     *podIP,
+			Peers:     []string{},
+			Bootstrap: *bootstrap,
+		},
 	}
-	log.Print(string(out))
 }
 
-func extractIps(list []string) []string {
-	result := make([]string, len(list))
-	for i, _ := range list {
-		parts := strings.Split(list[i], ".")
-		result[i] = strings.Replace(parts[0], "-", ".", 3)
+// notify schedules the sync, the events coming while the sync runs are merged into one
+func (a *agent) notify() {
+	select {
+	case a.changes <- struct{}{}:
+	default:
 	}
+}
 
-	return result
+func (a *agent) run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-a.changes:
+			if err := a.sync(); err != nil {
+				log.Printf("Failed to write galera config: %v", err)
+				a.mu.Lock()
+				a.status.Error = err.Error()
+				a.mu.Unlock()
+			}
+		}
+	}
 }
 
-func main() {
-	flag.Parse()
+// sync writes wsrep_cluster_address with the IPs of the other pods. Before the first write it waits for every pod
+// to get an IP, a node which doesn't see its peers would bootstrap a new cluster. Later the address is not emptied
+// when the peers are gone, it would bootstrap a new cluster on the next start of mysqld too.
+func (a *agent) sync() error {
+	pods, err := a.pods.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
 
-	ns := *namespace
-	if ns == "" {
-		ns = os.Getenv("NAMESPACE")
+	peers := []string{}
+	others := []string{}
+	pending := []string{}
+	self := false
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if pod.Status.PodIP == "" {
+			pending = append(pending, pod.Name)
+			continue
+		}
+		peers = append(peers, pod.Status.PodIP)
+		if pod.Status.PodIP == a.config.NodeAddress {
+			self = true
+		} else {
+			others = append(others, pod.Status.PodIP)
+		}
 	}
-	script := *onStart
+	sort.Strings(peers)
+	sort.Strings(others)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.Peers = peers
+	a.status.Pending = pending
 
-	if ns == "" && labelSelector == nil ||  *onStart == "" {
-		log.Fatalf("Incomplete args, require -on-change and/or -on-start, -service and -ns or an env var for POD_NAMESPACE.")
+	config := a.config
+	switch {
+	case !a.status.Ready && a.status.Bootstrap:
+		config.ClusterAddress = clusterAddress(nil)
+	case !a.status.Ready && (len(pending) > 0 || !self):
+		log.Printf("Waiting for pods to get IP, pending %v, found itself %t", pending, self)
+		return nil
+	case a.status.Ready && len(others) == 0:
+		log.Printf("No peers found, keeping %s", a.status.ClusterAddress)
+		return nil
+	default:
+		config.ClusterAddress = clusterAddress(others)
+	}
+	if config.ClusterAddress == a.status.ClusterAddress {
+		return nil
+	}
+
+	if err := config.write(a.path); err != nil {
+		return err
+	}
+	now := time.Now()
+	log.Printf("Peer list updated to %v, wsrep_cluster_address=%s", peers, config.ClusterAddress)
+	a.status.ClusterAddress = config.ClusterAddress
+	a.status.UpdateTime = &now
+	a.status.Error = ""
+
+	if !a.status.Ready {
+		if a.readyFile != "" {
+			if err := ioutil.WriteFile(a.readyFile, []byte(config.ClusterAddress), 0644); err != nil {
+				return err
+			}
+		}
+		a.status.Ready = true
+	}
+
+	return nil
+}
+
+func (a *agent) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.status); err != nil {
+		log.Printf("Failed to write status: %v", err)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if *namespace == "" || *labelSelector == "" || *podIP == "" {
+		log.Fatalf("Incomplete args, require -labels, -ns and -pod-ip or MY_POD_NAMESPACE and MY_POD_IP env vars.")
 	}
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		panic(err.Error())
+		log.Fatalf("Failed to load in-cluster config: %v", err)
 	}
-	// creates the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		panic(err.Error())
+		log.Fatalf("Failed to create client: %v", err)
 	}
-	// get pods in all the namespaces by omitting namespace
-	// Or specify namespace to get pods in particular namespace
-	log.Printf("Using ns %s labels %s", ns, *labelSelector)
-	peerList := make([]string, 0)
-	emptyIp := true
-	for emptyIp  {
-		pods, err := clientset.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: *labelSelector,
-		})
-		log.Printf("PODs len %d \n", len(pods.Items))
-		if err != nil {
-			panic(err.Error())
-		}
-		counterIps := 0
-		for _, pod := range pods.Items {
-			if pod.Status.PodIP == "" {
-				log.Printf("POD IP is empty\n")
-			} else {
-				peerList = append(peerList, pod.Status.PodIP)
-				counterIps = counterIps + 1
-			}
-		}
-		if counterIps == len(pods.Items) {
-			emptyIp = false
+
+	log.Printf("Using ns %s labels %s", *namespace, *labelSelector)
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(*namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = *labelSelector
+		}))
+	podInformer := factory.Core().V1().Pods()
+	a := newAgent(podInformer.Lister())
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { a.notify() },
+		UpdateFunc: func(interface{}, interface{}) { a.notify() },
+		DeleteFunc: func(interface{}) { a.notify() },
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", a.serveStatus)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	go func() {
+		log.Printf("Serving status on %s", *listenAddress)
+		if err := http.ListenAndServe(*listenAddress, mux); err != nil {
+			log.Printf("Status endpoint stopped: %v", err)
 		}
-		time.Sleep(10*time.Second)
-	}
+	}()
 
-	if len(peerList) == 0 {
-		log.Printf("List is empty")
-		panic("list should not be empty")
+	stop := make(chan struct{})
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, podInformer.Informer().HasSynced) {
+		log.Fatalf("Failed to sync pods")
 	}
-
-	sort.Strings(peerList)
-	log.Printf("Peer list updated was %v len %d \n", peerList, len(peerList))
-	shellOut(strings.Join(peerList, "\n"), script)
-	log.Printf("Peer finder exiting")
+	a.notify()
+	a.run(stop)
 }
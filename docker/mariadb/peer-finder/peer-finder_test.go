@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newPod(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status:     corev1.PodStatus{PodIP: ip, Phase: phase},
+	}
+}
+
+func newPodLister(t *testing.T, pods ...*corev1.Pod) corelisters.PodLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, pod := range pods {
+		if err := indexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return corelisters.NewPodLister(indexer)
+}
+
+func TestAgentSync(t *testing.T) {
+	tests := []struct {
+		name      string
+		pods      []*corev1.Pod
+		status    status
+		want      string
+		wantReady bool
+		pending   []string
+	}{
+		{
+			name: "waits for pods without IP",
+			pods: []*corev1.Pod{
+				newPod("mariadb-0", "10.0.0.1", corev1.PodRunning),
+				newPod("mariadb-1", "", corev1.PodPending),
+			},
+			pending: []string{"mariadb-1"},
+		},
+		{
+			name: "waits until the pod finds itself",
+			pods: []*corev1.Pod{
+				newPod("mariadb-1", "10.0.0.2", corev1.PodRunning),
+			},
+		},
+		{
+			name: "joins the other pods",
+			pods: []*corev1.Pod{
+				newPod("mariadb-2", "10.0.0.3", corev1.PodRunning),
+				newPod("mariadb-0", "10.0.0.1", corev1.PodRunning),
+				newPod("mariadb-1", "10.0.0.2", corev1.PodRunning),
+			},
+			want:      "gcomm://10.0.0.2,10.0.0.3",
+			wantReady: true,
+		},
+		{
+			name: "the first pod alone starts a new cluster",
+			pods: []*corev1.Pod{
+				newPod("mariadb-0", "10.0.0.1", corev1.PodRunning),
+			},
+			want:      "gcomm://",
+			wantReady: true,
+		},
+		{
+			name: "skips stopped pods",
+			pods: []*corev1.Pod{
+				newPod("mariadb-0", "10.0.0.1", corev1.PodRunning),
+				newPod("mariadb-1", "", corev1.PodFailed),
+				newPod("mariadb-2", "10.0.0.3", corev1.PodSucceeded),
+			},
+			want:      "gcomm://",
+			wantReady: true,
+		},
+		{
+			name: "bootstrap doesn't wait for the peers",
+			pods: []*corev1.Pod{
+				newPod("mariadb-bootstrap", "10.0.0.1", corev1.PodRunning),
+				newPod("mariadb-0", "", corev1.PodPending),
+			},
+			status:    status{Bootstrap: true},
+			want:      "gcomm://",
+			wantReady: true,
+			pending:   []string{"mariadb-0"},
+		},
+		{
+			name: "bootstrapped node joins its peers later",
+			pods: []*corev1.Pod{
+				newPod("mariadb-bootstrap", "10.0.0.1", corev1.PodRunning),
+				newPod("mariadb-0", "10.0.0.2", corev1.PodRunning),
+			},
+			status:    status{Bootstrap: true, Ready: true, ClusterAddress: "gcomm://"},
+			want:      "gcomm://10.0.0.2",
+			wantReady: true,
+		},
+		{
+			name: "updates the peers",
+			pods: []*corev1.Pod{
+				newPod("mariadb-0", "10.0.0.1", corev1.PodRunning),
+				newPod("mariadb-1", "10.0.0.4", corev1.PodRunning),
+				newPod("mariadb-2", "", corev1.PodPending),
+			},
+			status:    status{Ready: true, ClusterAddress: "gcomm://10.0.0.2,10.0.0.3"},
+			want:      "gcomm://10.0.0.4",
+			wantReady: true,
+			pending:   []string{"mariadb-2"},
+		},
+		{
+			name: "keeps the peers when all of them are gone",
+			pods: []*corev1.Pod{
+				newPod("mariadb-0", "10.0.0.1", corev1.PodRunning),
+			},
+			status:    status{Ready: true, ClusterAddress: "gcomm://10.0.0.2,10.0.0.3"},
+			want:      "gcomm://10.0.0.2,10.0.0.3",
+			wantReady: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "galera.cnf")
+			if err := ioutil.WriteFile(path, []byte("[galera]\nwsrep_cluster_address="+tt.status.ClusterAddress+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			a := &agent{
+				config:    galeraConfig{NodeAddress: "10.0.0.1", ClusterName: "example"},
+				path:      path,
+				readyFile: filepath.Join(dir, "ready"),
+				pods:      newPodLister(t, tt.pods...),
+				status:    tt.status,
+			}
+
+			if err := a.sync(); err != nil {
+				t.Fatalf("sync() error = %v", err)
+			}
+
+			if a.status.Ready != tt.wantReady {
+				t.Errorf("status.Ready = %t, want %t", a.status.Ready, tt.wantReady)
+			}
+			if a.status.ClusterAddress != tt.want {
+				t.Errorf("status.ClusterAddress = %q, want %q", a.status.ClusterAddress, tt.want)
+			}
+			if len(a.status.Pending)+len(tt.pending) > 0 && !reflect.DeepEqual(a.status.Pending, tt.pending) {
+				t.Errorf("status.Pending = %v, want %v", a.status.Pending, tt.pending)
+			}
+
+			config, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && !strings.Contains(string(config), "wsrep_cluster_address="+tt.want+"\n") {
+				t.Errorf("galera config %q doesn't contain wsrep_cluster_address=%s", config, tt.want)
+			}
+
+			ready, err := ioutil.ReadFile(a.readyFile)
+			switch {
+			case tt.status.Ready:
+				// the ready file is written only by the first sync
+			case tt.wantReady && (err != nil || string(ready) != tt.want):
+				t.Errorf("ready file = %q, err %v, want %q", ready, err, tt.want)
+			case !tt.wantReady && err == nil:
+				t.Errorf("ready file was written before the config")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+#!/bin/bash
+#
+# Archives closed binary logs of $SOURCE_HOST to $BINLOG_URL for point-in-time recovery.
+# Binary logs are rotated first, so the archive is at most one run behind the cluster.
+# Every archived file is described by a line of $BINLOG_URL/index:
+#   <file> <first seq> <last seq> <first time> <last time> <last gtid>
+# Galera nodes write the same GTIDs to their binary logs, when the source node changes
+# only transactions newer than the last archived one are archived.
+#
+
+set -eo pipefail
+
+if [ -z "$BINLOG_URL" ]; then
+  echo "\$BINLOG_URL is empty"
+  exit 1
+fi
+
+if [ -z "$SOURCE_HOST" ]; then
+  echo "\$SOURCE_HOST is empty"
+  exit 1
+fi
+
+if [ -z "$MYSQL_ROOT_PASSWORD" ]; then
+  echo "\$MYSQL_ROOT_PASSWORD is empty"
+  exit 1
+fi
+
+if [ -z "$PORT" ]; then
+  echo "\$PORT is empty"
+  exit 1
+fi
+source /usr/share/container-scripts/mysql/rclone-config.sh
+
+CONTAINER_SCRIPTS_DIR="/usr/share/container-scripts/mysql"
+WORK_DIR=/tmp/binlog
+GTID_DOMAIN=${GTID_DOMAIN:-1}
+BINLOG_URL=${BINLOG_URL%/}
+
+rclone=( rclone --config /tmp/rclone.conf )
+mysql=( mysql -N -h "${SOURCE_HOST}" -P"${PORT}" -uroot -p"${MYSQL_ROOT_PASSWORD}" )
+
+rm -rf ${WORK_DIR}
+mkdir -p ${WORK_DIR}
+if "${rclone[@]}" lsf --files-only "${BINLOG_URL}" 2> /dev/null | grep -qx index; then
+  "${rclone[@]}" copyto "${BINLOG_URL}/index" ${WORK_DIR}/index
+else
+  touch ${WORK_DIR}/index
+fi
+LAST_SEQ=$(awk 'BEGIN { max = -1 } $3 > max { max = $3 } END { print max }' ${WORK_DIR}/index)
+
+"${mysql[@]}" -e "FLUSH BINARY LOGS"
+LOGS=( $("${mysql[@]}" -e "SHOW BINARY LOGS" | awk '{ print $1 }') )
+
+UPDATED=""
+GAP=""
+# the last binary log is still written
+for ((i = 0; i < ${#LOGS[@]} - 1; i++)); do
+  log=${LOGS[$i]}
+
+  # Gtid_list event at the start of the next binary log contains the last GTID of this one
+  next_seq=$("${mysql[@]}" -e "SHOW BINLOG EVENTS IN '${LOGS[$((i + 1))]}' LIMIT 3" | awk -F'\t' -v domain="$GTID_DOMAIN" '
+    $3 == "Gtid_list" {
+      gsub(/[][ ]/, "", $6)
+      n = split($6, gtids, ",")
+      for (j = 1; j <= n; j++) {
+        split(gtids[j], parts, "-")
+        if (parts[1] == domain) {
+          print parts[3]
+        }
+      }
+    }')
+  if [ -n "$next_seq" ] && [ "$next_seq" -le "$LAST_SEQ" ]; then
+    continue
+  fi
+
+  mysqlbinlog --read-from-remote-server --raw --host="${SOURCE_HOST}" --port="${PORT}" \
+    --user=root --password="${MYSQL_ROOT_PASSWORD}" --result-file=${WORK_DIR}/ "${log}"
+  INFO=$(${CONTAINER_SCRIPTS_DIR}/binlog-info.sh ${WORK_DIR}/${log} ${LAST_SEQ})
+  if [ -n "$INFO" ]; then
+    read -r first_seq last_seq first_time last_time last_gtid position position_seq <<< "$INFO"
+    # transactions purged before they were archived are lost, archiving continues so newer backups can be
+    # recovered, replay-binlogs.sh refuses to replay over the gap
+    if [ "$position" != "0" ] && [ "$LAST_SEQ" -ge 0 ] && [ "$position_seq" != "$((LAST_SEQ + 1))" ]; then
+      GAP="${GAP:+${GAP}, }${log} continues at sequence ${position_seq} after ${LAST_SEQ}"
+    fi
+    if [ "$position" != "0" ]; then
+      name=$(printf "%012d" "${last_seq}")-${log}
+      echo "Archiving ${log} as ${name}"
+      "${rclone[@]}" copyto ${WORK_DIR}/${log} "${BINLOG_URL}/${name}"
+      echo "${name} ${first_seq} ${last_seq} ${first_time} ${last_time} ${last_gtid}" >> ${WORK_DIR}/index
+      LAST_SEQ=${last_seq}
+      UPDATED=yes
+    fi
+  fi
+  rm -f ${WORK_DIR}/${log}
+done
+
+# index is written after the files it describes
+if [ -n "$UPDATED" ]; then
+  "${rclone[@]}" copyto ${WORK_DIR}/index "${BINLOG_URL}/index"
+fi
+
+if [ -n "$GAP" ]; then
+  echo >&2 "Archived binary logs of ${SOURCE_HOST} have a gap: ${GAP}. Backups taken before it can't be recovered past it"
+  exit 1
+fi
+
+# the operator reads the archived position from the termination message
+LAST=$(tail -n 1 ${WORK_DIR}/index)
+if [ -n "$LAST" ]; then
+  read -r _ _ _ _ last_time last_gtid <<< "$LAST"
+  echo "{\"lastGTID\": \"${last_gtid}\", \"lastEventTime\": \"$(date -u -d @${last_time} +%Y-%m-%dT%H:%M:%SZ)\"}" > /dev/termination-log
+fi
+rm -rf ${WORK_DIR}
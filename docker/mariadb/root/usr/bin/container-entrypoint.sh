@@ -10,6 +10,7 @@ set -x
 # Locations
 CONTAINER_SCRIPTS_DIR="/usr/share/container-scripts/mysql"
 EXTRA_DEFAULTS_FILE="/etc/my.cnf.d/galera.cnf"
+PEER_FINDER_READY_FILE="/tmp/peer-finder.ready"
 # Check if the container runs in Kubernetes/OpenShift
 if [ -z "$GALLERA_MODE" ]; then
 	# Single container runs in docker
@@ -35,7 +36,33 @@ else
 	    echo "safe_to_bootstrap: 1" > /var/lib/mysql/grastate.dat
 	    chown mysql:mysql /var/lib/mysql/grastate.dat
 	fi
-	/usr/bin/peer-finder -on-start="${CONTAINER_SCRIPTS_DIR}/configure-galera.sh" -labels="${LABEL_SELECTOR}" -ns=${MY_POD_NAMESPACE}
+	PEER_FINDER_ARGS=(-labels="${LABEL_SELECTOR}" -ns="${MY_POD_NAMESPACE}" -config=/etc/mysql/conf.d/galera.cnf -ready-file="${PEER_FINDER_READY_FILE}")
+	if [ -n "$GALERA_NEW_CLUSTER" ]; then
+		# the operator elected this node with the highest seqno to bootstrap the cluster after all nodes went down
+		echo "Galera: bootstrapping new cluster"
+		sed -i -e "s/^safe_to_bootstrap:.*$/safe_to_bootstrap: 1/" /var/lib/mysql/grastate.dat
+		PEER_FINDER_ARGS+=(-bootstrap)
+		MYSQLD_ARGS="--wsrep-new-cluster"
+	fi
+	# peer-finder keeps running next to mysqld, it writes wsrep_cluster_address once all peers have an IP
+	rm -f "${PEER_FINDER_READY_FILE}"
+	/usr/bin/peer-finder "${PEER_FINDER_ARGS[@]}" &
+	PEER_FINDER_PID=$!
+	until [ -f "${PEER_FINDER_READY_FILE}" ]; do
+		if ! kill -0 ${PEER_FINDER_PID} 2>/dev/null; then
+			echo "Galera: peer-finder exited"
+			exit 1
+		fi
+		sleep 1
+	done
+	echo "Galera: using wsrep_cluster_address=$(cat "${PEER_FINDER_READY_FILE}")"
+fi
+
+if [ -n "$REPLICA_MODE" ]; then
+	# Asynchronous replica of the galera cluster, replication itself is configured by the operator
+	echo "Replica: configuring replication for primary ${PRIMARY_HOST}"
+	mkdir -p /etc/mysql/conf.d
+	${CONTAINER_SCRIPTS_DIR}/configure-replica.sh
 fi
 
 chmod 0444 /etc/mysql/conf.d/server.cnf
@@ -43,11 +70,17 @@ chmod 0444 /etc/mysql/conf.d/client.cnf
 
 # We assume that mysql needs to be setup if this directory is not present
 if [ ! -d "/var/lib/mysql/mysql" ]; then
-	echo "Configure first time mysql"
-	${CONTAINER_SCRIPTS_DIR}/configure-mysql.sh
+	# only the first pod of a new galera cluster restores the backup, the others receive it using SST
+	if [ -n "$INIT_BUCKET_URL" ] && [ -n "$GALLERA_MODE" ] && [[ "$(hostname)" == *-0 ]]; then
+		echo "Restore first time mysql from ${INIT_BUCKET_URL}"
+		${CONTAINER_SCRIPTS_DIR}/restore-init.sh
+	else
+		echo "Configure first time mysql"
+		${CONTAINER_SCRIPTS_DIR}/configure-mysql.sh
+	fi
 fi
 
 
 cp /usr/share/container-scripts/mysql/readiness-probe.sh /usr/bin/readiness-probe.sh
 # Run mysqld
-exec mysqld
\ No newline at end of file
+exec mysqld ${MYSQLD_ARGS}
\ No newline at end of file
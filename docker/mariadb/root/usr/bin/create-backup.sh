@@ -2,7 +2,7 @@
 #
 #
 
-set -x
+set -xeo pipefail
 
 if [ -z "$BACKUP_URL" ]; then
   echo "\$BACKUP_URL is empty"
@@ -33,67 +33,67 @@ if [ -z "$PORT" ]; then
   echo "\$PORT is empty"
   exit 1
 fi
-echo "Create Google Drive service-account.json file."
-echo "${GDRIVE_SERVICE_ACCOUNT}" > /tmp/gdrive-service-account.json
-
-echo "Create rclone.conf file."
-cat <<EOF > /tmp/rclone.conf
-[gd]
-type = drive
-scope = drive
-service_account_file = /tmp/gdrive-service-account.json
-client_id = ${GDRIVE_CLIENT_ID}
-root_folder_id = ${GDRIVE_ROOT_FOLDER_ID}
-impersonate = ${GDRIVE_IMPERSONATOR}
-[s3]
-type = s3
-env_auth = false
-provider = ${S3_PROVIDER:-"AWS"}
-access_key_id = ${AWS_ACCESS_KEY_ID}
-secret_access_key = ${AWS_SECRET_ACCESS_KEY:-$AWS_SECRET_KEY}
-region = ${AWS_REGION:-"us-east-1"}
-endpoint = ${S3_ENDPOINT}
-acl = ${AWS_ACL}
-storage_class = ${AWS_STORAGE_CLASS}
-[gs]
-type = google cloud storage
-project_number = ${GCS_PROJECT_ID}
-service_account_file = /tmp/google-credentials.json
-object_acl = ${GCS_OBJECT_ACL}
-bucket_acl = ${GCS_BUCKET_ACL}
-location =  ${GCS_LOCATION}
-storage_class = ${GCS_STORAGE_CLASS:-"MULTI_REGIONAL"}
-[http]
-type = http
-url = ${HTTP_URL}
-[azure]
-type = azureblob
-account = ${AZUREBLOB_ACCOUNT}
-key = ${AZUREBLOB_KEY}
-EOF
-
-if [[ -n "${GCS_SERVICE_ACCOUNT_JSON_KEY:-}" ]]; then
-    echo "Create google-credentials.json file."
-    cat <<EOF > /tmp/google-credentials.json
-    ${GCS_SERVICE_ACCOUNT_JSON_KEY}
-EOF
-else
-    touch /tmp/google-credentials.json
-fi
-
-
+# rclone-config.sh expands the storage credentials
+set +x
+source /usr/share/container-scripts/mysql/rclone-config.sh
+set -x
 
 BACKUP_DIR=/tmp/backup/backup_$(date +%F_%T)
 mkdir -p $BACKUP_DIR
 
-#mariabackup --compress --backup -H $HOST  -P${PORT} --export -u${BACKUP_USER} -p${BACKUP_PASSWORD} --target-dir=${BACKUP_DIR}
-if [ -z "$BACKUP_DB" ]; then
-  mysqldump  --lock-tables --all-databases -h $HOST -P${PORT} -u${BACKUP_USER} -p${BACKUP_PASSWORD} > $BACKUP_DIR/full.sql
+AGENT_ADDRESS=TCP:${HOST}:${AGENT_PORT:-3307}
+if [ -n "$AGENT_TLS_NAME" ]; then
+  # the job and the agent authenticate each other with the cluster certificate
+  TLS_DIR=/etc/mysql/tls
+  AGENT_ADDRESS=OPENSSL:${HOST}:${AGENT_PORT:-3307},cafile=${TLS_DIR}/ca.crt,cert=${TLS_DIR}/tls.crt,key=${TLS_DIR}/tls.key,commonname=${AGENT_TLS_NAME}
+fi
+
+# commands below carry the backup password
+set +x
+if [ "$BACKUP_METHOD" == "physical" ]; then
+  # backup-agent next to the Galera node streams mariabackup of it, extracting the stream validates it
+  echo "${BACKUP_PASSWORD}" | socat -t 86400 - "${AGENT_ADDRESS}" | mbstream -x -C $BACKUP_DIR
+  if [ ! -f $BACKUP_DIR/xtrabackup_checkpoints ]; then
+    echo >&2 "Physical backup from ${HOST} is incomplete"
+    exit 1
+  fi
+elif [ -z "$BACKUP_DB" ]; then
+  # GTID position of the dump is the starting point of the point-in-time recovery
+  mysqldump  --lock-tables --all-databases --master-data=2 --gtid -h $HOST -P${PORT} -u${BACKUP_USER} -p${BACKUP_PASSWORD} > $BACKUP_DIR/full.sql
 else
   mysqldump  --lock-tables  -h $HOST -P${PORT} -u${BACKUP_USER} -p${BACKUP_PASSWORD}  ${BACKUP_DB} > $BACKUP_DIR/full.sql
 fi
+set -x
 
-BACKUP_PATH=/tmp/$CLUSTER_NAME-$(date +%F_T).tar.gz
+# a truncated dump must not be uploaded, retention would prune the good backups in favour of it
+if [ "$BACKUP_METHOD" != "physical" ]; then
+  if [ ! -s $BACKUP_DIR/full.sql ] || ! tail -n 1 $BACKUP_DIR/full.sql | grep -q "^-- Dump completed"; then
+    echo >&2 "Dump of ${HOST} is incomplete"
+    exit 1
+  fi
+fi
+
+# backups of the cluster can share the location, archives are prefixed with the backup name
+BACKUP_PATH=/tmp/$CLUSTER_NAME-${BACKUP_NAME:+$BACKUP_NAME-}$(date +%F_%H-%M-%S).tar.gz
 tar -czvf $BACKUP_PATH $BACKUP_DIR
 
-rclone  --config /tmp/rclone.conf copy $BACKUP_PATH $BACKUP_URL
+if ! rclone  --config /tmp/rclone.conf copy $BACKUP_PATH $BACKUP_URL; then
+  echo >&2 "Upload of ${BACKUP_PATH} failed"
+  exit 1
+fi
+
+# old backups are removed only after the new one is uploaded
+DELETED=""
+if [ -n "$RETENTION_KEEP_LAST" ]; then
+  if ! PRUNED=$(/usr/share/container-scripts/mysql/prune-backups.sh); then
+    echo >&2 "Pruning of old backups failed"
+  fi
+  # termination message is limited to 4096 bytes
+  for name in $(echo "$PRUNED" | head -n 20); do
+    DELETED="${DELETED:+${DELETED}, }\"${name}\""
+  done
+fi
+
+# the operator reads the result of the backup from the termination message
+BACKUP_SIZE=$(stat -c %s $BACKUP_PATH)
+echo "{\"path\": \"${BACKUP_URL%/}/$(basename $BACKUP_PATH)\", \"size\": ${BACKUP_SIZE}, \"deleted\": [${DELETED}]}" > /dev/termination-log
@@ -0,0 +1,101 @@
+#!/bin/bash
+#
+# Restores backup from $BACKUP_URL into a running cluster.
+# When $RESTORE_DB is set the backup is imported into that database,
+# it works only with backups of a single database.
+# When $RESTORE_TIME (unix time) or $RESTORE_GTID is set archived binary logs
+# are replayed on top of the latest backup taken before the target.
+#
+
+# no xtrace, the mysql command line carries the root password
+set -eo pipefail
+
+if [ -z "$BACKUP_URL" ]; then
+  echo "\$BACKUP_URL is empty"
+  exit 1
+fi
+
+if [ -z "$MYSQL_ROOT_PASSWORD" ]; then
+  echo "\$MYSQL_ROOT_PASSWORD is empty"
+  exit 1
+fi
+
+if [ -z "$HOST" ]; then
+  echo "\$HOST is empty"
+  exit 1
+fi
+
+if [ -z "$PORT" ]; then
+  echo "\$PORT is empty"
+  exit 1
+fi
+
+GTID_DOMAIN=${GTID_DOMAIN:-1}
+
+# sequence number of the Galera domain in a GTID position
+function domain_seq {
+  echo "$1" | tr ',' '\n' | awk -F- -v domain="$GTID_DOMAIN" '$1 == domain { print $3 }'
+}
+
+RESTORE_DIR=/tmp/restore
+BEFORE=${RESTORE_TIME}
+while true; do
+  /usr/share/container-scripts/mysql/fetch-backup.sh "${BACKUP_URL}" ${RESTORE_DIR} ${BEFORE}
+
+  if [ -n "$(find ${RESTORE_DIR}/extracted -name xtrabackup_checkpoints | head -n 1)" ]; then
+    # data files can't be replaced under running Galera nodes
+    echo >&2 "Physical backups can be restored only into a new cluster using initBucketURL"
+    exit 1
+  fi
+
+  DUMP=$(find ${RESTORE_DIR}/extracted -name full.sql | head -n 1)
+  if [ -z "$DUMP" ]; then
+    echo >&2 "No mysqldump backup found at ${BACKUP_URL}"
+    exit 1
+  fi
+
+  if [ -z "$RESTORE_GTID" ]; then
+    break
+  fi
+  # commit time of the target GTID is unknown, the latest backup taken before it is looked up by its position
+  BACKUP_SEQ=$(domain_seq "$(grep -m 1 -o "gtid_slave_pos='[^']*'" "${DUMP}" | cut -d "'" -f 2)")
+  TARGET_SEQ=$(domain_seq "$RESTORE_GTID")
+  if [ -z "$BACKUP_SEQ" ] || [ -z "$TARGET_SEQ" ] || [ "$BACKUP_SEQ" -le "$TARGET_SEQ" ]; then
+    break
+  fi
+  BEFORE=$(( $(cat ${RESTORE_DIR}/backup-time) - 1 ))
+  echo "Backup at sequence ${BACKUP_SEQ} is newer than ${RESTORE_GTID}, looking for an older one"
+done
+
+mysql=( mysql -h "${HOST}" -P"${PORT}" -uroot -p"${MYSQL_ROOT_PASSWORD}" )
+if [ -n "$RESTORE_DB" ]; then
+  if grep -q -m 1 "^USE " "${DUMP}"; then
+    echo >&2 "Backup contains more databases, it can't be restored into ${RESTORE_DB}"
+    exit 1
+  fi
+  echo "CREATE DATABASE IF NOT EXISTS \`${RESTORE_DB}\` ;" | "${mysql[@]}"
+  mysql+=( "${RESTORE_DB}" )
+fi
+
+START_GTID=""
+if [ -n "$RESTORE_TIME" ] || [ -n "$RESTORE_GTID" ]; then
+  # binary logs contain all databases, replaying them on top of a single database would apply the others twice
+  if ! grep -q -m 1 "^USE " "${DUMP}"; then
+    echo >&2 "Point-in-time recovery requires backup of all databases"
+    exit 1
+  fi
+  START_GTID=$(grep -m 1 -o "gtid_slave_pos='[^']*'" "${DUMP}" | cut -d "'" -f 2)
+  if [ -z "$START_GTID" ]; then
+    echo >&2 "Backup doesn't contain GTID position, it was taken without binary logs"
+    exit 1
+  fi
+fi
+
+"${mysql[@]}" < "${DUMP}"
+
+if [ -n "$START_GTID" ]; then
+  /usr/share/container-scripts/mysql/replay-binlogs.sh "${START_GTID}"
+fi
+
+rm -rf ${RESTORE_DIR}
+echo "Backup ${BACKUP_URL} restored"
@@ -0,0 +1,67 @@
+#!/bin/bash
+#
+# Prints GTID range of a binary log in the Galera domain:
+#   <first seq> <last seq> <first time> <last time> <last gtid> <position> <position seq>
+# Times are unix timestamps, position is the offset of the first transaction with
+# sequence number greater than <seq> and position seq is its sequence number
+# (both 0 when there is none).
+# Prints nothing when the binary log doesn't contain any transaction.
+# Usage: binlog-info.sh <binlog> [<seq>]
+#
+
+set -eo pipefail
+
+BINLOG="$1"
+AFTER_SEQ="${2:--1}"
+GTID_DOMAIN=${GTID_DOMAIN:-1}
+
+if [ -z "$BINLOG" ]; then
+  echo >&2 "Usage: $0 <binlog> [<seq>]"
+  exit 1
+fi
+
+# event header: #211010 12:00:00 server id 1  end_log_pos 342 CRC32 0x1f2e3d4c 	GTID 1-1-5 trans
+INFO=$(TZ=UTC mysqlbinlog "$BINLOG" | awk -v domain="$GTID_DOMAIN" -v after="$AFTER_SEQ" '
+  /^# at / { pos = $3 }
+  /[ \t]GTID [0-9]+-[0-9]+-[0-9]+/ {
+    for (i = 1; i <= NF; i++) {
+      if ($i == "GTID") {
+        gtid = $(i + 1)
+      }
+    }
+    split(gtid, parts, "-")
+    if (parts[1] != domain) {
+      next
+    }
+    seq = parts[3] + 0
+    ts = substr($1, 2) "_" $2
+    if (first == "") {
+      first = seq
+      first_ts = ts
+    }
+    last = seq
+    last_ts = ts
+    last_gtid = gtid
+    if (position == "" && seq > after) {
+      position = pos
+      position_seq = seq
+    }
+  }
+  END {
+    if (first != "") {
+      print first, last, first_ts, last_ts, last_gtid, (position == "" ? 0 : position), (position == "" ? 0 : position_seq)
+    }
+  }')
+
+if [ -z "$INFO" ]; then
+  exit 0
+fi
+
+function to_epoch {
+  local day=${1%_*}
+  local time=${1#*_}
+  date -u -d "20${day:0:2}-${day:2:2}-${day:4:2} ${time}" +%s
+}
+
+read -r first_seq last_seq first_time last_time last_gtid position position_seq <<< "$INFO"
+echo "${first_seq} ${last_seq} $(to_epoch "$first_time") $(to_epoch "$last_time") ${last_gtid} ${position} ${position_seq}"
@@ -4,7 +4,8 @@
 # openshift-mariadb-galera: mysql setup script
 #
 
-set -eox pipefail
+# no xtrace, the commands below carry the root password
+set -eo pipefail
 
 echo 'Running mysql_install_db ...'
 mysql_install_db --datadir=/var/lib/mysql
@@ -78,6 +79,16 @@ if [ "$MYSQL_USER" -a "$MYSQL_PASSWORD" ]; then
 	echo 'FLUSH PRIVILEGES ;' | "${mysql[@]}"
 fi
 
+if [ -n "$REPLICA_MODE" ]; then
+	# Seed replica with a consistent snapshot of the primary, the dump sets gtid_slave_pos
+	# so replication configured by the operator continues from the right position.
+	# Views, events and triggers need SHOW VIEW, EVENT and TRIGGER the backup user doesn't have, so root dumps them.
+	echo "Seeding replica from ${PRIMARY_HOST}"
+	mysqldump -h "${PRIMARY_HOST}" -uroot -p"${MYSQL_ROOT_PASSWORD}" \
+		--all-databases --single-transaction --gtid --master-data=1 \
+		--routines --events --triggers --flush-privileges | "${mysql[@]}"
+fi
+
 if ! kill -s TERM "$pid" || ! wait "$pid"; then
 	echo >&2 'MySQL init process failed.'
 	exit 1
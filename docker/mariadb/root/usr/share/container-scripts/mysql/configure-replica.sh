@@ -0,0 +1,23 @@
+#!/bin/bash
+#
+# Writes mysql config of an asynchronous replica.
+# server_id has to be unique in the replication topology, galera nodes use 1
+# so replicas use 100 + statefulset ordinal.
+#
+
+CFG=/etc/mysql/conf.d/replica.cnf
+
+ORDINAL=${HOSTNAME##*-}
+if ! [[ "$ORDINAL" =~ ^[0-9]+$ ]]; then
+    echo "Unable to get ordinal from hostname ${HOSTNAME}"
+    exit 1
+fi
+
+cat <<EOCFG > ${CFG}
+[mysqld]
+server_id = $((100 + ORDINAL))
+log_bin = mysql-bin
+log_slave_updates = ON
+relay_log = relay-bin
+read_only = ON
+EOCFG
@@ -0,0 +1,61 @@
+#!/bin/bash
+#
+# Downloads backup from rclone URL and extracts it.
+# Usage: fetch-backup.sh <url> <dir> [<unix time>]
+# When the URL points to a directory the latest backup in it is used,
+# with the time only backups taken before it are considered.
+# $BACKUP_PREFIX limits the backups to the archives of a single MariaDBBackup.
+# Extracted files are placed in <dir>/extracted, upload time of the backup (unix time)
+# is written to <dir>/backup-time.
+#
+
+# no xtrace, rclone-config.sh expands the storage credentials
+set -eo pipefail
+
+BACKUP_URL="$1"
+RESTORE_DIR="$2"
+BEFORE="$3"
+
+if [ -z "$BACKUP_URL" ] || [ -z "$RESTORE_DIR" ]; then
+  echo >&2 "Usage: $0 <url> <dir>"
+  exit 1
+fi
+
+source /usr/share/container-scripts/mysql/rclone-config.sh
+
+rm -rf ${RESTORE_DIR}
+mkdir -p ${RESTORE_DIR}/download ${RESTORE_DIR}/extracted
+
+LATEST=$(rclone --config /tmp/rclone.conf lsf --files-only --format "tp" "${BACKUP_URL}" | sort | while IFS=';' read -r modtime name; do
+  if [ -n "$BACKUP_PREFIX" ] && ! [[ "$name" =~ ^${BACKUP_PREFIX}[0-9]{4}-[0-9]{2}-[0-9]{2}_ ]]; then
+    continue
+  fi
+  modtime=$(date -d "$modtime" +%s)
+  if [ -n "$BEFORE" ] && [ "$modtime" -gt "$BEFORE" ]; then
+    continue
+  fi
+  echo "$modtime $name"
+done | tail -n 1)
+read -r BACKUP_TIME BACKUP_FILE <<< "${LATEST}"
+if [ -z "$BACKUP_FILE" ]; then
+  echo >&2 "No backup found at ${BACKUP_URL}"
+  exit 1
+fi
+if [[ "${BACKUP_URL}" == *"${BACKUP_FILE}" ]]; then
+  rclone --config /tmp/rclone.conf copy "${BACKUP_URL}" ${RESTORE_DIR}/download
+else
+  rclone --config /tmp/rclone.conf copy "${BACKUP_URL%/}/${BACKUP_FILE}" ${RESTORE_DIR}/download
+fi
+
+echo "${BACKUP_TIME}" > ${RESTORE_DIR}/backup-time
+
+ARCHIVE=$(find ${RESTORE_DIR}/download -type f | head -n 1)
+echo "Extracting ${ARCHIVE}"
+case "${ARCHIVE}" in
+  *.xbstream)
+    mbstream -x -C ${RESTORE_DIR}/extracted < "${ARCHIVE}"
+    ;;
+  *)
+    tar -xzf "${ARCHIVE}" -C ${RESTORE_DIR}/extracted
+    ;;
+esac
@@ -0,0 +1,49 @@
+#!/bin/bash
+#
+# Reads galera state of the data directory, it is run by the operator in a job for every
+# volume when no node of the cluster is part of a primary component. grastate.dat with the
+# seqno recovered from InnoDB is written into the termination log of the container, the
+# operator bootstraps the cluster from the node with the highest seqno.
+#
+
+set -e
+
+GRASTATE=/var/lib/mysql/grastate.dat
+TERMINATION_LOG=/dev/termination-log
+
+if [ ! -f "$GRASTATE" ]; then
+  echo "$GRASTATE not found, the node never joined the cluster"
+  echo "seqno: -1" > "$TERMINATION_LOG"
+  exit 0
+fi
+
+cat "$GRASTATE"
+UUID=$(sed -n -e 's/^uuid:[[:space:]]*//p' "$GRASTATE")
+SEQNO=$(sed -n -e 's/^seqno:[[:space:]]*//p' "$GRASTATE")
+SAFE_TO_BOOTSTRAP=$(sed -n -e 's/^safe_to_bootstrap:[[:space:]]*//p' "$GRASTATE")
+
+# seqno is saved only on a clean shutdown, after a crash the position is recovered from InnoDB
+if [ -z "$SEQNO" ] || [ "$SEQNO" = "-1" ]; then
+  echo "Galera: recovering position with mysqld --wsrep-recover"
+  mkdir -p /etc/mysql/conf.d
+  cp /usr/share/container-scripts/mysql/galera.cnf /etc/mysql/conf.d/galera.cnf
+  LOG=/tmp/wsrep-recover.log
+  if ! mysqld --user=mysql --wsrep-recover --log-error="$LOG"; then
+    cat "$LOG"
+    exit 1
+  fi
+  cat "$LOG"
+
+  # WSREP: Recovered position: <uuid>:<seqno>[,<gtid>]
+  POSITION=$(grep -o 'Recovered position: .*' "$LOG" | tail -n 1 | awk '{print $3}')
+  POSITION=${POSITION%%,*}
+  if [ -z "$POSITION" ]; then
+    echo >&2 "Galera: position not found in the log"
+    exit 1
+  fi
+  UUID=${POSITION%:*}
+  SEQNO=${POSITION##*:}
+fi
+
+echo "Galera: recovered position ${UUID}:${SEQNO}, safe_to_bootstrap: ${SAFE_TO_BOOTSTRAP:-0}"
+printf "uuid: %s\nseqno: %s\nsafe_to_bootstrap: %s\n" "$UUID" "$SEQNO" "${SAFE_TO_BOOTSTRAP:-0}" > "$TERMINATION_LOG"
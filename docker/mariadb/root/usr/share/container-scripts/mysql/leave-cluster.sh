@@ -0,0 +1,15 @@
+#!/bin/bash
+#
+# preStop hook of the galera nodes. mysqld is shut down cleanly before the pod is killed, the node
+# sends a leave message so the others shrink the cluster without losing quorum, and the seqno
+# is saved in grastate.dat for the next start.
+#
+
+MYSQL_SOCKET=/var/run/mysqld/mysql.sock
+
+# new client connections are refused and the running ones are killed, the service routes them to the other nodes
+mysql --protocol=socket --socket=${MYSQL_SOCKET} -uroot -p"${MYSQL_ROOT_PASSWORD}" \
+  -e "SET GLOBAL wsrep_reject_queries=ALL_KILL" || true
+
+echo "Galera: leaving the cluster"
+mysqladmin --protocol=socket --socket=${MYSQL_SOCKET} -uroot -p"${MYSQL_ROOT_PASSWORD}" shutdown
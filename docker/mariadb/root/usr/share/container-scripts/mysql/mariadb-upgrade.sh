@@ -0,0 +1,11 @@
+#!/bin/bash
+#
+# Upgrades the system tables of a galera node after the major version of MariaDB changed. It is run
+# by the operator in a job for every node once it rejoined the cluster with the new image.
+#
+
+set -e
+
+echo "Running mariadb-upgrade on ${MYSQL_HOST}"
+# the version file is in the data directory of the node, so the check if the upgrade is needed is done by the operator
+mariadb-upgrade --host="${MYSQL_HOST}" --user=root --password="${MYSQL_ROOT_PASSWORD}" --force
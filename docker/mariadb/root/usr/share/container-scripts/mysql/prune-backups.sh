@@ -0,0 +1,71 @@
+#!/bin/bash
+#
+# Deletes backups of $CLUSTER_NAME and $BACKUP_NAME from $BACKUP_URL which are not kept by the retention policy.
+# Policy is read from RETENTION_KEEP_LAST, RETENTION_KEEP_DAILY, RETENTION_KEEP_WEEKLY,
+# RETENTION_KEEP_MONTHLY and RETENTION_MAX_AGE_SECONDS. Backups selected by any keep rule
+# are kept, backups older than max age are always deleted, the newest backup is never deleted.
+# Deleted backups are printed to stdout, one per line.
+#
+
+set -eo pipefail
+
+KEEP_LAST=${RETENTION_KEEP_LAST:-0}
+KEEP_DAILY=${RETENTION_KEEP_DAILY:-0}
+KEEP_WEEKLY=${RETENTION_KEEP_WEEKLY:-0}
+KEEP_MONTHLY=${RETENTION_KEEP_MONTHLY:-0}
+MAX_AGE=${RETENTION_MAX_AGE_SECONDS:-0}
+
+if [ -z "$BACKUP_URL" ] || [ -z "$CLUSTER_NAME" ]; then
+  echo >&2 "\$BACKUP_URL and \$CLUSTER_NAME are required"
+  exit 1
+fi
+
+# archives of other backups stored in the same location are not touched
+ARCHIVE_PATTERN="^${CLUSTER_NAME}-${BACKUP_NAME:+${BACKUP_NAME}-}[0-9]{4}-[0-9]{2}-[0-9]{2}_"
+NOW=$(date +%s)
+declare -A days weeks months
+
+i=0
+while IFS=';' read -r modtime name; do
+  if ! [[ "$name" =~ $ARCHIVE_PATTERN ]]; then
+    continue
+  fi
+  created=$(date -d "$modtime" +%s)
+
+  keep=0
+  if [ $((KEEP_LAST + KEEP_DAILY + KEEP_WEEKLY + KEEP_MONTHLY)) -eq 0 ]; then
+    # only max age is set
+    keep=1
+  fi
+  if [ $i -lt "$KEEP_LAST" ]; then
+    keep=1
+  fi
+  # backups are sorted from the newest one, the first backup in a period is kept
+  day=$(date -d "@$created" +%F)
+  if [ -z "${days[$day]}" ] && [ ${#days[@]} -lt "$KEEP_DAILY" ]; then
+    days[$day]=1
+    keep=1
+  fi
+  week=$(date -d "@$created" +%G-%V)
+  if [ -z "${weeks[$week]}" ] && [ ${#weeks[@]} -lt "$KEEP_WEEKLY" ]; then
+    weeks[$week]=1
+    keep=1
+  fi
+  month=$(date -d "@$created" +%Y-%m)
+  if [ -z "${months[$month]}" ] && [ ${#months[@]} -lt "$KEEP_MONTHLY" ]; then
+    months[$month]=1
+    keep=1
+  fi
+  if [ "$MAX_AGE" -gt 0 ] && [ $((NOW - created)) -gt "$MAX_AGE" ]; then
+    keep=0
+  fi
+  if [ $i -eq 0 ]; then
+    keep=1
+  fi
+  i=$((i + 1))
+
+  if [ $keep -eq 0 ]; then
+    rclone --config /tmp/rclone.conf deletefile "${BACKUP_URL%/}/${name}" >&2
+    echo "${BACKUP_URL%/}/${name}"
+  fi
+done < <(rclone --config /tmp/rclone.conf lsf --files-only --format "tp" "${BACKUP_URL}" | sort -r)
@@ -0,0 +1,104 @@
+#!/bin/bash
+#
+# Replays binary logs archived by archive-binlogs.sh on top of a restored backup.
+# Usage: replay-binlogs.sh <gtid position of the backup>
+# Replay stops after $RESTORE_GTID or before the first transaction committed
+# after $RESTORE_TIME (unix time).
+#
+
+set -eo pipefail
+
+START_GTID="$1"
+GTID_DOMAIN=${GTID_DOMAIN:-1}
+CONTAINER_SCRIPTS_DIR="/usr/share/container-scripts/mysql"
+WORK_DIR=/tmp/replay
+
+rclone=( rclone --config /tmp/rclone.conf )
+mysql=( mysql -h "${HOST}" -P"${PORT}" -uroot -p"${MYSQL_ROOT_PASSWORD}" )
+
+# sequence number of the Galera domain in a GTID position
+function domain_seq {
+  echo "$1" | tr ',' '\n' | awk -F- -v domain="$GTID_DOMAIN" '$1 == domain { print $3 }'
+}
+
+APPLIED_SEQ=$(domain_seq "$START_GTID")
+if [ -z "$APPLIED_SEQ" ]; then
+  echo >&2 "Backup doesn't contain GTID position of domain ${GTID_DOMAIN}"
+  exit 1
+fi
+
+TARGET_SEQ=""
+if [ -n "$RESTORE_GTID" ]; then
+  TARGET_SEQ=$(domain_seq "$RESTORE_GTID")
+  if [ -z "$TARGET_SEQ" ]; then
+    echo >&2 "${RESTORE_GTID} is not in domain ${GTID_DOMAIN}"
+    exit 1
+  fi
+  if [ "$TARGET_SEQ" -lt "$APPLIED_SEQ" ]; then
+    echo >&2 "Backup at ${START_GTID} is newer than ${RESTORE_GTID}"
+    exit 1
+  fi
+fi
+
+case "${BACKUP_URL}" in
+  *.tar.gz|*.xbstream)
+    BINLOG_URL="${BACKUP_URL%/*}/binlog"
+    ;;
+  *)
+    BINLOG_URL="${BACKUP_URL%/}/binlog"
+    ;;
+esac
+
+rm -rf ${WORK_DIR}
+mkdir -p ${WORK_DIR}
+"${rclone[@]}" copyto "${BINLOG_URL}/index" ${WORK_DIR}/index
+
+LAST_TIME=0
+while read -r file first_seq last_seq first_time last_time last_gtid; do
+  if [ "$last_seq" -le "$APPLIED_SEQ" ]; then
+    continue
+  fi
+  if [ -n "$TARGET_SEQ" ] && [ "$APPLIED_SEQ" -ge "$TARGET_SEQ" ]; then
+    break
+  fi
+  if [ -n "$RESTORE_TIME" ] && [ "$first_time" -gt "$RESTORE_TIME" ]; then
+    break
+  fi
+
+  "${rclone[@]}" copyto "${BINLOG_URL}/${file}" ${WORK_DIR}/${file}
+
+  # archived files of different nodes overlap, transactions already applied are skipped
+  read -r _ _ _ _ _ start_position start_seq <<< "$(${CONTAINER_SCRIPTS_DIR}/binlog-info.sh ${WORK_DIR}/${file} ${APPLIED_SEQ})"
+  # replaying over missing transactions would silently produce a different database
+  if [ "$start_seq" != "$((APPLIED_SEQ + 1))" ]; then
+    echo >&2 "Archived binary logs have a gap, ${file} continues at sequence ${start_seq} after ${APPLIED_SEQ}"
+    exit 1
+  fi
+  options=( --start-position="${start_position}" )
+  if [ -n "$TARGET_SEQ" ] && [ "$last_seq" -gt "$TARGET_SEQ" ]; then
+    read -r _ _ _ _ _ stop_position _ <<< "$(${CONTAINER_SCRIPTS_DIR}/binlog-info.sh ${WORK_DIR}/${file} ${TARGET_SEQ})"
+    options+=( --stop-position="${stop_position}" )
+    last_seq=${TARGET_SEQ}
+  fi
+  if [ -n "$RESTORE_TIME" ]; then
+    # transactions committed in the target second are replayed
+    options+=( --stop-datetime="$(date -u -d @$((RESTORE_TIME + 1)) '+%F %T')" )
+  fi
+
+  echo "Replaying ${file}"
+  TZ=UTC mysqlbinlog "${options[@]}" ${WORK_DIR}/${file} | "${mysql[@]}"
+  APPLIED_SEQ=${last_seq}
+  LAST_TIME=${last_time}
+  rm -f ${WORK_DIR}/${file}
+done < ${WORK_DIR}/index
+
+if [ -n "$TARGET_SEQ" ] && [ "$APPLIED_SEQ" -lt "$TARGET_SEQ" ]; then
+  echo >&2 "Archived binary logs end before ${RESTORE_GTID}"
+  exit 1
+fi
+if [ -n "$RESTORE_TIME" ] && [ "$LAST_TIME" -lt "$RESTORE_TIME" ]; then
+  echo "Archived binary logs end at $(date -u -d @${LAST_TIME}), transactions committed later are not restored"
+fi
+
+rm -rf ${WORK_DIR}
+echo "Binary logs replayed up to GTID ${GTID_DOMAIN}-*-${APPLIED_SEQ}"
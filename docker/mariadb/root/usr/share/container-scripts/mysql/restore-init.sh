@@ -0,0 +1,112 @@
+#!/bin/bash
+#
+# Initializes an empty data directory from a backup stored at $INIT_BUCKET_URL.
+# Supports archives created by create-backup.sh (full.sql) and mariabackup
+# directories (xtrabackup_checkpoints). Galera members started after this one
+# receive the data using SST.
+#
+
+# no xtrace, mysql_auth and the account statements below carry the passwords
+set -eo pipefail
+
+CONTAINER_SCRIPTS_DIR="/usr/share/container-scripts/mysql"
+MYSQL_DATA_DIR="/var/lib/mysql"
+RESTORE_DIR=/tmp/init-backup
+INIT_SOCKET=/var/run/mysqld/mysql-restore.sock
+
+if [ -z "$INIT_BUCKET_URL" ]; then
+  echo "\$INIT_BUCKET_URL is empty"
+  exit 1
+fi
+
+function start_local_mysqld {
+  mysqld --skip-networking --socket=${INIT_SOCKET} --wsrep_on=OFF "$@" &
+  pid="$!"
+
+  for i in {60..0}; do
+    if echo 'SELECT 1' | mysql --protocol=socket -uroot -hlocalhost --socket=${INIT_SOCKET} "${mysql_auth[@]}" &> /dev/null; then
+      break
+    fi
+    echo 'MySQL restore process in progress...'
+    sleep 1
+  done
+  if [ "$i" = 0 ]; then
+    echo >&2 'MySQL restore process failed.'
+    exit 1
+  fi
+}
+
+function stop_local_mysqld {
+  if ! kill -s TERM "$pid" || ! wait "$pid"; then
+    echo >&2 'MySQL restore process failed.'
+    exit 1
+  fi
+}
+
+# accounts used by the operator and the image have to match the new cluster, not the one the backup was taken from
+function ensure_users {
+  mysql --protocol=socket -uroot -hlocalhost --socket=${INIT_SOCKET} "${mysql_auth[@]}" <<-EOSQL
+SET @@SESSION.SQL_LOG_BIN=0;
+FLUSH PRIVILEGES ;
+CREATE USER IF NOT EXISTS 'root'@'%' IDENTIFIED BY '${MYSQL_ROOT_PASSWORD}' ;
+ALTER USER 'root'@'%' IDENTIFIED BY '${MYSQL_ROOT_PASSWORD}' ;
+GRANT ALL ON *.* TO 'root'@'%' WITH GRANT OPTION ;
+CREATE USER IF NOT EXISTS 'xtrabackup_sst'@'localhost' IDENTIFIED BY 'xtrabackup_sst' ;
+ALTER USER 'xtrabackup_sst'@'localhost' IDENTIFIED BY 'xtrabackup_sst' ;
+GRANT SELECT, PROCESS, RELOAD, LOCK TABLES, REPLICATION CLIENT ON *.* TO 'xtrabackup_sst'@'localhost' ;
+CREATE USER IF NOT EXISTS '${BACKUP_USER}'@'%' IDENTIFIED BY '${BACKUP_PASSWORD}' ;
+ALTER USER '${BACKUP_USER}'@'%' IDENTIFIED BY '${BACKUP_PASSWORD}' ;
+GRANT SELECT, PROCESS, RELOAD, LOCK TABLES, REPLICATION CLIENT ON *.* TO '${BACKUP_USER}'@'%' ;
+CREATE USER IF NOT EXISTS 'readinessProbe'@'localhost' IDENTIFIED BY 'readinessProbe';
+FLUSH PRIVILEGES ;
+EOSQL
+}
+
+${CONTAINER_SCRIPTS_DIR}/fetch-backup.sh "${INIT_BUCKET_URL}" ${RESTORE_DIR}
+
+CHECKPOINTS=$(find ${RESTORE_DIR}/extracted -name xtrabackup_checkpoints | head -n 1)
+DUMP=$(find ${RESTORE_DIR}/extracted -name full.sql | head -n 1)
+
+if [ -n "$CHECKPOINTS" ]; then
+  echo "Restoring physical backup from ${INIT_BUCKET_URL}"
+  BACKUP_DIR=$(dirname "${CHECKPOINTS}")
+  mariabackup --prepare --target-dir="${BACKUP_DIR}"
+
+  # copy-back requires an empty data directory, grastate.dat is written by the entrypoint
+  if [ -f "${MYSQL_DATA_DIR}/grastate.dat" ]; then
+    mv ${MYSQL_DATA_DIR}/grastate.dat ${RESTORE_DIR}/grastate.dat
+  fi
+  mariabackup --copy-back --target-dir="${BACKUP_DIR}" --datadir=${MYSQL_DATA_DIR}
+  if [ -f "${RESTORE_DIR}/grastate.dat" ]; then
+    mv ${RESTORE_DIR}/grastate.dat ${MYSQL_DATA_DIR}/grastate.dat
+  fi
+  chown -R mysql:mysql ${MYSQL_DATA_DIR}
+
+  # passwords from the backup are unknown, grants are loaded by FLUSH PRIVILEGES in ensure_users
+  mysql_auth=()
+  start_local_mysqld --skip-grant-tables
+  ensure_users
+  stop_local_mysqld
+elif [ -n "$DUMP" ]; then
+  echo "Restoring logical backup from ${INIT_BUCKET_URL}"
+  ${CONTAINER_SCRIPTS_DIR}/configure-mysql.sh
+
+  mysql_auth=( -p"${MYSQL_ROOT_PASSWORD}" )
+  start_local_mysqld
+  mysql --protocol=socket -uroot -hlocalhost --socket=${INIT_SOCKET} "${mysql_auth[@]}" < "${DUMP}"
+  # the dump may replace the accounts, root password is the one from the backup now
+  stop_local_mysqld
+  mysql_auth=()
+  start_local_mysqld --skip-grant-tables
+  ensure_users
+  stop_local_mysqld
+else
+  echo >&2 "${INIT_BUCKET_URL} is neither mariabackup nor mysqldump backup"
+  exit 1
+fi
+
+rm -rf ${RESTORE_DIR}
+
+echo
+echo 'MySQL restore from backup done. Ready for start up.'
+echo
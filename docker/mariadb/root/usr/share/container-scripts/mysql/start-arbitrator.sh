@@ -0,0 +1,19 @@
+#!/bin/bash
+#
+# Runs galera arbitrator (garbd) of the cluster. It votes in the quorum without storing data,
+# so a cluster with an even number of nodes keeps a majority when it splits in half.
+#
+
+set -e
+
+# the galera nodes are found through the headless service of the primary pods
+until PEERS=$(dig +short "${PRIMARY_HOST}" | sort | paste -sd, -) && [ -n "${PEERS}" ]; do
+  echo "Arbitrator: waiting for galera nodes of ${PRIMARY_HOST}"
+  sleep 5
+done
+
+echo "Arbitrator: joining ${CLUSTER_NAME} using gcomm://${PEERS}"
+if [ -n "${GARBD_OPTIONS}" ]; then
+  exec garbd --address "gcomm://${PEERS}" --group "${CLUSTER_NAME}" --options "${GARBD_OPTIONS}"
+fi
+exec garbd --address "gcomm://${PEERS}" --group "${CLUSTER_NAME}"
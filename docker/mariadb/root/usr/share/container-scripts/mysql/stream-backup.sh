@@ -0,0 +1,27 @@
+#!/bin/bash
+#
+# Streams mariabackup of the local node to stdout. It is started by socat in the
+# backup-agent container for every connection, the first line sent by the client
+# has to be the backup password. With TLS enabled socat accepts only clients with
+# a certificate of the cluster.
+#
+
+set -o pipefail
+
+read -r -t 10 PASSWORD
+if [ -z "$BACKUP_PASSWORD" ] || [ "$PASSWORD" != "$BACKUP_PASSWORD" ]; then
+  echo >&2 "Invalid backup password"
+  exit 1
+fi
+
+mysql=( mysql -h127.0.0.1 -P3306 -uroot -p"${MYSQL_ROOT_PASSWORD}" )
+
+# desynced node doesn't pause the cluster with flow control while mariabackup holds locks
+if "${mysql[@]}" -e "SET GLOBAL wsrep_desync = ON"; then
+  trap '"${mysql[@]}" -e "SET GLOBAL wsrep_desync = OFF"' EXIT
+fi
+
+echo >&2 "Streaming backup"
+mariabackup --backup --stream=xbstream --galera-info \
+  --host=127.0.0.1 --port=3306 --user="${BACKUP_USER}" --password="${BACKUP_PASSWORD}" \
+  --datadir=/var/lib/mysql --target-dir=/tmp
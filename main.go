@@ -81,10 +81,12 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers.MariaDBClusterReconciler{
-		Client:       mgr.GetClient(),
-		DirectClient: mgr.GetAPIReader(),
-		Scheme:       mgr.GetScheme(),
-		Log:          ctrl.Log.WithName("controllers").WithName("MariaDBCluster"),
+		Client:           mgr.GetClient(),
+		DirectClient:     mgr.GetAPIReader(),
+		Scheme:           mgr.GetScheme(),
+		Log:              ctrl.Log.WithName("controllers").WithName("MariaDBCluster"),
+		Recorder:         mgr.GetEventRecorderFor("mariadbcluster-controller"),
+		SQLRunnerFactory: mysql.NewSQLRunner,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MariaDBCluster")
 		os.Exit(1)
@@ -93,6 +95,7 @@ func main() {
 		Client:           mgr.GetClient(),
 		Log:              ctrl.Log.WithName("controllers").WithName("MariaDBUser"),
 		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("mariadbuser-controller"),
 		SQLRunnerFactory: mysql.NewSQLRunner,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MariaDBUser")
@@ -102,6 +105,7 @@ func main() {
 		Client:           mgr.GetClient(),
 		Log:              ctrl.Log.WithName("controllers").WithName("MariaDBDatabase"),
 		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("mariadbdatabase-controller"),
 		SQLRunnerFactory: mysql.NewSQLRunner,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MariaDBDatabase")
@@ -115,6 +119,23 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "MariaDBBackup")
 		os.Exit(1)
 	}
+	if err = (&controllers.MariaDBRestoreReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("MariaDBRestore"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MariaDBRestore")
+		os.Exit(1)
+	}
+	if err = (&controllers.MariaDBRoleReconciler{
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("MariaDBRole"),
+		Scheme:           mgr.GetScheme(),
+		SQLRunnerFactory: mysql.NewSQLRunner,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MariaDBRole")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -33,6 +33,21 @@ func (m *MockRows) EXPECT() *MockRowsMockRecorder {
 	return m.recorder
 }
 
+// Columns mocks base method.
+func (m *MockRows) Columns() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Columns")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Columns indicates an expected call of Columns.
+func (mr *MockRowsMockRecorder) Columns() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Columns", reflect.TypeOf((*MockRows)(nil).Columns))
+}
+
 // Err mocks base method.
 func (m *MockRows) Err() error {
 	m.ctrl.T.Helper()
@@ -2,6 +2,15 @@ package mysql
 
 import "fmt"
 import "context"
+import "strings"
+
+// DatabaseInfo are the defaults and usage of a database as reported by information_schema
+type DatabaseInfo struct {
+	CharacterSet string
+	Collation    string
+	Tables       int32
+	SizeBytes    int64
+}
 
 // CreateDatabaseIfNotExists creates a database if it doesn't already exist
 func CreateDatabaseIfNotExists(ctx context.Context, sql SQLRunner, database, charset, collate string) error {
@@ -35,3 +44,59 @@ func DropDatabase(ctx context.Context, sql SQLRunner, database string) error {
 
 	return nil
 }
+
+// GetDatabase returns the default charset and collation of the database with number of tables and their size
+func GetDatabase(ctx context.Context, sql SQLRunner, database string) (*DatabaseInfo, error) {
+	query := NewQuery("SELECT s.DEFAULT_CHARACTER_SET_NAME, s.DEFAULT_COLLATION_NAME, COUNT(t.TABLE_NAME), "+
+		"COALESCE(SUM(t.DATA_LENGTH + t.INDEX_LENGTH), 0) FROM information_schema.SCHEMATA s "+
+		"LEFT JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = s.SCHEMA_NAME WHERE s.SCHEMA_NAME = ? "+
+		"GROUP BY s.SCHEMA_NAME, s.DEFAULT_CHARACTER_SET_NAME, s.DEFAULT_COLLATION_NAME", database)
+
+	info := &DatabaseInfo{}
+	if err := sql.QueryRow(ctx, query, &info.CharacterSet, &info.Collation, &info.Tables, &info.SizeBytes); err != nil {
+		return nil, fmt.Errorf("failed to read database, err: %s", err)
+	}
+
+	return info, nil
+}
+
+// AlterDatabaseDefaults changes the default charset and collation of the database, empty values are left as they are
+func AlterDatabaseDefaults(ctx context.Context, sql SQLRunner, database, charset, collate string) error {
+	args := []interface{}{}
+	query := fmt.Sprintf("ALTER DATABASE %s", escapeID(database))
+
+	if len(charset) > 0 {
+		query += " CHARACTER SET ?"
+		args = append(args, charset)
+	}
+
+	if len(collate) > 0 {
+		query += " COLLATE ?"
+		args = append(args, collate)
+	}
+
+	if err := sql.QueryExec(ctx, NewQuery(query, args...)); err != nil {
+		return fmt.Errorf("failed to alter database, err: %s", err)
+	}
+
+	return nil
+}
+
+// DatabaseDefaultsDiffer checks if the charset or collation set in spec differ from the current ones
+func DatabaseDefaultsDiffer(info *DatabaseInfo, charset, collate string) bool {
+	if len(charset) > 0 && normalizeCharset(info.CharacterSet) != normalizeCharset(charset) {
+		return true
+	}
+
+	return len(collate) > 0 && normalizeCharset(info.Collation) != normalizeCharset(collate)
+}
+
+// normalizeCharset returns lower case name of the charset or collation, MariaDB 10.6 reports utf8 as utf8mb3
+func normalizeCharset(name string) string {
+	name = strings.ToLower(name)
+	if name == "utf8" || strings.HasPrefix(name, "utf8_") {
+		return "utf8mb3" + strings.TrimPrefix(name, "utf8")
+	}
+
+	return name
+}
@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GaleraStateSynced is the wsrep_local_state_comment of a node that is fully synced
+	GaleraStateSynced = "Synced"
+	// GaleraClusterPrimary is the wsrep_cluster_status of a node which is part of the primary component
+	GaleraClusterPrimary = "Primary"
+)
+
+// GaleraStatus holds a subset of wsrep status variables reported by a single node
+type GaleraStatus struct {
+	ClusterSize       int32
+	LocalStateComment string
+	ClusterStatus     string
+	Ready             bool
+}
+
+// IsSynced returns true if the node is synced and part of the primary component
+func (s *GaleraStatus) IsSynced() bool {
+	return s.Ready && s.LocalStateComment == GaleraStateSynced && s.ClusterStatus == GaleraClusterPrimary
+}
+
+// GetGaleraStatus reads wsrep status variables from the node
+func GetGaleraStatus(ctx context.Context, sql SQLRunner) (*GaleraStatus, error) {
+	rows, err := sql.QueryRows(ctx, NewQuery("SHOW GLOBAL STATUS LIKE 'wsrep_%'"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read galera status, err: %s", err)
+	}
+
+	status := &GaleraStatus{}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("failed to read galera status, err: %s", err)
+		}
+
+		switch strings.ToLower(name) {
+		case "wsrep_cluster_size":
+			size, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid wsrep_cluster_size %q, err: %s", value, err)
+			}
+			status.ClusterSize = int32(size)
+		case "wsrep_local_state_comment":
+			status.LocalStateComment = value
+		case "wsrep_cluster_status":
+			status.ClusterStatus = value
+		case "wsrep_ready":
+			status.Ready = strings.EqualFold(value, "ON")
+		}
+	}
+
+	return status, rows.Err()
+}
+
+// GaleraState is the content of grastate.dat, seqno is -1 when the node crashed and was not recovered yet
+type GaleraState struct {
+	UUID            string
+	Seqno           int64
+	SafeToBootstrap bool
+}
+
+// emptyGaleraUUID is written to grastate.dat by a node which never joined a cluster
+const emptyGaleraUUID = "00000000-0000-0000-0000-000000000000"
+
+// HasState returns true when the node was part of a cluster and knows its position in it
+func (s *GaleraState) HasState() bool {
+	return s.UUID != "" && s.UUID != emptyGaleraUUID && s.Seqno >= 0
+}
+
+// ParseGaleraState parses grastate.dat, unknown lines and comments are ignored
+func ParseGaleraState(data string) (*GaleraState, error) {
+	state := &GaleraState{Seqno: -1}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+
+		switch strings.TrimSpace(parts[0]) {
+		case "uuid":
+			state.UUID = value
+		case "seqno":
+			seqno, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid seqno %q, err: %s", value, err)
+			}
+			state.Seqno = seqno
+		case "safe_to_bootstrap":
+			state.SafeToBootstrap = value == "1"
+		}
+	}
+
+	return state, nil
+}
+
+// DesyncNode lets the node fall behind the cluster without blocking it by flow control, it's done before the node is restarted
+func DesyncNode(ctx context.Context, sql SQLRunner) error {
+	if err := sql.QueryExec(ctx, NewQuery("SET GLOBAL wsrep_desync = ON")); err != nil {
+		return fmt.Errorf("failed to desync node, err: %s", err)
+	}
+	return nil
+}
+
+// ResyncNode makes the desynced node follow the cluster again, it's done when the node isn't restarted after all
+func ResyncNode(ctx context.Context, sql SQLRunner) error {
+	if err := sql.QueryExec(ctx, NewQuery("SET GLOBAL wsrep_desync = OFF")); err != nil {
+		return fmt.Errorf("failed to resync node, err: %s", err)
+	}
+	return nil
+}
+
+// GetServerVersion returns the version of the server, e.g. 10.5.9-MariaDB-1:10.5.9+maria~focal
+func GetServerVersion(ctx context.Context, sql SQLRunner) (string, error) {
+	var version string
+	if err := sql.QueryRow(ctx, NewQuery("SELECT VERSION()"), &version); err != nil {
+		return "", fmt.Errorf("failed to read server version, err: %s", err)
+	}
+	return version, nil
+}
+
+// MajorVersion returns the major version of MariaDB (10.5), the system tables have to be upgraded when it changes
+func MajorVersion(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' })
+}
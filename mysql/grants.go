@@ -0,0 +1,311 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	identifierPattern = "`(?:[^`]|``)*`|\\*"
+	allPrivileges     = "ALL PRIVILEGES"
+	grantOption       = "GRANT OPTION"
+)
+
+// grantRegexp matches privileges granted on a schema or a table, grants on routines and proxies are not matched
+var grantRegexp = regexp.MustCompile("^GRANT (.+?) ON (" + identifierPattern + ")\\.(" + identifierPattern + ") TO (.*)$")
+
+// roleGrantRegexp matches role granted to a user or another role
+var roleGrantRegexp = regexp.MustCompile("^GRANT (" + identifierPattern + ") TO (.*)$")
+
+// defaultRoleRegexp matches default role of a user
+var defaultRoleRegexp = regexp.MustCompile("^SET DEFAULT ROLE (" + identifierPattern + ") FOR (.*)$")
+
+// Grants are privileges and roles of a user or a role as reported by SHOW GRANTS
+type Grants struct {
+	Permissions []mariadbv1alpha1.MariaDBPermission
+	Roles       []string
+	DefaultRole string
+}
+
+// GetUserGrants returns the privileges and roles the user@host has
+func GetUserGrants(ctx context.Context, sql SQLRunner, user, host string) (*Grants, error) {
+	return showGrants(ctx, sql, NewQuery("SHOW GRANTS FOR ?@?", user, host))
+}
+
+// GetRoleGrants returns the privileges the role has
+func GetRoleGrants(ctx context.Context, sql SQLRunner, role string) (*Grants, error) {
+	return showGrants(ctx, sql, NewQuery("SHOW GRANTS FOR "+escapeID(role)))
+}
+
+func showGrants(ctx context.Context, sql SQLRunner, query Query) (*Grants, error) {
+	rows, err := sql.QueryRows(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grants, err: %s", err)
+	}
+
+	grants := []string{}
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return nil, fmt.Errorf("failed to read grants, err: %s", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read grants, err: %s", err)
+	}
+
+	return ParseGrants(grants), nil
+}
+
+// ParseGrants converts output of SHOW GRANTS to permissions and roles, USAGE is skipped as it means no privileges
+func ParseGrants(grants []string) *Grants {
+	result := &Grants{}
+	privileges := newPrivilegeSet()
+	for _, grant := range grants {
+		grant = strings.TrimSpace(grant)
+		if match := defaultRoleRegexp.FindStringSubmatch(grant); match != nil {
+			result.DefaultRole = unescapeID(match[1])
+			continue
+		}
+		if match := roleGrantRegexp.FindStringSubmatch(grant); match != nil {
+			result.Roles = append(result.Roles, unescapeID(match[1]))
+			continue
+		}
+
+		match := grantRegexp.FindStringSubmatch(grant)
+		if match == nil {
+			continue
+		}
+
+		schema, table := unescapeID(match[2]), unescapeID(match[3])
+		for _, privilege := range splitPrivileges(match[1]) {
+			if privilege != "USAGE" {
+				privileges.add(schema, table, privilege)
+			}
+		}
+		if strings.Contains(match[4], " WITH GRANT OPTION") {
+			privileges.add(schema, table, grantOption)
+		}
+	}
+	result.Permissions = privileges.permissions()
+	sort.Strings(result.Roles)
+
+	return result
+}
+
+// PermissionsDiff returns privileges from current which are not present in desired
+func PermissionsDiff(desired, current []mariadbv1alpha1.MariaDBPermission) []mariadbv1alpha1.MariaDBPermission {
+	wanted := newPrivilegeSet()
+	for _, perm := range desired {
+		for _, table := range perm.Tables {
+			for _, privilege := range perm.Permissions {
+				wanted.add(stripID(perm.Schema), stripID(table), normalizePrivilege(privilege))
+			}
+		}
+	}
+
+	extra := newPrivilegeSet()
+	for _, perm := range current {
+		for _, table := range perm.Tables {
+			for _, privilege := range perm.Permissions {
+				if !wanted.has(perm.Schema, table, privilege) {
+					extra.add(perm.Schema, table, privilege)
+				}
+			}
+		}
+	}
+
+	return extra.permissions()
+}
+
+// GrantPermissions gives the permissions to the user on all allowed hosts
+func GrantPermissions(ctx context.Context, sql SQLRunner, user string, allowedHosts []string, permissions []mariadbv1alpha1.MariaDBPermission) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	if err := sql.QueryExec(ctx, permissionsToQuery(permissions, user, allowedHosts)); err != nil {
+		return fmt.Errorf("failed to grant permissions, err: %s", err)
+	}
+
+	return nil
+}
+
+// RevokePermissions takes the permissions away from the user@host
+func RevokePermissions(ctx context.Context, sql SQLRunner, user, host string, permissions []mariadbv1alpha1.MariaDBPermission) error {
+	return revokePermissions(ctx, sql, permissions, " FROM ?@?", user, host)
+}
+
+func revokePermissions(ctx context.Context, sql SQLRunner, permissions []mariadbv1alpha1.MariaDBPermission, from string, fromArgs ...interface{}) error {
+	queries := []Query{}
+	for _, perm := range permissions {
+		for _, table := range perm.Tables {
+			escPerms := []string{}
+			for _, privilege := range perm.Permissions {
+				escPerms = append(escPerms, Escape(privilege))
+			}
+
+			schemaTable := fmt.Sprintf("%s.%s", escapeID(perm.Schema), escapeID(table))
+			queries = append(queries, NewQuery("REVOKE "+strings.Join(escPerms, ", ")+" ON "+schemaTable+from, fromArgs...))
+		}
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+
+	if err := sql.QueryExec(ctx, BuildAtomicQuery(queries...)); err != nil {
+		return fmt.Errorf("failed to revoke permissions, err: %s", err)
+	}
+
+	return nil
+}
+
+// GrantRoles gives the roles to the user on all allowed hosts
+func GrantRoles(ctx context.Context, sql SQLRunner, user string, allowedHosts []string, roles []string) error {
+	queries := []Query{}
+	for _, role := range roles {
+		idsTmpl, idsArgs := getUsersIdentification(user, nil, allowedHosts)
+		queries = append(queries, NewQuery("GRANT "+escapeID(role)+" TO"+idsTmpl, idsArgs...))
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+
+	if err := sql.QueryExec(ctx, ConcatenateQueries(queries...)); err != nil {
+		return fmt.Errorf("failed to grant roles, err: %s", err)
+	}
+
+	return nil
+}
+
+// RevokeRoles takes the roles away from the user@host
+func RevokeRoles(ctx context.Context, sql SQLRunner, user, host string, roles []string) error {
+	queries := []Query{}
+	for _, role := range roles {
+		queries = append(queries, NewQuery("REVOKE "+escapeID(role)+" FROM ?@?", user, host))
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+
+	if err := sql.QueryExec(ctx, ConcatenateQueries(queries...)); err != nil {
+		return fmt.Errorf("failed to revoke roles, err: %s", err)
+	}
+
+	return nil
+}
+
+// SetDefaultRole sets role enabled when the user@host connects, empty role means none
+func SetDefaultRole(ctx context.Context, sql SQLRunner, user, host, role string) error {
+	name := "NONE"
+	if role != "" {
+		name = escapeID(role)
+	}
+
+	if err := sql.QueryExec(ctx, NewQuery("SET DEFAULT ROLE "+name+" FOR ?@?", user, host)); err != nil {
+		return fmt.Errorf("failed to set default role, err: %s", err)
+	}
+
+	return nil
+}
+
+// splitPrivileges splits privileges list on commas which are not part of a column list
+func splitPrivileges(list string) []string {
+	privileges := []string{}
+	depth, start := 0, 0
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				privileges = append(privileges, normalizePrivilege(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(privileges, normalizePrivilege(list[start:]))
+}
+
+// normalizePrivilege returns privilege in the form used by SHOW GRANTS
+func normalizePrivilege(privilege string) string {
+	privilege = strings.Join(strings.Fields(strings.ToUpper(privilege)), " ")
+	if privilege == "ALL" {
+		return allPrivileges
+	}
+
+	return privilege
+}
+
+func unescapeID(id string) string {
+	if id == "*" {
+		return id
+	}
+
+	return strings.ReplaceAll(id[1:len(id)-1], "``", "`")
+}
+
+// stripID returns identifier as it's used by escapeID
+func stripID(id string) string {
+	return strings.ReplaceAll(id, "`", "")
+}
+
+// privilegeSet holds privileges indexed by schema and table
+type privilegeSet map[string]map[string]map[string]bool
+
+func newPrivilegeSet() privilegeSet {
+	return privilegeSet{}
+}
+
+func (s privilegeSet) add(schema, table, privilege string) {
+	if s[schema] == nil {
+		s[schema] = map[string]map[string]bool{}
+	}
+	if s[schema][table] == nil {
+		s[schema][table] = map[string]bool{}
+	}
+	s[schema][table][privilege] = true
+}
+
+func (s privilegeSet) has(schema, table, privilege string) bool {
+	// all privileges don't include grant option
+	if privilege != grantOption && s[schema][table][allPrivileges] {
+		return true
+	}
+
+	return s[schema][table][privilege]
+}
+
+// permissions returns the set as permissions sorted by schema, table and privilege
+func (s privilegeSet) permissions() []mariadbv1alpha1.MariaDBPermission {
+	result := []mariadbv1alpha1.MariaDBPermission{}
+	for schema, tables := range s {
+		for table, privileges := range tables {
+			perm := mariadbv1alpha1.MariaDBPermission{
+				Schema: schema,
+				Tables: []string{table},
+			}
+			for privilege := range privileges {
+				perm.Permissions = append(perm.Permissions, privilege)
+			}
+			sort.Strings(perm.Permissions)
+			result = append(result, perm)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Schema == result[j].Schema {
+			return result[i].Tables[0] < result[j].Tables[0]
+		}
+		return result[i].Schema < result[j].Schema
+	})
+
+	return result
+}
@@ -2,14 +2,18 @@ package mysql
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	// this import  needs to be done otherwise the mysql driver don't work
 	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
-	_ "github.com/go-sql-driver/mysql"
+	driver "github.com/go-sql-driver/mysql"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -22,6 +26,13 @@ type Config struct {
 	Password string
 	Host     string
 	Port     int32
+	// TLSCA is the CA certificate the servers are verified with, the connection isn't encrypted when it's empty
+	TLSCA []byte
+	// TLSServerName is the name the certificate of the servers is verified for, pods are connected by IP
+	TLSServerName string
+	// TLSPreferred encrypts the connection without verifying the server when the server supports TLS.
+	// It's used while TLS of the cluster is turned on or off and only some servers have the certificate.
+	TLSPreferred bool
 }
 
 // NewConfigFromClusterKey returns a new Config based on a MariaDBCluster key
@@ -40,23 +51,84 @@ func NewConfigFromClusterKey(ctx context.Context, c client.Client, clusterKey cl
 	if _, ok := secret.Data[cluster.Spec.RootPassword.Key]; !ok {
 		return nil, errors.New("missing key in password secret")
 	}
-	return &Config{
+	cfg := &Config{
 		User:     "root",
 		Password: string(secret.Data[cluster.Spec.RootPassword.Key]),
 		Host:     cluster.GetPrimaryHeadlessAddress(),
 		Port:     3306,
-	}, nil
+	}
+	switch cluster.Status.TLSMode {
+	case mariadbv1alpha1.TLSModeEnabled:
+		tlsSecret := &corev1.Secret{}
+		tlsSecretKey := client.ObjectKey{Name: cluster.GetTLSSecretName(), Namespace: cluster.Namespace}
+		if err := c.Get(ctx, tlsSecretKey, tlsSecret); err != nil {
+			return nil, err
+		}
+		if len(tlsSecret.Data[mariadbv1alpha1.TLSCACertKey]) == 0 {
+			return nil, errors.New("missing CA certificate in TLS secret")
+		}
+		cfg.TLSCA = tlsSecret.Data[mariadbv1alpha1.TLSCACertKey]
+		cfg.TLSServerName = cluster.GetPrimaryHeadlessAddress()
+	case mariadbv1alpha1.TLSModeDynamic:
+		cfg.TLSPreferred = true
+	}
+
+	return cfg, nil
+}
+
+// registerTLSConfig registers in the driver a TLS config verifying the servers with the CA of the config,
+// configs are named by hash of the CA and the server name so every cluster gets its own
+func registerTLSConfig(c *Config) (string, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(c.TLSCA) {
+		return "", errors.New("invalid CA certificate")
+	}
+
+	h := sha256.New()
+	h.Write(c.TLSCA)
+	h.Write([]byte(c.TLSServerName))
+	name := hex.EncodeToString(h.Sum(nil))
+	err := driver.RegisterTLSConfig(name, &tls.Config{
+		RootCAs:    pool,
+		ServerName: c.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to register TLS config, err: %s", err)
+	}
+
+	return name, nil
+}
+
+// WithHost returns a copy of the config pointing to the given host, used to connect to a single pod
+func (c *Config) WithHost(host string) *Config {
+	cfg := *c
+	cfg.Host = host
+	return &cfg
 }
 
 // GetMysqlDSN returns a data source name
-func (c *Config) GetMysqlDSN() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&multiStatements=true&interpolateParams=true",
+func (c *Config) GetMysqlDSN() (string, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&multiStatements=true&interpolateParams=true",
 		c.User, c.Password, c.Host, c.Port)
+	switch {
+	case c.TLSPreferred:
+		dsn += "&tls=preferred"
+	case len(c.TLSCA) > 0:
+		name, err := registerTLSConfig(c)
+		if err != nil {
+			return "", err
+		}
+		dsn += "&tls=" + name
+	}
+
+	return dsn, nil
 }
 
 //go:generate go run -mod=mod github.com/golang/mock/mockgen -destination=../mocks/mysql/mock_rows.go -package=mysql -build_flags=--mod=mod  github.com/aldor007/mariadb-operator/mysql Rows
 // Rows interface is a subset of mysql.Rows
 type Rows interface {
+	Columns() ([]string, error)
 	Err() error
 	Next() bool
 	Scan(dest ...interface{}) error
@@ -87,7 +159,12 @@ func NewSQLRunner(cfg *Config, errs ...error) (SQLRunner, func(), error) {
 		return nil, closeFn, errs[0]
 	}
 
-	db, err := sql.Open("mysql", cfg.GetMysqlDSN())
+	dsn, err := cfg.GetMysqlDSN()
+	if err != nil {
+		return nil, closeFn, err
+	}
+
+	db, err = sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, closeFn, err
 	}
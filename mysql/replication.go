@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+)
+
+// ReplicaStatus holds a subset of SHOW SLAVE STATUS columns
+type ReplicaStatus struct {
+	MasterHost          string
+	IORunning           bool
+	SQLRunning          bool
+	SecondsBehindMaster *int64
+	GtidIOPos           string
+	LastIOError         string
+	LastSQLError        string
+}
+
+// ConfigureReplication points the replica to the given primary using GTID based replication and starts it
+func ConfigureReplication(ctx context.Context, sql SQLRunner, host string, port int32, user, pass string) error {
+	query := ConcatenateQueries(
+		NewQuery("STOP SLAVE"),
+		NewQuery("CHANGE MASTER TO MASTER_HOST=?, MASTER_PORT=?, MASTER_USER=?, MASTER_PASSWORD=?, MASTER_USE_GTID=slave_pos",
+			host, port, user, pass),
+		NewQuery("START SLAVE"),
+	)
+
+	if err := sql.QueryExec(ctx, query); err != nil {
+		return fmt.Errorf("failed to configure replication, err: %s", err)
+	}
+
+	return nil
+}
+
+// GetReplicaStatus reads the replication status, it returns nil if the replication is not configured
+func GetReplicaStatus(ctx context.Context, runner SQLRunner) (*ReplicaStatus, error) {
+	rows, err := runner.QueryRows(ctx, NewQuery("SHOW SLAVE STATUS"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replica status, err: %s", err)
+	}
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replica status, err: %s", err)
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to read replica status, err: %s", err)
+	}
+
+	status := &ReplicaStatus{}
+	for i, column := range columns {
+		value := values[i].String
+		switch column {
+		case "Master_Host":
+			status.MasterHost = value
+		case "Slave_IO_Running":
+			status.IORunning = value == "Yes"
+		case "Slave_SQL_Running":
+			status.SQLRunning = value == "Yes"
+		case "Seconds_Behind_Master":
+			if !values[i].Valid {
+				continue
+			}
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Seconds_Behind_Master %q, err: %s", value, err)
+			}
+			status.SecondsBehindMaster = &seconds
+		case "Gtid_IO_Pos":
+			status.GtidIOPos = value
+		case "Last_IO_Error":
+			status.LastIOError = value
+		case "Last_SQL_Error":
+			status.LastSQLError = value
+		}
+	}
+
+	return status, rows.Err()
+}
@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+)
+
+// CreateRoleIfNotExists creates a role if it doesn't already exist and it gives it the specified permissions
+func CreateRoleIfNotExists(ctx context.Context, sql SQLRunner, role string, permissions []mariadbv1alpha1.MariaDBPermission) error {
+	queries := []Query{
+		NewQuery("CREATE ROLE IF NOT EXISTS " + escapeID(role)),
+	}
+	if len(permissions) > 0 {
+		queries = append(queries, rolePermissionsToQuery(permissions, role))
+	}
+
+	if err := sql.QueryExec(ctx, BuildAtomicQuery(queries...)); err != nil {
+		return fmt.Errorf("failed to configure role, err: %s", err)
+	}
+
+	return nil
+}
+
+// GrantRolePermissions gives the permissions to the role
+func GrantRolePermissions(ctx context.Context, sql SQLRunner, role string, permissions []mariadbv1alpha1.MariaDBPermission) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	if err := sql.QueryExec(ctx, rolePermissionsToQuery(permissions, role)); err != nil {
+		return fmt.Errorf("failed to grant permissions, err: %s", err)
+	}
+
+	return nil
+}
+
+// RevokeRolePermissions takes the permissions away from the role
+func RevokeRolePermissions(ctx context.Context, sql SQLRunner, role string, permissions []mariadbv1alpha1.MariaDBPermission) error {
+	return revokePermissions(ctx, sql, permissions, " FROM "+escapeID(role))
+}
+
+// DropRole removes a role if it exists, users lose privileges they had through it
+func DropRole(ctx context.Context, sql SQLRunner, role string) error {
+	if err := sql.QueryExec(ctx, NewQuery("DROP ROLE IF EXISTS "+escapeID(role))); err != nil {
+		return fmt.Errorf("failed to delete role, err: %s", err)
+	}
+
+	return nil
+}
+
+func rolePermissionsToQuery(permissions []mariadbv1alpha1.MariaDBPermission, role string) Query {
+	return grantQuery(permissions, " TO "+escapeID(role))
+}
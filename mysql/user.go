@@ -5,22 +5,52 @@ import (
 	"errors"
 	"fmt"
 	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"sort"
 	"strings"
 )
 
+// Authentication describes how the user proves its identity, password is used when no plugin is set
+type Authentication struct {
+	Plugin       mariadbv1alpha1.AuthPlugin
+	Password     string
+	PasswordHash string
+	Principal    string
+}
+
+// UserOptions are the account options of a user
+type UserOptions struct {
+	Authentication Authentication
+	Require        *mariadbv1alpha1.MariaDBUserTLSRequirement
+	ResourceLimits mariadbv1alpha1.MariaDBUserLimits
+	// Locked disables login to the account
+	Locked bool
+	// PasswordExpireDays is the password lifetime, 0 means never and nil the server default
+	PasswordExpireDays *int32
+}
+
 // CreateUserIfNotExists creates a user if it doesn't already exist and it gives it the specified permissions
 func CreateUserIfNotExists(ctx context.Context, sql SQLRunner,
 	user, pass string, allowedHosts []string, permissions []mariadbv1alpha1.MariaDBPermission,
 	resourceLimit mariadbv1alpha1.MariaDBUserLimits) error {
 
+	return ConfigureUser(ctx, sql, user, allowedHosts, permissions, UserOptions{
+		Authentication: Authentication{Password: pass},
+		ResourceLimits: resourceLimit,
+	})
+}
+
+// ConfigureUser creates a user if it doesn't already exist, sets its account options and gives it the specified permissions
+func ConfigureUser(ctx context.Context, sql SQLRunner, user string, allowedHosts []string,
+	permissions []mariadbv1alpha1.MariaDBPermission, options UserOptions) error {
+
 	// throw error if there are no allowed hosts
 	if len(allowedHosts) == 0 {
 		return errors.New("no allowedHosts specified")
 	}
 
 	queries := []Query{
-		getCreateUserQuery(user, pass, allowedHosts),
-		getAlterUserQuery(user, pass, allowedHosts, resourceLimit),
+		getCreateUserQuery(user, options.Authentication, allowedHosts),
+		getAlterUserQuery(user, allowedHosts, options),
 	}
 
 	if len(permissions) > 0 {
@@ -36,52 +66,152 @@ func CreateUserIfNotExists(ctx context.Context, sql SQLRunner,
 	return nil
 }
 
-func getAlterUserQuery(user, pwd string, allowedHosts []string, resourceLimit mariadbv1alpha1.MariaDBUserLimits) Query {
+func getAlterUserQuery(user string, allowedHosts []string, options UserOptions) Query {
 	args := []interface{}{}
 	q := "ALTER USER"
 
 	// add user identifications (user@allowedHost) pairs
-	ids, idsArgs := getUsersIdentification(user, &pwd, allowedHosts)
+	ids, idsArgs := getUsersIdentification(user, &options.Authentication, allowedHosts)
 	q += ids
 	args = append(args, idsArgs...)
 
-	// add WITH statement for resource options
-	if len(resourceLimit.Get()) > 0 {
-		q += " WITH"
-		for key, value := range resourceLimit.Get() {
-			q += fmt.Sprintf(" %s ?", Escape(string(key)))
-			args = append(args, value)
-		}
+	// TLS requirements are always set so removing them from spec resets them
+	require, requireArgs := getRequireClause(options.Require)
+	q += require
+	args = append(args, requireArgs...)
+
+	// add WITH statement for resource options, all of them are set so the ones removed from spec are reset
+	limits := options.ResourceLimits.Get()
+	keys := make([]string, 0, len(limits))
+	for key := range limits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	q += " WITH"
+	for _, key := range keys {
+		q += fmt.Sprintf(" %s ?", Escape(key))
+		args = append(args, limits[key])
+	}
+
+	switch {
+	case options.PasswordExpireDays == nil:
+		q += " PASSWORD EXPIRE DEFAULT"
+	case *options.PasswordExpireDays == 0:
+		q += " PASSWORD EXPIRE NEVER"
+	default:
+		q += " PASSWORD EXPIRE INTERVAL ? DAY"
+		args = append(args, *options.PasswordExpireDays)
+	}
+
+	if options.Locked {
+		q += " ACCOUNT LOCK"
+	} else {
+		q += " ACCOUNT UNLOCK"
 	}
 
 	return NewQuery(q, args...)
 }
 
-func getCreateUserQuery(user, pwd string, allowedHosts []string) Query {
-	idsTmpl, idsArgs := getUsersIdentification(user, &pwd, allowedHosts)
+func getCreateUserQuery(user string, auth Authentication, allowedHosts []string) Query {
+	idsTmpl, idsArgs := getUsersIdentification(user, &auth, allowedHosts)
 
 	return NewQuery(fmt.Sprintf("CREATE USER IF NOT EXISTS%s", idsTmpl), idsArgs...)
 }
 
-func getUsersIdentification(user string, pwd *string, allowedHosts []string) (ids string, args []interface{}) {
+func getUsersIdentification(user string, auth *Authentication, allowedHosts []string) (ids string, args []interface{}) {
 	for i, host := range allowedHosts {
 		// add comma if more than one allowed hosts are used
 		if i > 0 {
 			ids += ","
 		}
 
-		if pwd != nil {
-			ids += " ?@? IDENTIFIED BY ?"
-			args = append(args, user, host, *pwd)
-		} else {
-			ids += " ?@?"
-			args = append(args, user, host)
+		ids += " ?@?"
+		args = append(args, user, host)
+		if auth != nil {
+			identified, identifiedArgs := getIdentifiedClause(auth)
+			ids += identified
+			args = append(args, identifiedArgs...)
 		}
 	}
 
 	return ids, args
 }
 
+// getIdentifiedClause returns IDENTIFIED part of the user specification
+func getIdentifiedClause(auth *Authentication) (string, []interface{}) {
+	switch auth.Plugin {
+	case mariadbv1alpha1.AuthPluginED25519:
+		if auth.PasswordHash != "" {
+			return " IDENTIFIED VIA ed25519 USING ?", []interface{}{auth.PasswordHash}
+		}
+		return " IDENTIFIED VIA ed25519 USING PASSWORD(?)", []interface{}{auth.Password}
+	case mariadbv1alpha1.AuthPluginUnixSocket:
+		return " IDENTIFIED VIA unix_socket", nil
+	case mariadbv1alpha1.AuthPluginGSSAPI:
+		if auth.Principal != "" {
+			return " IDENTIFIED VIA gssapi USING ?", []interface{}{auth.Principal}
+		}
+		return " IDENTIFIED VIA gssapi", nil
+	}
+
+	if auth.PasswordHash != "" {
+		return " IDENTIFIED BY PASSWORD ?", []interface{}{auth.PasswordHash}
+	}
+	return " IDENTIFIED BY ?", []interface{}{auth.Password}
+}
+
+// getRequireClause returns REQUIRE part of ALTER USER, NONE when there are no requirements
+func getRequireClause(require *mariadbv1alpha1.MariaDBUserTLSRequirement) (string, []interface{}) {
+	if require == nil {
+		return " REQUIRE NONE", nil
+	}
+
+	options := []string{}
+	args := []interface{}{}
+	if require.Subject != "" {
+		options = append(options, "SUBJECT ?")
+		args = append(args, require.Subject)
+	}
+	if require.Issuer != "" {
+		options = append(options, "ISSUER ?")
+		args = append(args, require.Issuer)
+	}
+	if require.Cipher != "" {
+		options = append(options, "CIPHER ?")
+		args = append(args, require.Cipher)
+	}
+
+	switch {
+	case len(options) > 0:
+		return " REQUIRE " + strings.Join(options, " AND "), args
+	case require.X509:
+		return " REQUIRE X509", nil
+	case require.SSL:
+		return " REQUIRE SSL", nil
+	}
+
+	return " REQUIRE NONE", nil
+}
+
+// GetUserLimits returns the resource limits the user@host has on the server
+func GetUserLimits(ctx context.Context, sql SQLRunner, user, host string) (*mariadbv1alpha1.MariaDBUserLimits, error) {
+	query := NewQuery("SELECT max_questions, max_updates, max_connections, max_user_connections, max_statement_time "+
+		"FROM mysql.user WHERE User = ? AND Host = ?", user, host)
+
+	limits := &mariadbv1alpha1.MariaDBUserLimits{}
+	// max_statement_time is a decimal number of seconds
+	var statementTime float64
+	err := sql.QueryRow(ctx, query, &limits.MaxQueriesPerHour, &limits.MaxUpdatePerHour, &limits.MaxConnectionsPerHour,
+		&limits.MaxUserConnections, &statementTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user limits, err: %s", err)
+	}
+	limits.MaxStatementTime = int(statementTime)
+
+	return limits, nil
+}
+
 // DropUser removes a MySQL user if it exists, along with its privileges
 func DropUser(ctx context.Context, sql SQLRunner, user, host string) error {
 	query := NewQuery("DROP USER IF EXISTS ?@?;", user, host)
@@ -94,6 +224,13 @@ func DropUser(ctx context.Context, sql SQLRunner, user, host string) error {
 }
 
 func permissionsToQuery(permissions []mariadbv1alpha1.MariaDBPermission, user string, allowedHosts []string) Query {
+	idsTmpl, idsArgs := getUsersIdentification(user, nil, allowedHosts)
+
+	return grantQuery(permissions, " TO"+idsTmpl, idsArgs...)
+}
+
+// grantQuery builds GRANT queries of the permissions, to is the grantee part of the query
+func grantQuery(permissions []mariadbv1alpha1.MariaDBPermission, to string, toArgs ...interface{}) Query {
 	permQueries := []Query{}
 
 	for _, perm := range permissions {
@@ -109,10 +246,8 @@ func permissionsToQuery(permissions []mariadbv1alpha1.MariaDBPermission, user st
 			schemaTable := fmt.Sprintf("%s.%s", escapeID(perm.Schema), escapeID(table))
 
 			// Build GRANT query
-			idsTmpl, idsArgs := getUsersIdentification(user, nil, allowedHosts)
-
-			query := "GRANT " + strings.Join(escPerms, ", ") + " ON " + schemaTable + " TO" + idsTmpl
-			args = append(args, idsArgs...)
+			query := "GRANT " + strings.Join(escPerms, ", ") + " ON " + schemaTable + to
+			args = append(args, toArgs...)
 
 			permQueries = append(permQueries, NewQuery(query, args...))
 		}
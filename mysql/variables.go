@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var variableNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// SystemVariable describes a server variable as reported by information_schema.SYSTEM_VARIABLES
+type SystemVariable struct {
+	Name     string
+	Value    string
+	ReadOnly bool
+}
+
+// VariableName converts option name used in my.cnf to the system variable name
+func VariableName(option string) string {
+	return strings.ToLower(strings.ReplaceAll(option, "-", "_"))
+}
+
+// GetSystemVariables returns the requested variables indexed by lower cased name
+func GetSystemVariables(ctx context.Context, sql SQLRunner, names []string) (map[string]SystemVariable, error) {
+	variables := make(map[string]SystemVariable, len(names))
+	if len(names) == 0 {
+		return variables, nil
+	}
+
+	placeholders := make([]string, 0, len(names))
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		placeholders = append(placeholders, "?")
+		args = append(args, strings.ToUpper(VariableName(name)))
+	}
+
+	query := NewQuery(fmt.Sprintf("SELECT VARIABLE_NAME, IFNULL(GLOBAL_VALUE, ''), READ_ONLY FROM information_schema.SYSTEM_VARIABLES WHERE VARIABLE_NAME IN (%s)",
+		strings.Join(placeholders, ", ")), args...)
+	rows, err := sql.QueryRows(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system variables, err: %s", err)
+	}
+
+	for rows.Next() {
+		var name, value, readOnly string
+		if err := rows.Scan(&name, &value, &readOnly); err != nil {
+			return nil, fmt.Errorf("failed to read system variables, err: %s", err)
+		}
+		name = strings.ToLower(name)
+		variables[name] = SystemVariable{
+			Name:     name,
+			Value:    value,
+			ReadOnly: strings.EqualFold(readOnly, "YES"),
+		}
+	}
+
+	return variables, rows.Err()
+}
+
+// SetGlobalVariable changes the value of a dynamic variable on the running server
+func SetGlobalVariable(ctx context.Context, sql SQLRunner, name, value string) error {
+	name = VariableName(name)
+	if !variableNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+
+	// numeric variables refuse quoted values so numbers have to be passed as integers
+	var arg interface{} = value
+	if number, ok := ParseVariableNumber(value); ok {
+		arg = number
+	}
+
+	if err := sql.QueryExec(ctx, NewQuery(fmt.Sprintf("SET GLOBAL %s = ?", name), arg)); err != nil {
+		return fmt.Errorf("failed to set variable %s, err: %s", name, err)
+	}
+
+	return nil
+}
+
+// ResetGlobalVariable sets a dynamic variable back to its compiled-in default on the running server
+func ResetGlobalVariable(ctx context.Context, sql SQLRunner, name string) error {
+	name = VariableName(name)
+	if !variableNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+
+	if err := sql.QueryExec(ctx, NewQuery(fmt.Sprintf("SET GLOBAL %s = DEFAULT", name))); err != nil {
+		return fmt.Errorf("failed to reset variable %s, err: %s", name, err)
+	}
+
+	return nil
+}
+
+// ParseVariableNumber parses integer value with optional K, M, G or T suffix as used in my.cnf
+func ParseVariableNumber(value string) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return number * multiplier, true
+}
+
+// VariableValueEqual compares value from my.cnf with value reported by the server
+func VariableValueEqual(configured, current string) bool {
+	return normalizeVariableValue(configured) == normalizeVariableValue(current)
+}
+
+func normalizeVariableValue(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), `"'`)
+	if number, ok := ParseVariableNumber(value); ok {
+		value = strconv.FormatInt(number, 10)
+	}
+
+	switch strings.ToUpper(value) {
+	case "1", "ON", "TRUE", "YES":
+		return "ON"
+	case "0", "OFF", "FALSE", "NO":
+		return "OFF"
+	}
+
+	return strings.ToUpper(value)
+}
@@ -0,0 +1,199 @@
+package arbitrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/aldor007/mariadb-operator/resources/tls"
+	"github.com/aldor007/mariadb-operator/utils"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	componentName = "arbitrator"
+	// Port is the galera replication port garbd listens on
+	Port = 4567
+)
+
+// Reconciler implements the Component Reconciler
+type Reconciler struct {
+	resources.Reconciler
+}
+
+func NewArbitrator(client client.Client, directClient client.Reader, scheme *runtime.Scheme, cluster *mariadbv1alpha1.MariaDBCluster) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Client:         client,
+			Scheme:         scheme,
+			DirectClient:   directClient,
+			MariaDBCluster: cluster,
+		},
+	}
+}
+
+// Reconcile runs galera arbitrator next to the primary nodes when it's enabled and removes it otherwise
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", componentName, "clusterName", r.MariaDBCluster.Name, "clusterNamespace", r.MariaDBCluster.Namespace)
+
+	log.V(1).Info("Reconciling")
+
+	found := &appsv1.Deployment{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      r.MariaDBCluster.GetArbitratorName(),
+		Namespace: r.MariaDBCluster.Namespace,
+	}, found)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get arbitrator deployment, err: %s", err)
+	}
+	exists := err == nil
+
+	if !r.MariaDBCluster.HasArbitrator() {
+		if !exists {
+			return nil
+		}
+		log.Info("Deleting arbitrator", "name", found.Name)
+		if err := r.Client.Delete(ctx, found); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete arbitrator deployment, err: %s", err)
+		}
+		return nil
+	}
+
+	deployment := r.CreateDeployment()
+	if !exists {
+		log.Info("Creating arbitrator", "name", deployment.Name)
+		if err := r.Client.Create(ctx, &deployment); err != nil {
+			return fmt.Errorf("failed to create arbitrator deployment, err: %s", err)
+		}
+		return nil
+	}
+
+	if found.Annotations[r.GetConfigAnnotation()] == deployment.Annotations[r.GetConfigAnnotation()] {
+		return nil
+	}
+	log.Info("Updating arbitrator", "name", deployment.Name)
+	deployment.ResourceVersion = found.ResourceVersion
+	if err := r.Client.Update(ctx, &deployment); err != nil {
+		return fmt.Errorf("failed to update arbitrator deployment, err: %s", err)
+	}
+
+	return nil
+}
+
+// CreateDeployment returns the deployment running garbd, it joins the galera cluster through the primary headless service
+func (r *Reconciler) CreateDeployment() appsv1.Deployment {
+	labels := utils.Labels(r.MariaDBCluster)
+	labels["mariadb/type"] = componentName
+
+	hash := r.configHash()
+	replicas := int32(1)
+	env := []corev1.EnvVar{
+		{
+			Name:  "CLUSTER_NAME",
+			Value: r.MariaDBCluster.Name,
+		},
+		{
+			Name:  "PRIMARY_HOST",
+			Value: r.MariaDBCluster.GetPrimaryHeadlessAddress(),
+		},
+	}
+
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        r.MariaDBCluster.GetArbitratorName(),
+			Namespace:   r.MariaDBCluster.Namespace,
+			Labels:      labels,
+			Annotations: map[string]string{r.GetConfigAnnotation(): hash},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			// two arbitrators would have two votes in the quorum
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: map[string]string{r.GetConfigAnnotation(): hash},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            "garbd",
+						Image:           r.MariaDBCluster.Spec.Image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Command:         []string{"/usr/share/container-scripts/mysql/start-arbitrator.sh"},
+						Ports: []corev1.ContainerPort{{
+							ContainerPort: Port,
+							Name:          "galera",
+						}},
+						Env:       env,
+						Resources: r.MariaDBCluster.Spec.Arbitrator.Resources,
+					}},
+				},
+			},
+		},
+	}
+
+	if r.MariaDBCluster.IsTLSEnabled() {
+		r.addTLS(&deployment.Spec.Template)
+	}
+
+	controllerutil.SetControllerReference(r.MariaDBCluster, &deployment, r.Scheme)
+	return deployment
+}
+
+// addTLS mounts the server certificate, garbd uses it the same way as the galera nodes
+func (r *Reconciler) addTLS(template *corev1.PodTemplateSpec) {
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: tls.VolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: r.MariaDBCluster.GetTLSSecretName(),
+			},
+		},
+	})
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      tls.VolumeName,
+		MountPath: tls.MountPath,
+		ReadOnly:  true,
+	})
+	socket := "socket.ssl=yes"
+	if r.MariaDBCluster.Status.TLSMode == mariadbv1alpha1.TLSModeDynamic {
+		socket += ";socket.dynamic=yes"
+	}
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name: "GARBD_OPTIONS",
+		Value: fmt.Sprintf("%s;socket.ssl_ca=%s;socket.ssl_cert=%s;socket.ssl_key=%s", socket,
+			path.Join(tls.MountPath, tls.CACertKey), path.Join(tls.MountPath, corev1.TLSCertKey), path.Join(tls.MountPath, corev1.TLSPrivateKeyKey)),
+	})
+}
+
+// configHash returns hash of the spec of the arbitrator, the deployment is updated only when it changes
+func (r *Reconciler) configHash() string {
+	h := sha256.New()
+	h.Write([]byte(r.MariaDBCluster.Spec.Image))
+	h.Write([]byte(r.MariaDBCluster.Spec.Arbitrator.Resources.String()))
+	if r.MariaDBCluster.IsTLSEnabled() {
+		h.Write([]byte(r.MariaDBCluster.GetTLSSecretName()))
+		h.Write([]byte(r.MariaDBCluster.Status.TLSCertificateHash))
+		h.Write([]byte(r.MariaDBCluster.Status.TLSMode))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -2,9 +2,12 @@ package backup
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
 	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/aldor007/mariadb-operator/resources/tls"
 	"github.com/go-logr/logr"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/batch/v1"
@@ -13,6 +16,8 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"path"
+	"strconv"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -21,6 +26,12 @@ import (
 
 const (
 	componentName = "backup"
+	// NameLabel is set on backup jobs to find the MariaDBBackup they belong to
+	NameLabel = "mariadb/backup"
+	// NamespaceLabel is the namespace of the MariaDBBackup, jobs run in the cluster namespace
+	NamespaceLabel = "mariadb/backup-namespace"
+	// AgentPort is the port on which the agent next to the Galera node streams mariabackup of it
+	AgentPort = 3307
 )
 
 // Reconciler implements the Component Reconciler
@@ -45,12 +56,17 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 	log = log.WithValues("component", componentName, "clusterName", r.MariaDBCluster.Name, "clusterNamespace", r.MariaDBCluster.Namespace)
 
 	log.V(1).Info("Reconciling")
+	if err := r.removeLegacyJobs(ctx, log); err != nil {
+		return err
+	}
+
 	if r.backup.Spec.CronExpression != "" {
 		job := r.createCronJobs(r.backup)
+		found := &batchv1beta.CronJob{}
 		err := r.Client.Get(ctx, types.NamespacedName{
-			Namespace: r.backup.Namespace,
+			Namespace: job.Namespace,
 			Name:      job.Name,
-		}, &job)
+		}, found)
 		if err != nil && apierrors.IsNotFound(err) {
 			// Create the deployment
 			log.Info("Creating a new cronjob", "name", job.Name)
@@ -60,11 +76,17 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 				log.Error(err, "Failed to create new cronjob", "Name", job.Name)
 				return err
 			}
+			return nil
+		} else if err != nil {
+			log.Error(err, "Failed to get cronjob", "Name", job.Name)
+			return err
 		}
 
-		if job.Annotations != nil || job.Annotations[r.GetConfigAnnotation()] != r.backup.GetConfigHash() {
-			job = r.createCronJobs(r.backup)
-			err = r.Client.Update(ctx, &job)
+		if found.Annotations == nil || found.Annotations[r.GetConfigAnnotation()] != r.configHash(r.backup) {
+			found.Annotations = job.Annotations
+			found.Labels = job.Labels
+			found.Spec = job.Spec
+			err = r.Client.Update(ctx, found)
 			if err != nil {
 				// Deployment failed
 				log.Error(err, "Failed to update cronjob", "Name", job.Name)
@@ -73,10 +95,11 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 		}
 	} else {
 		job := r.createJob(r.backup)
+		found := &batchv1.Job{}
 		err := r.Client.Get(ctx, types.NamespacedName{
-			Namespace: r.backup.Namespace,
+			Namespace: job.Namespace,
 			Name:      job.Name,
-		}, &job)
+		}, found)
 		if err != nil && apierrors.IsNotFound(err) {
 			// Create the deployment
 			log.Info("Creating a new job", "name", job.Name)
@@ -86,14 +109,23 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 				log.Error(err, "Failed to create new job", "Name", job.Name)
 				return err
 			}
+			return nil
+		} else if err != nil {
+			log.Error(err, "Failed to get job", "Name", job.Name)
+			return err
 		}
 
-		if job.Annotations != nil || job.Annotations[r.GetConfigAnnotation()] != r.backup.GetConfigHash() {
-			job = r.createJob(r.backup)
-			err = r.Client.Update(ctx, &job)
+		// pod template of a job is immutable, the job is recreated to run the backup with the new config
+		if found.Annotations == nil || found.Annotations[r.GetConfigAnnotation()] != r.configHash(r.backup) {
+			log.Info("Backup config changed, recreating job", "name", job.Name)
+			err = r.Client.Delete(ctx, found, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if err != nil && !apierrors.IsNotFound(err) {
+				log.Error(err, "Failed to delete job", "Name", job.Name)
+				return err
+			}
+			err = r.Client.Create(ctx, &job)
 			if err != nil {
-				// Deployment failed
-				log.Error(err, "Failed to update njob", "Name", job.Name)
+				log.Error(err, "Failed to create new job", "Name", job.Name)
 				return err
 			}
 		}
@@ -102,19 +134,74 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 	return nil
 }
 
+// configHash returns hash of the job config, physical backups depend on TLS of the cluster too.
+// Hash of other backups is kept as it was so existing jobs aren't run again.
+func (r *Reconciler) configHash(cron *mariadbv1alpha1.MariaDBBackup) string {
+	hash := cron.GetConfigHash()
+	if cron.GetMethod() != mariadbv1alpha1.BackupMethodPhysical || !r.MariaDBCluster.IsTLSEnabled() {
+		return hash
+	}
+
+	h := sha256.New()
+	h.Write([]byte(hash))
+	h.Write([]byte(r.MariaDBCluster.GetTLSSecretName()))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// removeLegacyJobs deletes job and cronjob named after the cluster, they were shared by all backups of the cluster
+func (r *Reconciler) removeLegacyJobs(ctx context.Context, log logr.Logger) error {
+	key := types.NamespacedName{
+		Name:      fmt.Sprintf("%s-%s", "backup", r.MariaDBCluster.Name),
+		Namespace: r.MariaDBCluster.Namespace,
+	}
+	if key.Name == r.backup.GetJobName() {
+		return nil
+	}
+
+	for _, obj := range []client.Object{&batchv1beta.CronJob{}, &batchv1.Job{}} {
+		err := r.Client.Get(ctx, key, obj)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// legacy jobs are owned by the cluster, the label is missing on the ones created before backups were labeled
+		if name, ok := obj.GetLabels()[NameLabel]; ok && name != r.backup.Name {
+			continue
+		}
+		if !metav1.IsControlledBy(obj, r.MariaDBCluster) {
+			continue
+		}
+
+		log.Info("Removing legacy backup job", "name", key.Name)
+		err = r.Client.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *Reconciler) createCronJobs(cron *mariadbv1alpha1.MariaDBBackup) batchv1beta.CronJob {
 	annotations := make(map[string]string)
-	annotations[r.GetConfigAnnotation()] = cron.GetConfigHash()
+	annotations[r.GetConfigAnnotation()] = r.configHash(cron)
 
 	job := batchv1beta.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        fmt.Sprintf("%s-%s", "backup", r.MariaDBCluster.Name),
+			Name:        cron.GetJobName(),
 			Namespace:   r.MariaDBCluster.Namespace,
 			Annotations: annotations,
+			Labels:      Labels(cron),
 		},
 		Spec: batchv1beta.CronJobSpec{
 			Schedule: cron.Spec.CronExpression,
 			JobTemplate: batchv1beta.JobTemplateSpec{
+				// labels are copied to the jobs created by the cronjob
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: Labels(cron),
+				},
 				Spec: v1.JobSpec{
 					Parallelism:           nil,
 					Completions:           nil,
@@ -127,18 +214,19 @@ func (r *Reconciler) createCronJobs(cron *mariadbv1alpha1.MariaDBBackup) batchv1
 			},
 		},
 	}
-	controllerutil.SetControllerReference(r.MariaDBCluster, &job, r.Scheme)
+	setOwner(r.MariaDBCluster, cron, &job, r.Scheme)
 	return job
 }
 func (r *Reconciler) createJob(cron *mariadbv1alpha1.MariaDBBackup) batchv1.Job {
 	annotations := make(map[string]string)
-	annotations[r.GetConfigAnnotation()] = cron.GetConfigHash()
+	annotations[r.GetConfigAnnotation()] = r.configHash(cron)
 
 	job := batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        fmt.Sprintf("%s-%s", "backup", r.MariaDBCluster.Name),
+			Name:        cron.GetJobName(),
 			Namespace:   r.MariaDBCluster.Namespace,
 			Annotations: annotations,
+			Labels:      Labels(cron),
 		},
 		Spec: batchv1.JobSpec{
 			Parallelism:             nil,
@@ -151,24 +239,214 @@ func (r *Reconciler) createJob(cron *mariadbv1alpha1.MariaDBBackup) batchv1.Job
 			TTLSecondsAfterFinished: nil,
 		},
 	}
-	controllerutil.SetControllerReference(r.MariaDBCluster, &job, r.Scheme)
+	setOwner(r.MariaDBCluster, cron, &job, r.Scheme)
 	return job
 }
 func (r *Reconciler) createPodTemplate(cron *mariadbv1alpha1.MariaDBBackup) core.PodTemplateSpec {
+	env := []core.EnvVar{
+		{
+			Name:  "BACKUP_URL",
+			Value: cron.Spec.BackupURL,
+		},
+		{
+			Name:  "BACKUP_DB",
+			Value: cron.Spec.BackupDBName,
+		},
+		{
+			Name:  "BACKUP_NAME",
+			Value: cron.Name,
+		},
+		{
+			Name:  "BACKUP_METHOD",
+			Value: string(cron.GetMethod()),
+		},
+		{
+			Name:  "AGENT_PORT",
+			Value: strconv.Itoa(AgentPort),
+		},
+	}
+	env = append(env, retentionEnv(cron.Spec.Retention)...)
+
+	template := NewPodTemplate(r.MariaDBCluster, "backup", "/usr/bin/create-backup.sh", cron.Spec.BackupSecretName, env)
+	if cron.GetMethod() == mariadbv1alpha1.BackupMethodPhysical && r.MariaDBCluster.IsTLSEnabled() {
+		addAgentTLS(r.MariaDBCluster, &template)
+	}
+	return template
+}
+
+// retentionEnv passes retention policy to prune-backups.sh
+func retentionEnv(retention *mariadbv1alpha1.BackupRetention) []core.EnvVar {
+	if retention == nil {
+		return nil
+	}
+
+	maxAge := int64(0)
+	if retention.MaxAge != nil {
+		maxAge = int64(retention.MaxAge.Duration.Seconds())
+	}
+
+	return []core.EnvVar{
+		{
+			Name:  "RETENTION_KEEP_LAST",
+			Value: strconv.Itoa(int(retention.KeepLast)),
+		},
+		{
+			Name:  "RETENTION_KEEP_DAILY",
+			Value: strconv.Itoa(int(retention.KeepDaily)),
+		},
+		{
+			Name:  "RETENTION_KEEP_WEEKLY",
+			Value: strconv.Itoa(int(retention.KeepWeekly)),
+		},
+		{
+			Name:  "RETENTION_KEEP_MONTHLY",
+			Value: strconv.Itoa(int(retention.KeepMonthly)),
+		},
+		{
+			Name:  "RETENTION_MAX_AGE_SECONDS",
+			Value: strconv.FormatInt(maxAge, 10),
+		},
+	}
+}
+
+// setOwner makes the backup owner of the job, owner has to be in the same namespace
+// so jobs of backups from other namespaces are owned by the cluster
+func setOwner(cluster *mariadbv1alpha1.MariaDBCluster, cron *mariadbv1alpha1.MariaDBBackup, obj metav1.Object, scheme *runtime.Scheme) {
+	if cron.Namespace == cluster.Namespace {
+		controllerutil.SetControllerReference(cron, obj, scheme)
+	} else {
+		controllerutil.SetControllerReference(cluster, obj, scheme)
+	}
+}
+
+// Labels returns labels identifying jobs of the backup
+func Labels(cron *mariadbv1alpha1.MariaDBBackup) map[string]string {
+	return map[string]string{
+		NameLabel:      cron.Name,
+		NamespaceLabel: cron.Namespace,
+	}
+}
+
+// NewAgentContainer returns container streaming physical backups of the node it runs next to.
+// It shares the data volume with mariadb, the stream is served only to clients knowing the backup password.
+// With TLS enabled the stream is encrypted and clients have to present a certificate signed by the cluster CA,
+// the pod has to have the TLS volume.
+func NewAgentContainer(cluster *mariadbv1alpha1.MariaDBCluster, dataVolume string) core.Container {
+	listen := fmt.Sprintf("TCP-LISTEN:%d,reuseaddr,fork", AgentPort)
+	if cluster.IsTLSEnabled() {
+		listen = fmt.Sprintf("OPENSSL-LISTEN:%d,reuseaddr,fork,cert=%s,key=%s,cafile=%s,verify=1", AgentPort,
+			path.Join(tls.MountPath, core.TLSCertKey), path.Join(tls.MountPath, core.TLSPrivateKeyKey), path.Join(tls.MountPath, tls.CACertKey))
+	}
+
+	container := core.Container{
+		Name:            "backup-agent",
+		Image:           cluster.Spec.Image,
+		ImagePullPolicy: core.PullIfNotPresent,
+		Command:         []string{"socat"},
+		Args: []string{
+			listen,
+			"EXEC:/usr/share/container-scripts/mysql/stream-backup.sh",
+		},
+		Ports: []core.ContainerPort{{
+			ContainerPort: AgentPort,
+			Name:          "backup",
+		}},
+		EnvFrom: []core.EnvFromSource{
+			{
+				SecretRef: &core.SecretEnvSource{
+					LocalObjectReference: core.LocalObjectReference{
+						Name: cluster.GetOperatorSecretName(),
+					},
+				},
+			},
+		},
+		Env: []core.EnvVar{
+			{
+				// wsrep_desync can be changed only by root
+				Name: "MYSQL_ROOT_PASSWORD",
+				ValueFrom: &core.EnvVarSource{
+					SecretKeyRef: &cluster.Spec.RootPassword,
+				},
+			},
+		},
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      dataVolume,
+				MountPath: "/var/lib/mysql",
+			},
+		},
+	}
+	if cluster.IsTLSEnabled() {
+		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+			Name:      tls.VolumeName,
+			MountPath: tls.MountPath,
+			ReadOnly:  true,
+		})
+	}
+
+	return container
+}
+
+// addAgentTLS mounts the cluster certificate into the backup job, it authenticates the job to the backup agent
+// and verifies the agent is a node of the cluster
+func addAgentTLS(cluster *mariadbv1alpha1.MariaDBCluster, template *core.PodTemplateSpec) {
+	template.Spec.Volumes = append(template.Spec.Volumes, core.Volume{
+		Name: tls.VolumeName,
+		VolumeSource: core.VolumeSource{
+			Secret: &core.SecretVolumeSource{
+				SecretName: cluster.GetTLSSecretName(),
+			},
+		},
+	})
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+		Name:      tls.VolumeName,
+		MountPath: tls.MountPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(container.Env, core.EnvVar{
+		// the agent is reached through the headless service, its address is in the certificate
+		Name:  "AGENT_TLS_NAME",
+		Value: cluster.GetPrimaryHeadlessAddress(),
+	})
+}
+
+// NewPodTemplate returns pod template running the script from the cluster image with rclone
+// credentials from backupSecretName and database credentials from the operator secret
+func NewPodTemplate(cluster *mariadbv1alpha1.MariaDBCluster, name, script, backupSecretName string, env []core.EnvVar) core.PodTemplateSpec {
+	envs := []core.EnvVar{
+		{
+			Name:  "CLUSTER_NAME",
+			Value: cluster.Name,
+		},
+	}
+	envs = append(envs, env...)
+	envs = append(envs, []core.EnvVar{
+		{
+			Name:  "HOST",
+			Value: cluster.GetPrimaryHeadlessSvcName(),
+		},
+		{
+			Name:  "PORT",
+			Value: "3306",
+		},
+	}...)
+
 	return core.PodTemplateSpec{
 		Spec: core.PodSpec{
 			Volumes: nil,
 			Containers: []core.Container{
 				{
-					Name:    "backup",
-					Image:   r.MariaDBCluster.Spec.Image,
+					Name:    name,
+					Image:   cluster.Spec.Image,
 					Command: []string{"/bin/sh", "-c"},
-					Args:    []string{"/usr/bin/create-backup.sh"},
+					Args:    []string{script},
 					EnvFrom: []core.EnvFromSource{
 						{
 							SecretRef: &core.SecretEnvSource{
 								LocalObjectReference: core.LocalObjectReference{
-									Name: cron.Spec.BackupSecretName,
+									Name: backupSecretName,
 								},
 							},
 						},
@@ -176,33 +454,12 @@ func (r *Reconciler) createPodTemplate(cron *mariadbv1alpha1.MariaDBBackup) core
 
 							SecretRef: &core.SecretEnvSource{
 								LocalObjectReference: core.LocalObjectReference{
-									Name: r.MariaDBCluster.GetOperatorSecretName(),
+									Name: cluster.GetOperatorSecretName(),
 								},
 							},
 						},
 					},
-					Env: []core.EnvVar{
-						{
-							Name:  "CLUSTER_NAME",
-							Value: r.MariaDBCluster.Name,
-						},
-						{
-							Name:  "BACKUP_URL",
-							Value: cron.Spec.BackupURL,
-						},
-						{
-							Name:  "BACKUP_DB",
-							Value: cron.Spec.BackupDBName,
-						},
-						{
-							Name:  "HOST",
-							Value: r.MariaDBCluster.GetPrimaryHeadlessSvcName(),
-						},
-						{
-							Name:  "PORT",
-							Value: "3306",
-						},
-					},
+					Env:           envs,
 					VolumeMounts:  nil,
 					VolumeDevices: nil,
 				},
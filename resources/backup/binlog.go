@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"context"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// BinlogArchiveLabel is set on binlog archive jobs to find the MariaDBBackup they belong to
+	BinlogArchiveLabel = "mariadb/binlog-archive"
+)
+
+// BinlogArchiveReconciler runs a single binlog archive job
+type BinlogArchiveReconciler struct {
+	resources.Reconciler
+	backup    *mariadbv1alpha1.MariaDBBackup
+	sourcePod *core.Pod
+}
+
+func NewBinlogArchiveJob(client client.Client, directClient client.Reader, scheme *runtime.Scheme, cluster *mariadbv1alpha1.MariaDBCluster,
+	backup *mariadbv1alpha1.MariaDBBackup, sourcePod *core.Pod) *BinlogArchiveReconciler {
+	return &BinlogArchiveReconciler{
+		Reconciler: resources.Reconciler{
+			Client:         client,
+			Scheme:         scheme,
+			DirectClient:   directClient,
+			MariaDBCluster: cluster,
+		},
+		backup:    backup,
+		sourcePod: sourcePod,
+	}
+}
+
+func (r *BinlogArchiveReconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", "binlog-archive", "clusterName", r.MariaDBCluster.Name, "clusterNamespace", r.MariaDBCluster.Namespace)
+
+	log.V(1).Info("Reconciling")
+	job := r.createJob()
+	found := &batchv1.Job{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Namespace: job.Namespace,
+		Name:      job.Name,
+	}, found)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new job", "name", job.Name, "sourcePod", r.sourcePod.Name)
+		err = r.Client.Create(ctx, &job)
+		if err != nil {
+			log.Error(err, "Failed to create new job", "Name", job.Name)
+			return err
+		}
+	} else if err != nil {
+		log.Error(err, "Failed to get job", "Name", job.Name)
+		return err
+	}
+
+	// every run is a new job, finished jobs are removed by the controller
+	return nil
+}
+
+// BinlogArchiveLabels returns labels identifying binlog archive jobs of the backup
+func BinlogArchiveLabels(cron *mariadbv1alpha1.MariaDBBackup) map[string]string {
+	return map[string]string{
+		BinlogArchiveLabel: cron.Name,
+		NamespaceLabel:     cron.Namespace,
+	}
+}
+
+func (r *BinlogArchiveReconciler) createJob() batchv1.Job {
+	backoffLimit := int32(1)
+	template := NewPodTemplate(r.MariaDBCluster, "binlog-archive", "/usr/bin/archive-binlogs.sh", r.backup.Spec.BackupSecretName, []core.EnvVar{
+		{
+			Name:  "BINLOG_URL",
+			Value: r.backup.GetBinlogURL(),
+		},
+		{
+			// binary logs of galera nodes differ, all of them are read from a single node
+			Name:  "SOURCE_HOST",
+			Value: r.sourcePod.Status.PodIP,
+		},
+		{
+			// FLUSH BINARY LOGS and binlog dump require more than the backup user has
+			Name: "MYSQL_ROOT_PASSWORD",
+			ValueFrom: &core.EnvVarSource{
+				SecretKeyRef: &r.MariaDBCluster.Spec.RootPassword,
+			},
+		},
+	})
+
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.backup.GetBinlogArchiveJobName(),
+			Namespace: r.MariaDBCluster.Namespace,
+			Labels:    BinlogArchiveLabels(r.backup),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+	setOwner(r.MariaDBCluster, r.backup, &job, r.Scheme)
+	return job
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/aldor007/mariadb-operator/resources/tls"
+	"github.com/aldor007/mariadb-operator/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"path"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	componentName = "mariadb-config"
+	// FileName is the key in the config map and the name of the file in /etc/mysql/conf.d,
+	// files are read in alphabetical order so it goes last to override image defaults
+	FileName = "zz-operator.cnf"
+	// MountPath is the location of the rendered config in the server container
+	MountPath = "/etc/mysql/conf.d/" + FileName
+	// TLSFileName is the key of the TLS config in the config map, it's read after FileName so its options take precedence
+	TLSFileName = "zz-tls.cnf"
+	// TLSMountPath is the location of the TLS config in the server container
+	TLSMountPath = "/etc/mysql/conf.d/" + TLSFileName
+)
+
+// Reconciler implements the Component Reconciler
+type Reconciler struct {
+	resources.Reconciler
+}
+
+func NewConfigMap(client client.Client, directClient client.Reader, scheme *runtime.Scheme, cluster *mariadbv1alpha1.MariaDBCluster) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Client:         client,
+			Scheme:         scheme,
+			DirectClient:   directClient,
+			MariaDBCluster: cluster,
+		},
+	}
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", componentName, "clusterName", r.MariaDBCluster.Name, "clusterNamespace", r.MariaDBCluster.Namespace)
+
+	log.V(1).Info("Reconciling")
+	configMap := r.CreateConfigMap()
+	found := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      configMap.Name,
+		Namespace: r.MariaDBCluster.Namespace,
+	}, found)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new config map", "name", configMap.Name)
+		err = r.Client.Create(ctx, &configMap)
+		if err != nil {
+			log.Error(err, "Failed to create new config map", "configMap.Name", configMap.Name)
+			return err
+		}
+
+		return nil
+	} else if err != nil {
+		log.Error(err, "Failed to get config map")
+		return err
+	}
+
+	if !reflect.DeepEqual(found.Data, configMap.Data) {
+		found.Data = configMap.Data
+		err = r.Client.Update(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to update config map", "configMap.Name", found.Name)
+			return err
+		}
+		log.Info("Updated config map", "name", found.Name)
+	}
+
+	return nil
+}
+
+func (r *Reconciler) CreateConfigMap() corev1.ConfigMap {
+	c := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.MariaDBCluster.GetConfigMapName(),
+			Namespace: r.MariaDBCluster.Namespace,
+			Labels:    utils.Labels(r.MariaDBCluster),
+		},
+		Data: map[string]string{
+			FileName: r.MariaDBCluster.Spec.MariaDBConf.Render(),
+		},
+	}
+	if r.MariaDBCluster.IsTLSEnabled() {
+		c.Data[TLSFileName] = renderTLS(r.MariaDBCluster.Status.TLSMode == mariadbv1alpha1.TLSModeDynamic)
+	}
+
+	controllerutil.SetControllerReference(r.MariaDBCluster, &c, r.Scheme)
+	return c
+}
+
+// renderTLS returns my.cnf fragment enabling TLS for client connections and galera replication,
+// dynamic socket lets the node talk to the nodes which weren't restarted with the new TLS setting yet
+func renderTLS(dynamic bool) string {
+	ca := path.Join(tls.MountPath, tls.CACertKey)
+	cert := path.Join(tls.MountPath, corev1.TLSCertKey)
+	key := path.Join(tls.MountPath, corev1.TLSPrivateKeyKey)
+
+	var b strings.Builder
+	b.WriteString("# Managed by mariadb-operator, generated from MariaDBCluster spec.tls\n")
+	b.WriteString("[mysqld]\n")
+	b.WriteString(fmt.Sprintf("ssl_ca = %s\n", ca))
+	b.WriteString(fmt.Sprintf("ssl_cert = %s\n", cert))
+	b.WriteString(fmt.Sprintf("ssl_key = %s\n", key))
+	socket := "socket.ssl=yes"
+	if dynamic {
+		socket += ";socket.dynamic=yes"
+	}
+	b.WriteString(fmt.Sprintf("wsrep_provider_options = \"%s;socket.ssl_ca=%s;socket.ssl_cert=%s;socket.ssl_key=%s\"\n", socket, ca, cert, key))
+
+	return b.String()
+}
@@ -75,7 +75,7 @@ func (r *Reconciler) CreateHeadlessService(dbType string) corev1.Service {
 
 	s := corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      r.MariaDBCluster.GetPrimaryHeadlessSvcName(),
+			Name:      r.MariaDBCluster.GetHeadlessSvcName(dbType),
 			Namespace: r.MariaDBCluster.Namespace,
 			Labels:    labels,
 		},
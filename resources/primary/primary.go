@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/mysql"
 	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/aldor007/mariadb-operator/resources/backup"
+	"github.com/aldor007/mariadb-operator/resources/config"
+	"github.com/aldor007/mariadb-operator/resources/tls"
 	"github.com/aldor007/mariadb-operator/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -21,6 +25,12 @@ import (
 
 const (
 	componentName = "primary-server"
+	// PeerFinderPort is the port of the status endpoint of peer-finder running next to mysqld
+	PeerFinderPort = 3308
+	// TerminationGracePeriodSeconds is how long a galera node has to leave the cluster and shut down
+	TerminationGracePeriodSeconds = 120
+	// TLSModeAnnotation on the pod template is the TLS mode the galera nodes are started with
+	TLSModeAnnotation = "mariadb/tls-mode"
 )
 
 // Reconciler implements the Component Reconciler
@@ -55,6 +65,10 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 		Namespace: r.MariaDBCluster.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
+		// the nodes are added one by one also to a new cluster
+		replicas := r.nextReplicas(0)
+		statefulSet.Spec.Replicas = &replicas
+
 		// Create the deployment
 		log.Info("Creating a new Statefulset", "name", statefulSet.Name)
 		err = r.Client.Create(ctx, &statefulSet)
@@ -73,7 +87,18 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 		return err
 	}
 
-	if statefulSet.Annotations == nil || statefulSet.Annotations[r.GetConfigAnnotation()] != r.MariaDBCluster.GetConfigHash() {
+	current := int32(1)
+	if found.Spec.Replicas != nil {
+		current = *found.Spec.Replicas
+	}
+	replicas := r.nextReplicas(current)
+	statefulSet.Spec.Replicas = &replicas
+	if replicas != current {
+		log.Info("Scaling galera nodes", "from", current, "to", replicas, "desired", r.MariaDBCluster.Spec.PrimaryCount)
+	}
+
+	if replicas != current || found.Annotations[r.GetConfigAnnotation()] != r.MariaDBCluster.GetConfigHash() {
+		statefulSet.ResourceVersion = found.ResourceVersion
 		err = r.Client.Update(ctx, &statefulSet)
 		if err != nil {
 			log.Error(err, "Failed to update Deployment.", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
@@ -92,7 +117,10 @@ func (r *Reconciler) CreateStatefulSet(dbType string) (appsv1.StatefulSet, error
 
 	annotations := make(map[string]string)
 	annotations[r.GetConfigAnnotation()] = r.MariaDBCluster.GetConfigHash()
-	size := r.MariaDBCluster.Spec.PrimaryCount
+	size := r.MariaDBCluster.GetPrimaryReplicas()
+	if dbType == "replica" {
+		size = r.MariaDBCluster.Spec.ReplicaCount
+	}
 	image := r.MariaDBCluster.Spec.Image
 
 	rootPasswordSecret := &corev1.EnvVarSource{
@@ -104,10 +132,56 @@ func (r *Reconciler) CreateStatefulSet(dbType string) (appsv1.StatefulSet, error
 	}
 
 	dataVolume := fmt.Sprintf("data-%s", dbType)
+
+	// primary pods form a galera cluster, replicas are asynchronous slaves of it
+	modeEnv := []corev1.EnvVar{
+		{
+			Name:  "GALLERA_MODE",
+			Value: "yes",
+		},
+	}
+	envFrom := []corev1.EnvFromSource{
+		{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: r.MariaDBCluster.GetOperatorSecretName(),
+				},
+			},
+		},
+	}
+	if dbType == "primary" && r.MariaDBCluster.Spec.InitBucketURL != "" {
+		// the first pod of a new cluster restores the backup, the others join it using SST
+		modeEnv = append(modeEnv, corev1.EnvVar{
+			Name:  "INIT_BUCKET_URL",
+			Value: r.MariaDBCluster.Spec.InitBucketURL,
+		})
+		if r.MariaDBCluster.Spec.InitBucketSecretName != "" {
+			envFrom = append(envFrom, corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: r.MariaDBCluster.Spec.InitBucketSecretName,
+					},
+				},
+			})
+		}
+	}
+	if dbType == "replica" {
+		modeEnv = []corev1.EnvVar{
+			{
+				Name:  "REPLICA_MODE",
+				Value: "yes",
+			},
+			{
+				Name:  "PRIMARY_HOST",
+				Value: r.MariaDBCluster.GetPrimaryHeadlessAddress(),
+			},
+		}
+	}
 	statefulset := appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-%s", r.MariaDBCluster.Name, dbType),
-			Namespace: r.MariaDBCluster.Namespace,
+			Name:        fmt.Sprintf("%s-%s", r.MariaDBCluster.Name, dbType),
+			Namespace:   r.MariaDBCluster.Namespace,
+			Annotations: annotations,
 		},
 		Spec: appsv1.StatefulSetSpec{
 			Replicas:    &size,
@@ -137,9 +211,25 @@ func (r *Reconciler) CreateStatefulSet(dbType string) (appsv1.StatefulSet, error
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					// dynamic variables are applied online, the pods are restarted only when a static one changes
+					Annotations: map[string]string{
+						r.GetRestartConfigAnnotation(): r.MariaDBCluster.Status.RestartConfigHash,
+					},
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: r.MariaDBCluster.GetServiceAccountName(),
+					Volumes: []corev1.Volume{
+						{
+							Name: "mariadb-conf",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: r.MariaDBCluster.GetConfigMapName(),
+									},
+								},
+							},
+						},
+					},
 					Containers: []corev1.Container{{
 						Image:           image,
 						ImagePullPolicy: corev1.PullIfNotPresent,
@@ -169,17 +259,15 @@ func (r *Reconciler) CreateStatefulSet(dbType string) (appsv1.StatefulSet, error
 								Name:      dataVolume,
 								MountPath: "/var/lib/mysql",
 							},
-						},
-						EnvFrom: []corev1.EnvFromSource{
 							{
-								SecretRef: &corev1.SecretEnvSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: r.MariaDBCluster.GetOperatorSecretName(),
-									},
-								},
+								// subPath keeps the files written by the entrypoint into conf.d visible
+								Name:      "mariadb-conf",
+								MountPath: config.MountPath,
+								SubPath:   config.FileName,
 							},
 						},
-						Env: []corev1.EnvVar{
+						EnvFrom: envFrom,
+						Env: append([]corev1.EnvVar{
 							{
 								Name:      "MYSQL_ROOT_PASSWORD",
 								ValueFrom: rootPasswordSecret,
@@ -188,10 +276,6 @@ func (r *Reconciler) CreateStatefulSet(dbType string) (appsv1.StatefulSet, error
 								Name:  "LABEL_SELECTOR",
 								Value: fmt.Sprintf("mariadb/pods=%s-%s", r.MariaDBCluster.Name, dbType),
 							},
-							{
-								Name:  "GALLERA_MODE",
-								Value: "yes",
-							},
 							{
 								Name:  "CLUSTER_NAME",
 								Value: r.MariaDBCluster.Name,
@@ -212,13 +296,109 @@ func (r *Reconciler) CreateStatefulSet(dbType string) (appsv1.StatefulSet, error
 									},
 								},
 							},
-						},
+						}, modeEnv...),
 					}},
 				},
 			},
 		},
 	}
 
+	if r.MariaDBCluster.IsTLSEnabled() {
+		r.addTLS(&statefulset.Spec.Template)
+	}
+
+	if dbType == "primary" {
+		// peer-finder serves the galera membership it sees
+		container := &statefulset.Spec.Template.Spec.Containers[0]
+		container.Ports = append(container.Ports, corev1.ContainerPort{
+			ContainerPort: PeerFinderPort,
+			Name:          "peer-finder",
+		})
+		// the node leaves the cluster gracefully before the pod is killed, so the others don't wait for it to come back
+		container.Lifecycle = &corev1.Lifecycle{
+			PreStop: &corev1.Handler{
+				Exec: &corev1.ExecAction{
+					Command: []string{"/usr/share/container-scripts/mysql/leave-cluster.sh"},
+				},
+			},
+		}
+		gracePeriod := int64(TerminationGracePeriodSeconds)
+		statefulset.Spec.Template.Spec.TerminationGracePeriodSeconds = &gracePeriod
+		// the operator restarts the pods one at a time once the others are synced, see the rolling upgrade of the cluster
+		statefulset.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.OnDeleteStatefulSetStrategyType,
+		}
+		// physical backups are taken from the Galera nodes
+		statefulset.Spec.Template.Spec.Containers = append(statefulset.Spec.Template.Spec.Containers, backup.NewAgentContainer(r.MariaDBCluster, dataVolume))
+	}
+
 	controllerutil.SetControllerReference(r.MariaDBCluster, &statefulset, r.Scheme)
 	return statefulset, nil
 }
+
+// nextReplicas returns the number of galera nodes for the next step of scaling from current towards the spec.
+// A node is added only when all nodes are synced and removed only when the remaining ones are synced,
+// the status refreshed after the previous step has to list the pods of the current size.
+func (r *Reconciler) nextReplicas(current int32) int32 {
+	cluster := r.MariaDBCluster
+	// the recovery stops and starts the pods on its own
+	if cluster.IsRecovering() {
+		return cluster.GetPrimaryReplicas()
+	}
+
+	desired := cluster.GetPrimaryReplicas()
+	if desired == current || cluster.ValidatePrimaryCount() != nil || int32(len(cluster.Status.Nodes)) != current {
+		return current
+	}
+
+	if desired > current {
+		if r.syncedNodes(current) == current {
+			return current + 1
+		}
+	} else if r.syncedNodes(current-1) == current-1 {
+		return current - 1
+	}
+
+	return current
+}
+
+// syncedNodes returns number of synced nodes with ordinal lower than below
+func (r *Reconciler) syncedNodes(below int32) int32 {
+	synced := int32(0)
+	for _, node := range r.MariaDBCluster.Status.Nodes {
+		ordinal := mariadbv1alpha1.PodOrdinal(node.Name)
+		if ordinal >= 0 && ordinal < below && node.Ready && node.LocalState == mysql.GaleraStateSynced && node.ClusterStatus == mysql.GaleraClusterPrimary {
+			synced++
+		}
+	}
+	return synced
+}
+
+// addTLS mounts the server certificate with the config using it into the server container
+func (r *Reconciler) addTLS(template *corev1.PodTemplateSpec) {
+	template.Annotations[r.GetTLSCertificateAnnotation()] = r.MariaDBCluster.Status.TLSCertificateHash
+	// only the rendered config changes between the passes of turning TLS on or off
+	template.Annotations[TLSModeAnnotation] = string(r.MariaDBCluster.Status.TLSMode)
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: tls.VolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: r.MariaDBCluster.GetTLSSecretName(),
+			},
+		},
+	})
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts,
+		corev1.VolumeMount{
+			Name:      tls.VolumeName,
+			MountPath: tls.MountPath,
+			ReadOnly:  true,
+		},
+		corev1.VolumeMount{
+			Name:      "mariadb-conf",
+			MountPath: config.TLSMountPath,
+			SubPath:   config.TLSFileName,
+		},
+	)
+}
@@ -12,6 +12,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -82,6 +83,13 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 		// Error that isn't due to the deployment not existing
 		log.Error(err, "Failed to get role")
 		return err
+	} else if !reflect.DeepEqual(foundRole.Rules, role.Rules) {
+		log.Info("Updating Role", "name", role.Name)
+		foundRole.Rules = role.Rules
+		if err := r.Client.Update(ctx, foundRole); err != nil {
+			log.Error(err, "Failed to update role", "Name", role.Name)
+			return err
+		}
 	}
 
 	foundRoleBinding := &rbacv1.RoleBinding{}
@@ -117,7 +125,8 @@ func (r *Reconciler) CreateRole() rbacv1.Role {
 		},
 		Rules: []rbacv1.PolicyRule{
 			{
-				Verbs:     []string{"get", "list"},
+				// peer-finder watches the pods of the cluster
+				Verbs:     []string{"get", "list", "watch"},
 				APIGroups: []string{""},
 				Resources: []string{"pods/status", "pods"},
 			},
@@ -0,0 +1,138 @@
+package recovery
+
+import (
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RecoveryLabel marks the jobs reading galera state of the volumes of the cluster
+	RecoveryLabel = "mariadb/recovery"
+	// recoveryScript prints grastate.dat with the seqno recovered by mysqld --wsrep-recover into the termination log
+	recoveryScript = "/usr/share/container-scripts/mysql/galera-recovery.sh"
+	// jobDeadlineSeconds limits the time of the crash recovery of InnoDB done by mysqld --wsrep-recover
+	jobDeadlineSeconds = 600
+)
+
+// JobName returns name of the job reading galera state of the volume of the primary pod with the ordinal
+func JobName(cluster *mariadbv1alpha1.MariaDBCluster, ordinal int32) string {
+	return fmt.Sprintf("%s-recovery-%d", cluster.GetStatefulsetName("primary"), ordinal)
+}
+
+// BootstrapPodName returns name of the pod which bootstraps the new cluster
+func BootstrapPodName(cluster *mariadbv1alpha1.MariaDBCluster) string {
+	return fmt.Sprintf("%s-bootstrap", cluster.GetStatefulsetName("primary"))
+}
+
+// JoinerPodName returns name of the pod which joins the cluster bootstrapped from the volume of the first pod
+func JoinerPodName(cluster *mariadbv1alpha1.MariaDBCluster) string {
+	return fmt.Sprintf("%s-joiner", cluster.GetStatefulsetName("primary"))
+}
+
+// ClaimName returns name of the volume claim of the statefulset pod with the ordinal
+func ClaimName(sts *appsv1.StatefulSet, ordinal int32) string {
+	return fmt.Sprintf("%s-%s-%d", sts.Spec.VolumeClaimTemplates[0].Name, sts.Name, ordinal)
+}
+
+// NewJob returns job which reads galera state of the volume of the primary pod with the ordinal.
+// The pods of the statefulset have to be stopped, mysqld --wsrep-recover needs exclusive access to the data.
+func NewJob(cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, ordinal int32) *batchv1.Job {
+	labels := utils.Labels(cluster)
+	labels[RecoveryLabel] = cluster.Name
+
+	spec := podSpec(sts, ordinal)
+	spec.RestartPolicy = corev1.RestartPolicyNever
+	container := &spec.Containers[0]
+	container.Command = []string{recoveryScript}
+	container.Ports = nil
+	container.ReadinessProbe = nil
+	container.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+
+	backoffLimit := int32(2)
+	deadline := int64(jobDeadlineSeconds)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      JobName(cluster, ordinal),
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: spec,
+			},
+		},
+	}
+}
+
+// NewBootstrapPod returns pod which starts a new cluster with --wsrep-new-cluster from the volume of the primary pod
+// with the ordinal. It has labels of the statefulset pods, so they find it as their peer and join it.
+func NewBootstrapPod(cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, ordinal int32) *corev1.Pod {
+	labels := make(map[string]string, len(sts.Spec.Template.Labels))
+	for key, value := range sts.Spec.Template.Labels {
+		labels[key] = value
+	}
+
+	spec := podSpec(sts, ordinal)
+	spec.RestartPolicy = corev1.RestartPolicyNever
+	container := &spec.Containers[0]
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "GALERA_NEW_CLUSTER",
+		Value: "yes",
+	})
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BootstrapPodName(cluster),
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: spec,
+	}
+}
+
+// NewJoinerPod returns pod which joins the bootstrapped cluster with the volume of the primary pod with the ordinal.
+// It keeps the primary component while the volume of the bootstrap pod is handed over to the first statefulset pod.
+func NewJoinerPod(cluster *mariadbv1alpha1.MariaDBCluster, sts *appsv1.StatefulSet, ordinal int32) *corev1.Pod {
+	labels := make(map[string]string, len(sts.Spec.Template.Labels))
+	for key, value := range sts.Spec.Template.Labels {
+		labels[key] = value
+	}
+
+	spec := podSpec(sts, ordinal)
+	spec.RestartPolicy = corev1.RestartPolicyNever
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      JoinerPodName(cluster),
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: spec,
+	}
+}
+
+// podSpec returns spec of the statefulset pods running only the server container with the volume of the pod with the ordinal
+func podSpec(sts *appsv1.StatefulSet, ordinal int32) corev1.PodSpec {
+	spec := *sts.Spec.Template.Spec.DeepCopy()
+	spec.Containers = spec.Containers[:1]
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: sts.Spec.VolumeClaimTemplates[0].Name,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: ClaimName(sts, ordinal),
+			},
+		},
+	})
+
+	return spec
+}
@@ -51,6 +51,10 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 		Namespace: r.MariaDBCluster.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
+		if r.MariaDBCluster.Spec.ReplicaCount == 0 {
+			log.V(1).Info("Replicas not enabled")
+			return nil
+		}
 		// Create the deployment
 		log.Info("Creating a new Statefulset", "name", statefulSet.Name)
 		err = r.Client.Create(ctx, &statefulSet)
@@ -72,37 +76,30 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 	// Check for any updates for redeployment
 	applyChange := false
 
-	// Ensure the deployment size is same as the spec
+	// Ensure the deployment size is same as the spec, scaling to 0 keeps the volumes
 	size := r.MariaDBCluster.Spec.ReplicaCount
-	if size == 0 {
-		log.Info("Skipping processing")
-		return nil
-	}
-	if *statefulSet.Spec.Replicas != size {
-		statefulSet.Spec.Replicas = &size
+	if found.Spec.Replicas == nil || *found.Spec.Replicas != size {
 		applyChange = true
 	}
 
-	// Ensure image name is correct, update image if required
-	image := r.MariaDBCluster.Spec.Image
-	var currentImage string = ""
-
-	if found.Spec.Template.Spec.Containers != nil {
-		currentImage = found.Spec.Template.Spec.Containers[0].Image
+	// the hash covers the image and TLS of the pods, e.g. the replicas need the certificate to connect to TLS primary
+	if found.Annotations[r.GetConfigAnnotation()] != r.MariaDBCluster.GetConfigHash() {
+		applyChange = true
 	}
 
-	if image != currentImage {
-		statefulSet.Spec.Template.Spec.Containers[0].Image = image
+	// Ensure the pods are restarted when a static config variable changed
+	if found.Spec.Template.Annotations[r.GetRestartConfigAnnotation()] != r.MariaDBCluster.Status.RestartConfigHash {
 		applyChange = true
 	}
 
 	if applyChange {
+		statefulSet.ResourceVersion = found.ResourceVersion
 		err = r.Client.Update(ctx, &statefulSet)
 		if err != nil {
 			log.Error(err, "Failed to update Deployment.", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
 			return err
 		}
-		log.Info("Updated Deployment image. ")
+		log.Info("Updated replica statefulset", "name", found.Name)
 	}
 
 	return nil
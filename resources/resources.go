@@ -73,6 +73,16 @@ func (r *Reconciler) GetConfigAnnotation() string {
 	return "mariadb/config"
 }
 
+// GetRestartConfigAnnotation is set on the pod template, changing it restarts the pods
+func (r *Reconciler) GetRestartConfigAnnotation() string {
+	return "mariadb/restart-config"
+}
+
+// GetTLSCertificateAnnotation is set on the pod template to hash of the server certificate, so the pods reload it
+func (r *Reconciler) GetTLSCertificateAnnotation() string {
+	return "mariadb/tls-certificate"
+}
+
 // ComponentReconciler describes the Reconcile method
 type ComponentReconciler interface {
 	Reconcile(ctx context.Context, log logr.Logger) error
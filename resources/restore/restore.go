@@ -0,0 +1,135 @@
+package restore
+
+import (
+	"context"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/aldor007/mariadb-operator/resources/backup"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	componentName = "restore"
+)
+
+// Reconciler implements the Component Reconciler
+type Reconciler struct {
+	resources.Reconciler
+	restore          *mariadbv1alpha1.MariaDBRestore
+	backupURL        string
+	backupSecretName string
+	backupPrefix     string
+}
+
+func NewRestoreJob(client client.Client, directClient client.Reader, scheme *runtime.Scheme, cluster *mariadbv1alpha1.MariaDBCluster,
+	restore *mariadbv1alpha1.MariaDBRestore, backupURL, backupSecretName, backupPrefix string) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Client:         client,
+			Scheme:         scheme,
+			DirectClient:   directClient,
+			MariaDBCluster: cluster,
+		},
+		restore:          restore,
+		backupURL:        backupURL,
+		backupSecretName: backupSecretName,
+		backupPrefix:     backupPrefix,
+	}
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	log = log.WithValues("component", componentName, "clusterName", r.MariaDBCluster.Name, "clusterNamespace", r.MariaDBCluster.Namespace)
+
+	log.V(1).Info("Reconciling")
+	job := r.createJob()
+	found := &batchv1.Job{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Namespace: job.Namespace,
+		Name:      job.Name,
+	}, found)
+	if err != nil && apierrors.IsNotFound(err) {
+		log.Info("Creating a new job", "name", job.Name)
+		err = r.Client.Create(ctx, &job)
+		if err != nil {
+			log.Error(err, "Failed to create new job", "Name", job.Name)
+			return err
+		}
+	} else if err != nil {
+		log.Error(err, "Failed to get job")
+		return err
+	}
+
+	// restore runs only once, the job is never updated
+	return nil
+}
+
+func (r *Reconciler) createJob() batchv1.Job {
+	env := []core.EnvVar{
+		{
+			Name:  "BACKUP_URL",
+			Value: r.backupURL,
+		},
+		{
+			// other backups of the cluster can be stored in the same location
+			Name:  "BACKUP_PREFIX",
+			Value: r.backupPrefix,
+		},
+		{
+			Name:  "RESTORE_DB",
+			Value: r.restore.Spec.DBName,
+		},
+		{
+			// backup user can only read, restore needs to write
+			Name: "MYSQL_ROOT_PASSWORD",
+			ValueFrom: &core.EnvVarSource{
+				SecretKeyRef: &r.MariaDBCluster.Spec.RootPassword,
+			},
+		},
+	}
+	if target := r.restore.Spec.PointInTime; target != nil {
+		if target.Time != nil {
+			env = append(env, core.EnvVar{
+				Name:  "RESTORE_TIME",
+				Value: strconv.FormatInt(target.Time.Unix(), 10),
+			})
+		}
+		if target.GTID != "" {
+			env = append(env, core.EnvVar{
+				Name:  "RESTORE_GTID",
+				Value: target.GTID,
+			})
+		}
+	}
+	template := backup.NewPodTemplate(r.MariaDBCluster, "restore", "/usr/bin/restore-backup.sh", r.backupSecretName, env)
+
+	// a failed restore already changed the live data, it's not retried
+	backoffLimit := int32(0)
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.restore.GetJobName(),
+			Namespace: r.MariaDBCluster.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     template,
+		},
+	}
+
+	// owner has to be in the same namespace as the job
+	if r.restore.Namespace == r.MariaDBCluster.Namespace {
+		controllerutil.SetControllerReference(r.restore, &job, r.Scheme)
+	} else {
+		controllerutil.SetControllerReference(r.MariaDBCluster, &job, r.Scheme)
+	}
+	return job
+}
@@ -2,6 +2,7 @@ package secret
 
 import (
 	"context"
+	"fmt"
 	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
 	"github.com/aldor007/mariadb-operator/resources"
 	"github.com/aldor007/mariadb-operator/utils"
@@ -17,6 +18,8 @@ import (
 
 const (
 	componentName = "primary-server"
+	// passwordLength is the length of generated passwords of the operator accounts
+	passwordLength = 24
 )
 
 // Reconciler implements the Component Reconciler
@@ -46,14 +49,17 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 			Namespace: r.MariaDBCluster.Namespace,
 		},
 	}
-	secret.StringData = make(map[string]string)
-	secret.StringData["BACKUP_USER"] = "backup"
-	secret.StringData["BACKUP_PASSWORD"] = utils.RandString(10)
+	credentials, err := r.defaultCredentials()
+	if err != nil {
+		return fmt.Errorf("failed to generate credentials, err: %s", err)
+	}
+	secret.StringData = credentials
 
-	err := r.Client.Get(ctx, types.NamespacedName{
+	found := &core.Secret{}
+	err = r.Client.Get(ctx, types.NamespacedName{
 		Name:      secret.Name,
 		Namespace: secret.Namespace,
-	}, secret)
+	}, found)
 
 	if err != nil && apierrors.IsNotFound(err) {
 		log.Info("creating secret")
@@ -61,7 +67,54 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 		if err != nil {
 			return err
 		}
+	} else if err != nil {
+		return err
+	} else if r.addMissingCredentials(found, credentials) {
+		log.Info("adding missing credentials to secret")
+		err = r.Client.Update(ctx, found)
+		if err != nil {
+			return err
+		}
 	}
 	controllerutil.SetControllerReference(r.MariaDBCluster, secret, r.Scheme)
 	return nil
 }
+
+// defaultCredentials returns accounts of the operator, the passwords authenticate the backup agent too so they can't be predictable
+func (r *Reconciler) defaultCredentials() (map[string]string, error) {
+	backupPassword, err := utils.RandPassword(passwordLength)
+	if err != nil {
+		return nil, err
+	}
+	replicationPassword, err := utils.RandPassword(passwordLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"BACKUP_USER":          "backup",
+		"BACKUP_PASSWORD":      backupPassword,
+		"REPLICATION_USER":     "replication",
+		"REPLICATION_PASSWORD": replicationPassword,
+	}, nil
+}
+
+// addMissingCredentials fills keys added in newer operator versions, returns true when secret was changed
+func (r *Reconciler) addMissingCredentials(secret *core.Secret, credentials map[string]string) bool {
+	changed := false
+	for key, value := range credentials {
+		if _, ok := secret.Data[key]; ok {
+			continue
+		}
+		if _, ok := secret.StringData[key]; ok {
+			continue
+		}
+		if secret.StringData == nil {
+			secret.StringData = make(map[string]string)
+		}
+		secret.StringData[key] = value
+		changed = true
+	}
+
+	return changed
+}
@@ -11,6 +11,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"github.com/go-logr/logr"
@@ -73,10 +74,18 @@ func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
 		return err
 	}
 
+	// services created before replicas were supported select replica pods as well
+	if !reflect.DeepEqual(foundSvc.Spec.Selector, svc.Spec.Selector) {
+		foundSvc.Spec.Selector = svc.Spec.Selector
+		log.Info("Updating service selector", "service.Name", svc.Name)
+		return r.Client.Update(ctx, foundSvc)
+	}
+
 	return nil
 }
 func (r *Reconciler) CreatePrimaryService() corev1.Service {
 	labels := utils.Labels(r.MariaDBCluster)
+	labels["mariadb/type"] = "primary"
 
 	s := corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
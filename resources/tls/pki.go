@@ -0,0 +1,147 @@
+package tls
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	keySize = 2048
+	// caValidity is the lifetime of the CA generated by the operator
+	caValidity = 10 * 365 * 24 * time.Hour
+	// certificateValidity is the lifetime of the server certificate issued by the operator
+	certificateValidity = 365 * 24 * time.Hour
+	// renewBefore is how long before expiration the server certificate is issued again
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// newCA returns a self signed CA certificate and its key in PEM format
+func newCA(commonName string) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodeCertificate(der), encodeKey(key), nil
+}
+
+// newServerCertificate returns a certificate for the dns names signed by the CA and its key in PEM format.
+// Galera nodes use the same certificate to authenticate each other so it's valid also for client authentication.
+func newServerCertificate(caCertPEM, caKeyPEM []byte, commonName string, dnsNames []string) ([]byte, []byte, error) {
+	caCert, err := parseCertificate(caCertPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	caKey, err := parseKey(caKeyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodeCertificate(der), encodeKey(key), nil
+}
+
+// needsRenewal checks if the server certificate is about to expire, isn't signed by the CA or has different dns names
+func needsRenewal(certPEM, caCertPEM []byte, dnsNames []string) bool {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return true
+	}
+	caCert, err := parseCertificate(caCertPEM)
+	if err != nil {
+		return true
+	}
+
+	if time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return true
+	}
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		return true
+	}
+
+	current := append([]string{}, cert.DNSNames...)
+	desired := append([]string{}, dnsNames...)
+	sort.Strings(current)
+	sort.Strings(desired)
+	return !reflect.DeepEqual(current, desired)
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("failed to decode certificate")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parseKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, errors.New("failed to decode private key")
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
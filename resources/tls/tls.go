@@ -0,0 +1,195 @@
+package tls
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/resources"
+	"github.com/aldor007/mariadb-operator/utils"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	componentName = "tls"
+	// CACertKey is the key of the CA certificate in the secrets
+	CACertKey = mariadbv1alpha1.TLSCACertKey
+	// CAKeyKey is the key of the CA private key in the secret with CA generated by the operator
+	CAKeyKey = "ca.key"
+	// VolumeName is the name of the volume with the server certificate
+	VolumeName = "tls"
+	// MountPath is the directory the server certificate is mounted in
+	MountPath = "/etc/mysql/tls"
+)
+
+// Reconciler implements the Component Reconciler
+type Reconciler struct {
+	resources.Reconciler
+}
+
+func NewTLS(client client.Client, directClient client.Reader, scheme *runtime.Scheme, cluster *mariadbv1alpha1.MariaDBCluster) *Reconciler {
+	return &Reconciler{
+		Reconciler: resources.Reconciler{
+			Client:         client,
+			Scheme:         scheme,
+			DirectClient:   directClient,
+			MariaDBCluster: cluster,
+		},
+	}
+}
+
+// Reconcile issues the server certificate when it's generated by the operator and records hash of the certificate
+// in the cluster status, so the pods are restarted when the certificate changes
+func (r *Reconciler) Reconcile(ctx context.Context, log logr.Logger) error {
+	if !r.MariaDBCluster.IsTLSEnabled() {
+		r.MariaDBCluster.Status.TLSCertificateHash = ""
+		return nil
+	}
+	log = log.WithValues("component", componentName, "clusterName", r.MariaDBCluster.Name, "clusterNamespace", r.MariaDBCluster.Namespace)
+
+	log.V(1).Info("Reconciling")
+
+	if r.MariaDBCluster.IsTLSGenerated() {
+		ca, err := r.reconcileCA(ctx, log)
+		if err != nil {
+			return err
+		}
+		if err := r.reconcileServerCertificate(ctx, ca, log); err != nil {
+			return err
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      r.MariaDBCluster.GetTLSSecretName(),
+		Namespace: r.MariaDBCluster.Namespace,
+	}, secret)
+	if err != nil {
+		return fmt.Errorf("failed to get TLS secret, err: %s", err)
+	}
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, CACertKey} {
+		if len(secret.Data[key]) == 0 {
+			return fmt.Errorf("TLS secret %s is missing %s", secret.Name, key)
+		}
+	}
+
+	h := sha256.New()
+	h.Write(secret.Data[corev1.TLSCertKey])
+	r.MariaDBCluster.Status.TLSCertificateHash = hex.EncodeToString(h.Sum(nil))
+
+	return nil
+}
+
+// reconcileCA creates the secret with the CA of the cluster if it doesn't exist
+func (r *Reconciler) reconcileCA(ctx context.Context, log logr.Logger) (*corev1.Secret, error) {
+	found := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      r.MariaDBCluster.GetCASecretName(),
+		Namespace: r.MariaDBCluster.Namespace,
+	}, found)
+	if err == nil {
+		return found, nil
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err := newCA(fmt.Sprintf("%s-ca", r.MariaDBCluster.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA, err: %s", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.MariaDBCluster.GetCASecretName(),
+			Namespace: r.MariaDBCluster.Namespace,
+			Labels:    utils.Labels(r.MariaDBCluster),
+		},
+		Data: map[string][]byte{
+			CACertKey: certPEM,
+			CAKeyKey:  keyPEM,
+		},
+	}
+	if err := controllerutil.SetControllerReference(r.MariaDBCluster, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	log.Info("creating CA secret", "secret", secret.Name)
+	if err := r.Client.Create(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// reconcileServerCertificate issues the server certificate when it's missing, about to expire or the CA changed
+func (r *Reconciler) reconcileServerCertificate(ctx context.Context, ca *corev1.Secret, log logr.Logger) error {
+	dnsNames := r.dnsNames()
+	found := &corev1.Secret{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      r.MariaDBCluster.GetTLSSecretName(),
+		Namespace: r.MariaDBCluster.Namespace,
+	}, found)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && !needsRenewal(found.Data[corev1.TLSCertKey], ca.Data[CACertKey], dnsNames) {
+		return nil
+	}
+
+	certPEM, keyPEM, err := newServerCertificate(ca.Data[CACertKey], ca.Data[CAKeyKey], r.MariaDBCluster.GetPrimaryHeadlessAddress(), dnsNames)
+	if err != nil {
+		return fmt.Errorf("failed to issue server certificate, err: %s", err)
+	}
+	data := map[string][]byte{
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+		CACertKey:               ca.Data[CACertKey],
+	}
+
+	if exists {
+		log.Info("renewing server certificate", "secret", found.Name)
+		found.Data = data
+		return r.Client.Update(ctx, found)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.MariaDBCluster.GetTLSSecretName(),
+			Namespace: r.MariaDBCluster.Namespace,
+			Labels:    utils.Labels(r.MariaDBCluster),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+	if err := controllerutil.SetControllerReference(r.MariaDBCluster, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	log.Info("creating server certificate", "secret", secret.Name)
+	return r.Client.Create(ctx, secret)
+}
+
+// dnsNames returns names of the services and pods the server certificate is valid for
+func (r *Reconciler) dnsNames() []string {
+	names := []string{"localhost"}
+	for _, address := range []string{r.MariaDBCluster.GetPrimaryAddress(), r.MariaDBCluster.GetPrimaryHeadlessAddress()} {
+		names = append(names, address, address+".svc", address+".svc.cluster.local")
+	}
+
+	// pods are addressed through the headless services
+	for _, dbType := range []string{"primary", "replica"} {
+		address := fmt.Sprintf("%s.%s", r.MariaDBCluster.GetHeadlessSvcName(dbType), r.MariaDBCluster.Namespace)
+		names = append(names, "*."+address, "*."+address+".svc", "*."+address+".svc.cluster.local")
+	}
+
+	return names
+}
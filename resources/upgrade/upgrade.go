@@ -0,0 +1,72 @@
+package upgrade
+
+import (
+	"fmt"
+	mariadbv1alpha1 "github.com/aldor007/mariadb-operator/api/v1alpha1"
+	"github.com/aldor007/mariadb-operator/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// UpgradeLabel marks the jobs running mariadb-upgrade on the galera nodes of the cluster
+	UpgradeLabel = "mariadb/upgrade"
+	// upgradeScript runs mariadb-upgrade against the node at MYSQL_HOST
+	upgradeScript = "/usr/share/container-scripts/mysql/mariadb-upgrade.sh"
+	// jobDeadlineSeconds limits the time of the upgrade of the system tables
+	jobDeadlineSeconds = 1800
+)
+
+// JobName returns name of the job running mariadb-upgrade on the primary pod with the ordinal
+func JobName(cluster *mariadbv1alpha1.MariaDBCluster, ordinal int32) string {
+	return fmt.Sprintf("%s-upgrade-%d", cluster.GetStatefulsetName("primary"), ordinal)
+}
+
+// NewJob returns job which runs mariadb-upgrade of the image of the primary pod against it.
+// The system tables are not replicated by galera, so it runs on every node after it rejoined the cluster.
+func NewJob(cluster *mariadbv1alpha1.MariaDBCluster, pod *corev1.Pod) *batchv1.Job {
+	labels := utils.Labels(cluster)
+	labels[UpgradeLabel] = cluster.Name
+
+	server := pod.Spec.Containers[0]
+	backoffLimit := int32(2)
+	deadline := int64(jobDeadlineSeconds)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      JobName(cluster, mariadbv1alpha1.PodOrdinal(pod.Name)),
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:            "mariadb-upgrade",
+						Image:           server.Image,
+						ImagePullPolicy: server.ImagePullPolicy,
+						Command:         []string{upgradeScript},
+						Env: []corev1.EnvVar{
+							{
+								Name:  "MYSQL_HOST",
+								Value: pod.Status.PodIP,
+							},
+							{
+								Name: "MYSQL_ROOT_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &cluster.Spec.RootPassword,
+								},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
@@ -1,16 +1,12 @@
 package utils
 
 import (
+	crand "crypto/rand"
 	"github.com/aldor007/mariadb-operator/api/v1alpha1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"math/rand"
-	"time"
+	"math/big"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 func Labels(cluster *v1alpha1.MariaDBCluster) map[string]string {
 	return map[string]string{
 		"app":             "MariaDB",
@@ -83,12 +79,18 @@ func StringIn(str string, strs []string) (int, bool) {
 	return 0, false
 }
 
-var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+var passwordRunes = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
-func RandString(n int) string {
-	b := make([]rune, n)
+// RandPassword returns a password of length n generated with a cryptographically secure generator
+func RandPassword(n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(passwordRunes)))
 	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+		idx, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passwordRunes[idx.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }